@@ -22,6 +22,7 @@ package norx
 import (
 	"crypto/cipher"
 	"errors"
+	"sync"
 )
 
 var (
@@ -36,13 +37,24 @@ var (
 	// ErrOpen is the error returned when the message authentication fails
 	// during an Open call.
 	ErrOpen = errors.New("norx: message authentication failed")
+
+	// ErrReset is the error returned (or thrown via a panic by Seal) when
+	// an AEAD instance is used after Reset has been called.
+	ErrReset = errors.New("norx: use of reset AEAD instance")
 )
 
 // AEAD is a parameterized and keyed NORX instance, in the spirit of
 // crypto/cipher.AEAD.
 type AEAD struct {
-	key    []byte
-	rounds int
+	// lock protects the key against Reset, which takes the write lock,
+	// while all other operations take the read lock.
+	lock  sync.RWMutex
+	key   []byte
+	perm  *permutation
+	reset bool
+
+	nonceGuard *nonceGuard
+	lockedKey  *lockedBuffer
 }
 
 // NonceSize returns the size of the nonce that must be passed to Seal and
@@ -60,7 +72,9 @@ func (ae *AEAD) Overhead() int {
 // Seal encrypts and authenticates plaintext, authenticates the optional
 // header and footer (additional data) and, appends the result to dst,
 // returning the updated slice. The nonce must be NonceSize() bytes long and
-// unique for all time, for a given key.
+// unique for all time, for a given key (see EnableNonceGuard for a way to
+// detect violations during development).  Seal panics with ErrReset if the
+// instance has been Reset.
 //
 // The plaintext and dst must overlap exactly or not at all. To reuse
 // plaintext's storage for the encrypted output, use plaintext[:0] as dst.
@@ -68,7 +82,17 @@ func (ae *AEAD) Seal(dst, nonce, plaintext, header, footer []byte) []byte {
 	if len(nonce) != NonceSize {
 		panic(ErrInvalidNonceSize)
 	}
-	dst = aeadEncrypt(ae.rounds, dst, header, plaintext, footer, nonce, ae.key)
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		panic(ErrReset)
+	}
+	if ae.nonceGuard != nil {
+		ae.nonceGuard.check(nonce)
+	}
+	dst = aeadEncrypt(ae.perm, dst, header, plaintext, footer, nonce, ae.key)
 	return dst
 }
 
@@ -82,7 +106,7 @@ func (ae *AEAD) Seal(dst, nonce, plaintext, header, footer []byte) []byte {
 // ciphertext's storage for the decrypted output, use ciphertext[:0] as dst.
 //
 // Even if the function fails, the contents of dst, up to its capacity,
-// may be overwritten.
+// may be overwritten.  Open returns ErrReset if the instance has been Reset.
 func (ae *AEAD) Open(dst, nonce, ciphertext, header, footer []byte) ([]byte, error) {
 	var err error
 	var ok bool
@@ -90,16 +114,42 @@ func (ae *AEAD) Open(dst, nonce, ciphertext, header, footer []byte) ([]byte, err
 	if len(nonce) != NonceSize {
 		panic(ErrInvalidNonceSize)
 	}
-	dst, ok = aeadDecrypt(ae.rounds, dst, header, ciphertext, footer, nonce, ae.key)
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return dst, ErrReset
+	}
+	dst, ok = aeadDecrypt(ae.perm, dst, header, ciphertext, footer, nonce, ae.key)
 	if !ok {
 		err = ErrOpen
 	}
 	return dst, err
 }
 
-// Reset securely purges stored sensitive data from the AEAD instance.
+// Reset securely purges stored sensitive data from the AEAD instance,
+// including releasing any locked memory (see LockMemory).  All further
+// operations on the instance will fail with ErrReset.  Calling Reset more
+// than once, or concurrently with other operations, is safe.
 func (ae *AEAD) Reset() {
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	if ae.reset {
+		return
+	}
 	burnBytes(ae.key)
+	ae.unlockMemory()
+	ae.reset = true
+}
+
+// isReset returns true iff Reset has been called.
+func (ae *AEAD) isReset() bool {
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	return ae.reset
 }
 
 // ToRuntime converts an AEAD instance to a crypto/cipher.AEAD instance.
@@ -146,9 +196,18 @@ func newAEAD(key []byte, rounds int) *AEAD {
 	if len(key) != KeySize {
 		panic(ErrInvalidKeySize)
 	}
+	perm := permutationFor(rounds)
+	if perm == nil {
+		panic(ErrInvalidVariant)
+	}
 
-	return &AEAD{
-		key:    append([]byte{}, key...),
-		rounds: rounds,
+	ae := &AEAD{
+		key:  append([]byte{}, key...),
+		perm: perm,
 	}
+	if nonceGuardDefault {
+		ae.EnableNonceGuard(nil)
+	}
+
+	return ae
 }
@@ -0,0 +1,353 @@
+// batch.go - Multi-buffer interface
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// BatchOp is a single message to be processed by SealBatch or OpenBatch.
+type BatchOp struct {
+	// Dst is the slice that the output is appended to, and is replaced
+	// with the updated slice on completion, exactly as with the return
+	// value of Seal/Open.
+	Dst []byte
+
+	// Nonce is the nonce, which must be NonceSize() bytes long.
+	Nonce []byte
+
+	// Input is the plaintext for SealBatch, and the ciphertext for
+	// OpenBatch.
+	Input []byte
+
+	// Header and Footer are the optional additional data.
+	Header []byte
+	Footer []byte
+
+	// Err is set by OpenBatch to ErrOpen if authentication fails,
+	// ErrReset if the instance has been Reset, and nil otherwise.
+	Err error
+}
+
+// SealBatch encrypts and authenticates each of the ops, as if by Seal.  If
+// the hardware supports it (eg: AVX2), multiple independent messages will be
+// processed in an interleaved manner, which provides higher throughput than
+// calling Seal on each message in turn.
+//
+// The same restrictions as Seal apply to each op, and additionally the
+// Dst of each op must not overlap with any of the other ops.
+func (ae *AEAD) SealBatch(ops []BatchOp) {
+	for i := range ops {
+		if len(ops[i].Nonce) != NonceSize {
+			panic(ErrInvalidNonceSize)
+		}
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		panic(ErrReset)
+	}
+	if ae.nonceGuard != nil {
+		for i := range ops {
+			ae.nonceGuard.check(ops[i].Nonce)
+		}
+	}
+
+	if !isMultiBufferAccelerated() {
+		for i := range ops {
+			op := &ops[i]
+			op.Dst = aeadEncrypt(ae.perm, op.Dst, op.Header, op.Input, op.Footer, op.Nonce, ae.key)
+		}
+		return
+	}
+	processBatch(ae.perm, ae.key, ops, false)
+}
+
+// OpenBatch decrypts and authenticates each of the ops, as if by Open.  If
+// the hardware supports it (eg: AVX2), multiple independent messages will be
+// processed in an interleaved manner, which provides higher throughput than
+// calling Open on each message in turn.
+//
+// The same restrictions as Open apply to each op, and additionally the
+// Dst of each op must not overlap with any of the other ops.
+func (ae *AEAD) OpenBatch(ops []BatchOp) {
+	for i := range ops {
+		if len(ops[i].Nonce) != NonceSize {
+			panic(ErrInvalidNonceSize)
+		}
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		for i := range ops {
+			ops[i].Err = ErrReset
+		}
+		return
+	}
+
+	if !isMultiBufferAccelerated() {
+		for i := range ops {
+			op := &ops[i]
+
+			var ok bool
+			op.Dst, ok = aeadDecrypt(ae.perm, op.Dst, op.Header, op.Input, op.Footer, op.Nonce, ae.key)
+			op.Err = nil
+			if !ok {
+				op.Err = ErrOpen
+			}
+		}
+		return
+	}
+	processBatch(ae.perm, ae.key, ops, true)
+}
+
+// batchLanes is the number of messages that are processed concurrently.
+const batchLanes = 2
+
+// The steps that each lane goes through, in order.  Each step (other than
+// being done) consists of one or more permutations.
+const (
+	stepInit = iota
+	stepHeader
+	stepPayload
+	stepTrailer
+	stepFinal
+	stepFinal2
+)
+
+// batchLane is a single message being processed as part of a batch.  The
+// processing is split into the operations done before each permutation
+// (prePermute) and after each permutation (postPermute), so that the
+// permutations of multiple lanes can be done at once.
+type batchLane struct {
+	s   state
+	op  *BatchOp
+	key []byte
+
+	decrypt bool
+	in      []byte
+	out     []byte
+	tag     []byte
+	ret     []byte
+
+	step int
+	off  int
+}
+
+func (l *batchLane) start(op *BatchOp, p *permutation, key []byte, decrypt bool) bool {
+	*l = batchLane{
+		op:      op,
+		key:     key,
+		decrypt: decrypt,
+	}
+	l.s.perm = p
+
+	if decrypt {
+		cLen := len(op.Input)
+		if cLen < bytesT {
+			op.Dst, op.Err = nil, ErrOpen
+			return false
+		}
+		mLen := cLen - bytesT
+		l.ret, l.out = sliceForAppend(op.Dst, mLen)
+		l.in, l.tag = op.Input[:mLen], op.Input[mLen:]
+	} else {
+		mLen := len(op.Input)
+		l.ret, l.out = sliceForAppend(op.Dst, mLen+bytesT)
+		l.in, l.out, l.tag = op.Input, l.out[:mLen], l.out[mLen:]
+	}
+
+	// Small messages are faster to process in a single call via the fused
+	// routines (if any) than they are interleaved.
+	var tag [bytesT]byte
+	if decrypt && openSmall(p, l.out, op.Header, l.in, op.Footer, op.Nonce, key, tag[:]) {
+		l.finish(tag[:])
+		return false
+	} else if !decrypt && sealSmall(p, l.out[:len(l.in)+bytesT], op.Header, l.in, op.Footer, op.Nonce, key) {
+		op.Dst = l.ret
+		return false
+	}
+
+	return true
+}
+
+func (l *batchLane) data() []byte {
+	switch l.step {
+	case stepHeader:
+		return l.op.Header
+	case stepPayload:
+		return l.in
+	case stepTrailer:
+		return l.op.Footer
+	default:
+		return nil
+	}
+}
+
+// advance moves to the first step starting at step that requires
+// processing, skipping empty data.
+func (l *batchLane) advance(step int) {
+	l.off = 0
+	for l.step = step; l.step < stepFinal && len(l.data()) == 0; l.step++ {
+	}
+}
+
+func (l *batchLane) prePermute() {
+	switch l.step {
+	case stepInit:
+		loadStateRef(&l.s, l.key, l.op.Nonce)
+	case stepHeader:
+		l.s.s[15] ^= tagHeader
+	case stepPayload:
+		l.s.s[15] ^= tagPayload
+	case stepTrailer:
+		l.s.s[15] ^= tagTrailer
+	case stepFinal:
+		l.s.s[15] ^= tagFinal
+	}
+}
+
+// postPermute returns true iff the lane has completed processing.
+func (l *batchLane) postPermute() bool {
+	switch l.step {
+	case stepInit:
+		xorKeyRef(&l.s, l.key)
+		l.advance(stepHeader)
+	case stepHeader, stepTrailer:
+		in := l.data()[l.off:]
+		if len(in) >= bytesR {
+			absorbRateRef(&l.s, in[:bytesR])
+			l.off += bytesR
+			break
+		}
+
+		var lastBlock [bytesR]byte
+		padRef(&lastBlock, in)
+		absorbRateRef(&l.s, lastBlock[:])
+		l.advance(l.step + 1)
+	case stepPayload:
+		in, out := l.in[l.off:], l.out[l.off:]
+		if len(in) >= bytesR {
+			if l.decrypt {
+				decryptRateRef(&l.s, out[:bytesR], in[:bytesR])
+			} else {
+				encryptRateRef(&l.s, out[:bytesR], in[:bytesR])
+			}
+			l.off += bytesR
+			break
+		}
+
+		if l.decrypt {
+			decryptLastRateRef(&l.s, out, in)
+		} else {
+			var lastBlock [bytesR]byte
+			padRef(&lastBlock, in)
+			encryptRateRef(&l.s, lastBlock[:], lastBlock[:])
+			copy(out, lastBlock[:len(in)])
+		}
+		l.advance(stepTrailer)
+	case stepFinal:
+		xorKeyRef(&l.s, l.key)
+		l.step = stepFinal2
+	case stepFinal2:
+		var tag [bytesT]byte
+
+		xorKeyRef(&l.s, l.key)
+		for i := 0; i < 4; i++ {
+			binary.LittleEndian.PutUint64(tag[i*bytesW:], l.s.s[i+12])
+		}
+		burnUint64s(l.s.s[:])
+
+		l.finish(tag[:])
+		return true
+	}
+
+	return false
+}
+
+// finish completes the op, given the calculated tag.
+func (l *batchLane) finish(tag []byte) {
+	op := l.op
+	if !l.decrypt {
+		copy(l.tag, tag)
+		op.Dst = l.ret
+		return
+	}
+
+	op.Dst, op.Err = l.ret, nil
+	if subtle.ConstantTimeCompare(l.tag, tag) != 1 {
+		if len(l.out) > 0 { // burn decrypted plaintext on auth failure
+			burnBytes(l.out)
+			op.Dst = nil
+		}
+		op.Err = ErrOpen
+	}
+}
+
+func processBatch(p *permutation, key []byte, ops []BatchOp, decrypt bool) {
+	var lanes [batchLanes]batchLane
+	var active [batchLanes]bool
+	var next int
+
+	for {
+		// Refill any idle lanes with the next pending op(s).
+		nActive := 0
+		for i := range lanes {
+			for !active[i] && next < len(ops) {
+				active[i] = lanes[i].start(&ops[next], p, key, decrypt)
+				next++
+			}
+			if active[i] {
+				nActive++
+			}
+		}
+		if nActive == 0 {
+			return
+		}
+
+		// Process as much of the payload as possible in bulk, if both
+		// lanes are in the middle of the payload.
+		if nActive == batchLanes && lanes[0].step == stepPayload && lanes[1].step == stepPayload {
+			l0, l1 := &lanes[0], &lanes[1]
+			blocks := (len(l0.in) - l0.off) / bytesR
+			if b := (len(l1.in) - l1.off) / bytesR; b < blocks {
+				blocks = b
+			}
+			if blocks > 0 && cryptBlocksX2(&l0.s, &l1.s, l0.out[l0.off:], l0.in[l0.off:], l1.out[l1.off:], l1.in[l1.off:], blocks, decrypt) {
+				l0.off += blocks * bytesR
+				l1.off += blocks * bytesR
+				continue
+			}
+		}
+
+		for i := range lanes {
+			if active[i] {
+				lanes[i].prePermute()
+			}
+		}
+		if nActive == batchLanes {
+			permuteX2(&lanes[0].s, &lanes[1].s)
+		} else {
+			for i := range lanes {
+				if active[i] {
+					lanes[i].s.permute()
+				}
+			}
+		}
+		for i := range lanes {
+			if active[i] && lanes[i].postPermute() {
+				active[i] = false
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// batch_test.go - Multi-buffer tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	// The multi-buffer code is exercised directly (instead of via
+	// SealBatch/OpenBatch) so that it is tested on all hosts, even
+	// without hardware support.
+	forceDisableHardwareAcceleration()
+	doTestBatch(t)
+
+	if !canAccelerate {
+		t.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	forEachAcceleratedImpl(func() { doTestBatch(t) })
+}
+
+func doTestBatch(t *testing.T) {
+	testRounds := []int{4, 6}
+	impl := "_" + hardwareAccelImpl.name
+
+	for _, l := range testRounds {
+		n := fmt.Sprintf("NORX64-%d-1", l)
+		t.Run(n+impl, func(t *testing.T) { doTestBatchAEAD(t, l) })
+	}
+}
+
+func doTestBatchAEAD(t *testing.T, l int) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	aead := newTestAEAD(k[:], l)
+
+	// Deliberately use wildly different sizes, so that the lanes are
+	// frequently in different steps.
+	testSizes := []int{0, 1, 95, 96, 97, 300, 1000, 4096}
+	var ops []BatchOp
+	var expected [][]byte
+	for i, sz := range testSizes {
+		for j := range testSizes {
+			aLen, zLen := testSizes[(i+j)%len(testSizes)], testSizes[(i+2*j)%len(testSizes)]
+			op := BatchOp{
+				Nonce:  make([]byte, NonceSize),
+				Input:  make([]byte, sz),
+				Header: make([]byte, aLen),
+				Footer: make([]byte, zLen),
+			}
+			rand.Read(op.Nonce)
+			rand.Read(op.Input)
+			rand.Read(op.Header)
+			rand.Read(op.Footer)
+			ops = append(ops, op)
+			expected = append(expected, aead.Seal(nil, op.Nonce, op.Input, op.Header, op.Footer))
+		}
+	}
+
+	for _, decrypt := range []bool{false, true} {
+		opsCopy := append([]BatchOp{}, ops...)
+		processBatch(aead.perm, aead.key, opsCopy, decrypt)
+
+		if !decrypt {
+			for i := range opsCopy {
+				require.Equal(expected[i], opsCopy[i].Dst, "processBatch(seal): %d", i)
+			}
+
+			// Setup the ops for decryption.
+			for i := range ops {
+				ops[i].Dst, ops[i].Input = nil, expected[i]
+			}
+			continue
+		}
+
+		for i := range opsCopy {
+			require.NoError(opsCopy[i].Err, "processBatch(open): %d", i)
+			require.Len(opsCopy[i].Dst, len(expected[i])-TagSize, "processBatch(open): %d", i)
+		}
+	}
+
+	// Corrupt every other op.
+	for i := range ops {
+		ops[i].Dst = nil
+		if i&1 == 1 {
+			ops[i].Input = append([]byte{}, ops[i].Input...)
+			ops[i].Input[0] ^= 0xa5
+		}
+	}
+	processBatch(aead.perm, aead.key, ops, true)
+	for i := range ops {
+		if i&1 == 1 {
+			require.Equal(ErrOpen, ops[i].Err, "processBatch(open, corrupted): %d", i)
+		} else {
+			require.NoError(ops[i].Err, "processBatch(open): %d", i)
+		}
+	}
+
+	// Ensure that the public interface also works.
+	pubOps := []BatchOp{
+		{Nonce: ops[0].Nonce, Input: []byte("batch message 0"), Header: []byte("header")},
+		{Nonce: ops[1].Nonce, Input: []byte("batch message 1"), Footer: []byte("footer")},
+		{Nonce: ops[2].Nonce, Input: make([]byte, 1024)},
+	}
+	aead.SealBatch(pubOps)
+	for i := range pubOps {
+		pubOps[i].Input, pubOps[i].Dst = pubOps[i].Dst, nil
+	}
+	pubOps = append(pubOps, BatchOp{Nonce: ops[3].Nonce, Input: make([]byte, TagSize-1)})
+	aead.OpenBatch(pubOps)
+	require.NoError(pubOps[0].Err, "OpenBatch(): 0")
+	require.Equal([]byte("batch message 0"), pubOps[0].Dst, "OpenBatch(): 0")
+	require.NoError(pubOps[1].Err, "OpenBatch(): 1")
+	require.Equal([]byte("batch message 1"), pubOps[1].Dst, "OpenBatch(): 1")
+	require.NoError(pubOps[2].Err, "OpenBatch(): 2")
+	require.Equal(make([]byte, 1024), pubOps[2].Dst, "OpenBatch(): 2")
+	require.Equal(ErrOpen, pubOps[3].Err, "OpenBatch(truncated)")
+	require.Nil(pubOps[3].Dst, "OpenBatch(truncated)")
+}
+
+func BenchmarkBatch(b *testing.B) {
+	if !canAccelerate {
+		b.Skip("Hardware acceleration not supported on this host.")
+	}
+	mustInitHardwareAcceleration()
+
+	const batchSize = 16
+	benchSizes := []int{64, 576, 1536, 4096}
+
+	for _, sz := range benchSizes {
+		sn := fmt.Sprintf("_%d", sz)
+		b.Run(hardwareAccelImpl.name+"_Sequential"+sn, func(b *testing.B) { doBenchmarkBatch(b, batchSize, sz, false) })
+		b.Run(hardwareAccelImpl.name+"_Batch"+sn, func(b *testing.B) { doBenchmarkBatch(b, batchSize, sz, true) })
+	}
+}
+
+func doBenchmarkBatch(b *testing.B, n, sz int, batch bool) {
+	b.StopTimer()
+	b.SetBytes(int64(n * sz))
+
+	var k [KeySize]byte
+	rand.Read(k[:])
+	aead := newTestAEAD(k[:], 4)
+
+	ops := make([]BatchOp, n)
+	for i := range ops {
+		ops[i].Nonce = make([]byte, NonceSize)
+		ops[i].Input = make([]byte, sz)
+		ops[i].Dst = make([]byte, 0, sz+TagSize)
+		rand.Read(ops[i].Nonce)
+		rand.Read(ops[i].Input)
+	}
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range ops {
+			ops[j].Dst = ops[j].Dst[:0]
+		}
+		if batch {
+			aead.SealBatch(ops)
+		} else {
+			for j := range ops {
+				op := &ops[j]
+				op.Dst = aead.Seal(op.Dst, op.Nonce, op.Input, nil, nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,834 @@
+// blockstore.go - Random access encrypted block store
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+const (
+	// BlockStoreVersion is the block store format version.
+	BlockStoreVersion = 1
+
+	// BlockStoreHeaderSize is the size of the block store header.
+	BlockStoreHeaderSize = blockStoreFixedSize + 8 + TagSize + TagSize
+
+	// DefaultSectorSize is the default block store sector size.
+	DefaultSectorSize = 4096
+
+	// MaxSectorSize is the maximum block store sector size.
+	MaxSectorSize = 1024 * 1024
+
+	blockStoreMagic        = "NORXBLK\x00"
+	blockStoreFixedSize    = len(blockStoreMagic) + 1 + 1 + 4 + 8 + NonceSize
+	blockStoreEntrySize    = 8 + 8 + TagSize
+	blockStoreChunkEntries = 32
+	blockStoreChunkSize    = blockStoreChunkEntries * blockStoreEntrySize
+	blockStoreMaxNodes     = 1 << 16
+	blockStoreBuildWindow  = 256
+
+	blockStoreKeyLabel    = "norx: block store key"
+	blockStoreTreeLabel   = "norx: block store tree key"
+	blockStoreLeafLabel   = "norx: block store leaf"
+	blockStoreNodeLabel   = "norx: block store node"
+	blockStoreHeaderLabel = "norx: block store header"
+)
+
+var (
+	// ErrInvalidBlockStore is the error returned when a block store is
+	// malformed, truncated, or is of a different variant.
+	ErrInvalidBlockStore = errors.New("norx: invalid block store")
+
+	// ErrUnsupportedBlockStoreVersion is the error returned when a block
+	// store has an unknown format version.
+	ErrUnsupportedBlockStoreVersion = errors.New("norx: unsupported block store version")
+
+	// ErrInvalidSectorSize is the error returned when a sector size is out
+	// of range.
+	ErrInvalidSectorSize = errors.New("norx: invalid sector size")
+
+	// ErrBlockStoreRollback is the error returned when recovering a block
+	// store that is older than the expected generation.
+	ErrBlockStoreRollback = errors.New("norx: block store rolled back")
+
+	// ErrBlockStoreOutOfRange is the error returned when writing past the
+	// end of a block store.
+	ErrBlockStoreOutOfRange = errors.New("norx: block store write out of range")
+
+	// ErrBlockStoreClosed is the error returned when accessing a closed
+	// block store.
+	ErrBlockStoreClosed = errors.New("norx: block store closed")
+)
+
+// BlockStoreConfig is the configuration for a new block store.
+type BlockStoreConfig struct {
+	// SectorSize is the size of each sector in bytes, with 0 meaning
+	// DefaultSectorSize.
+	SectorSize int
+
+	// SectorCount is the number of sectors.
+	SectorCount uint64
+}
+
+// BlockStore is an encrypted, sector addressed block image, backed by an
+// os.File, that supports random reads and writes.
+//
+// Each sector is sealed independently, under a per-image subkey derived
+// from the key and the image nonce, with the generation, sector number, and
+// a per-sector write counter as the nonce, and the generations, counters
+// and tags kept in a metadata area.  The metadata area is split into chunks
+// of 32 entries, that are authenticated by a keyed Merkle tree, the root of
+// which is kept in the header, and authenticated along with the rest of the
+// header.  Sync only updates the chunks written to since the previous Sync,
+// and the tree nodes above them, so rolling back an individual sector
+// (along with its metadata) is detected when the sector is read.  Rolling
+// back the entire image can only be detected by the caller, by keeping
+// track of the Generation.
+//
+// The file layout is:
+//
+//	magic       [8]byte // "NORXBLK\x00"
+//	version     uint8   // BlockStoreVersion
+//	variant     uint8   // Variant
+//	sectorSize  uint32  // Big endian
+//	sectorCount uint64  // Big endian
+//	nonce       [NonceSize]byte
+//	generation  uint64  // Big endian
+//	root        [TagSize]byte
+//	mac         [TagSize]byte
+//	metadata    [chunkCount][32]struct {
+//		generation uint64 // Big endian
+//		counter    uint64 // Big endian, 0 if never written.
+//		tag        [TagSize]byte
+//	}
+//	tree        [2*leafCount-2][TagSize]byte // Sans root, heap ordered.
+//	padding     []byte  // To a multiple of sectorSize.
+//	sectors     [sectorCount][sectorSize]byte
+//
+// where leafCount is chunkCount rounded up to a power of 2.
+//
+// Sectors that have never been written read as zeros.  Writes are not
+// verifiable until the next Sync, and reading a chunk that was written to
+// without a subsequent Sync will fail with ErrOpen, until the image is
+// repaired with RecoverBlockStore.  Only the metadata chunks written to
+// since the previous Sync, and a bounded number of authenticated tree
+// nodes, are held in memory.
+//
+// All methods are safe for concurrent use.
+type BlockStore struct {
+	lock sync.Mutex
+
+	aead        *AEAD
+	f           *os.File
+	hdr         []byte
+	sectorSize  int
+	sectorCount uint64
+	chunkCount  uint64
+	leafCount   uint64
+	treeOff     int64
+	dataOff     int64
+	generation  uint64
+	stale       bool
+	closed      bool
+
+	keys blockStoreKeys
+
+	nodes map[uint64][TagSize]byte
+	dirty map[uint64][]byte
+}
+
+// blockStoreKeys are the per-image subkeys.
+type blockStoreKeys struct {
+	sector [KeySize]byte
+	tree   [KeySize]byte
+}
+
+func (k *blockStoreKeys) burn() {
+	burnBytes(k.sector[:])
+	burnBytes(k.tree[:])
+}
+
+// CreateBlockStore initializes a new block store in f, which is truncated.
+func (ae *AEAD) CreateBlockStore(f *os.File, cfg *BlockStoreConfig) (*BlockStore, error) {
+	if cfg == nil {
+		return nil, ErrInvalidBlockStore
+	}
+	sectorSize := DefaultSectorSize
+	if cfg.SectorSize != 0 {
+		sectorSize = cfg.SectorSize
+	}
+	if sectorSize < 0 || sectorSize > MaxSectorSize {
+		return nil, ErrInvalidSectorSize
+	}
+
+	hdr := make([]byte, BlockStoreHeaderSize)
+	copy(hdr, blockStoreMagic)
+	off := len(blockStoreMagic)
+	hdr[off], hdr[off+1] = BlockStoreVersion, byte(ae.Variant())
+	binary.BigEndian.PutUint32(hdr[off+2:], uint32(sectorSize))
+	binary.BigEndian.PutUint64(hdr[off+6:], cfg.SectorCount)
+	if _, err := io.ReadFull(rand.Reader, hdr[off+14:blockStoreFixedSize]); err != nil {
+		return nil, err
+	}
+
+	b, err := newBlockStore(ae, f, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Truncate(0); err != nil {
+		return nil, err
+	}
+	if err = f.Truncate(b.dataOff + int64(b.sectorCount)*int64(b.sectorSize)); err != nil {
+		return nil, err
+	}
+
+	if err = b.deriveKeys(); err != nil {
+		return nil, err
+	}
+	if err = b.rebuild(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	if err = b.commit(); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// OpenBlockStore opens an existing block store in f, and authenticates the
+// header.  The metadata is authenticated as it is accessed.
+func (ae *AEAD) OpenBlockStore(f *os.File) (*BlockStore, error) {
+	hdr := make([]byte, BlockStoreHeaderSize)
+	if _, err := f.ReadAt(hdr, 0); err != nil {
+		if err == io.EOF {
+			err = ErrInvalidBlockStore
+		}
+		return nil, err
+	}
+	off := len(blockStoreMagic)
+	if string(hdr[:off]) != blockStoreMagic {
+		return nil, ErrInvalidBlockStore
+	}
+	if hdr[off] != BlockStoreVersion {
+		return nil, ErrUnsupportedBlockStoreVersion
+	}
+	if hdr[off+1] != byte(ae.Variant()) {
+		return nil, ErrInvalidBlockStore
+	}
+
+	b, err := newBlockStore(ae, f, hdr)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < b.dataOff+int64(b.sectorCount)*int64(b.sectorSize) {
+		return nil, ErrInvalidBlockStore
+	}
+
+	if err = b.deriveKeys(); err != nil {
+		return nil, err
+	}
+
+	var mac [TagSize]byte
+	b.headerMAC(mac[:])
+	if subtle.ConstantTimeCompare(mac[:], hdr[blockStoreFixedSize+8+TagSize:]) != 1 {
+		b.Close()
+		return nil, ErrOpen
+	}
+
+	var root [TagSize]byte
+	copy(root[:], hdr[blockStoreFixedSize+8:])
+	b.generation = binary.BigEndian.Uint64(hdr[blockStoreFixedSize:])
+	b.nodes[1] = root
+
+	// Writes may have been made under the current generation, without a
+	// subsequent Sync, so the next write must advance it.
+	b.stale = true
+
+	return b, nil
+}
+
+// RecoverBlockStore opens an existing block store in f, that was not
+// synced after being written to, for example due to a crash.  The header
+// must authenticate and be of at least minGeneration, otherwise
+// ErrBlockStoreRollback is returned.  Every sector is checked against its
+// metadata entry, the sectors that fail to authenticate (typically the
+// ones being written at the time of the crash) are reset to read as zeros
+// and returned, and the tree is rebuilt and synced.
+//
+// Since the tree is rebuilt from the metadata, the rollback of individual
+// sectors to a state since the previous Sync can not be detected, so this
+// should only be used when OpenBlockStore, or a read fails after a crash.
+func (ae *AEAD) RecoverBlockStore(f *os.File, minGeneration uint64) (*BlockStore, []uint64, error) {
+	b, err := ae.OpenBlockStore(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.generation < minGeneration {
+		b.Close()
+		return nil, nil, ErrBlockStoreRollback
+	}
+
+	lost, err := b.recover()
+	if err == nil {
+		err = b.rebuild()
+	}
+	if err == nil {
+		err = b.commit()
+	}
+	if err != nil {
+		b.Close()
+		return nil, nil, err
+	}
+
+	return b, lost, nil
+}
+
+func newBlockStore(ae *AEAD, f *os.File, hdr []byte) (*BlockStore, error) {
+	off := len(blockStoreMagic)
+	b := &BlockStore{
+		aead:        ae,
+		f:           f,
+		hdr:         hdr,
+		sectorSize:  int(binary.BigEndian.Uint32(hdr[off+2:])),
+		sectorCount: binary.BigEndian.Uint64(hdr[off+6:]),
+		nodes:       make(map[uint64][TagSize]byte),
+		dirty:       make(map[uint64][]byte),
+	}
+	if b.sectorSize <= 0 || b.sectorSize > MaxSectorSize {
+		return nil, ErrInvalidSectorSize
+	}
+
+	// Reject images that would overflow the file size.  The metadata and
+	// tree are well under TagSize+blockStoreEntrySize bytes per sector.
+	maxSectors := (math.MaxInt64 / 2) / int64(blockStoreEntrySize+TagSize+b.sectorSize)
+	if b.sectorCount > uint64(maxSectors) {
+		return nil, ErrInvalidBlockStore
+	}
+
+	b.chunkCount = (b.sectorCount + blockStoreChunkEntries - 1) / blockStoreChunkEntries
+	if b.chunkCount == 0 {
+		b.chunkCount = 1
+	}
+	b.leafCount = 1
+	for b.leafCount < b.chunkCount {
+		b.leafCount <<= 1
+	}
+
+	b.treeOff = int64(BlockStoreHeaderSize) + int64(b.chunkCount)*int64(blockStoreChunkSize)
+	b.dataOff = b.treeOff + int64(2*b.leafCount-2)*int64(TagSize)
+	if rem := b.dataOff % int64(b.sectorSize); rem != 0 {
+		b.dataOff += int64(b.sectorSize) - rem
+	}
+
+	return b, nil
+}
+
+// SectorSize returns the size of each sector.
+func (b *BlockStore) SectorSize() int {
+	return b.sectorSize
+}
+
+// Size returns the size of the block image.
+func (b *BlockStore) Size() int64 {
+	return int64(b.sectorCount) * int64(b.sectorSize)
+}
+
+// Generation returns the number of times the header has been updated, by
+// Sync, the first write after opening, or RecoverBlockStore, which may be
+// used to detect rollback of the entire image.
+func (b *BlockStore) Generation() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.generation
+}
+
+// Close burns the per-image subkeys, after which all further operations
+// fail with ErrBlockStoreClosed.  Writes made since the previous Sync are
+// not synced, and the underlying os.File is not closed.
+func (b *BlockStore) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.closed {
+		b.keys.burn()
+		b.closed = true
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes from the block image starting at offset off.
+// Any sector or metadata that fails to authenticate results in ErrOpen.
+func (b *BlockStore) ReadAt(p []byte, off int64) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.rw(p, off, false)
+}
+
+// WriteAt writes len(p) bytes to the block image starting at offset off.
+// Partial sector writes require the existing sector to authenticate.
+func (b *BlockStore) WriteAt(p []byte, off int64) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.rw(p, off, true)
+}
+
+// Sync writes the metadata chunks written to since the previous Sync,
+// updates the tree, generation and header, and commits the image to stable
+// storage.
+func (b *BlockStore) Sync() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.usable(); err != nil {
+		return err
+	}
+
+	// Update the dirty leaves, and then each level of the tree above them.
+	// The siblings of every dirty node were authenticated when the chunk
+	// was first accessed, and are retained until now.
+	level := make(map[uint64]bool)
+	for c, chunk := range b.dirty {
+		if _, err := b.f.WriteAt(chunk, b.chunkOff(c)); err != nil {
+			return err
+		}
+		var v [TagSize]byte
+		b.hashLeaf(v[:], c, chunk)
+		b.nodes[b.leafCount+c] = v
+		level[b.leafCount+c] = true
+	}
+	for len(level) > 0 {
+		parents := make(map[uint64]bool)
+		for i := range level {
+			if i == 1 {
+				continue
+			}
+			v := b.nodes[i]
+			if _, err := b.f.WriteAt(v[:], b.nodeOff(i)); err != nil {
+				return err
+			}
+			parents[i/2] = true
+		}
+		for i := range parents {
+			var v [TagSize]byte
+			l, r := b.nodes[2*i], b.nodes[2*i+1]
+			b.hashNode(v[:], i, l[:], r[:])
+			b.nodes[i] = v
+		}
+		level = parents
+	}
+
+	if err := b.commit(); err != nil {
+		return err
+	}
+	b.dirty = make(map[uint64][]byte)
+	b.nodes = map[uint64][TagSize]byte{1: b.nodes[1]}
+
+	return nil
+}
+
+func (b *BlockStore) rw(p []byte, off int64, write bool) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	if err := b.usable(); err != nil {
+		return 0, err
+	}
+	defer b.prune()
+
+	if write && b.stale && len(p) > 0 {
+		if err := b.commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	buf := make([]byte, b.sectorSize+TagSize)
+	defer burnBytes(buf)
+	for n < len(p) {
+		if off >= b.Size() {
+			if write {
+				return n, ErrBlockStoreOutOfRange
+			}
+			return n, io.EOF
+		}
+
+		sector := uint64(off / int64(b.sectorSize))
+		sectorOff := int(off % int64(b.sectorSize))
+		l := b.sectorSize - sectorOff
+		if l > len(p)-n {
+			l = len(p) - n
+		}
+
+		entry, err := b.entry(sector, write)
+		if err != nil {
+			return n, err
+		}
+		pt := buf[:b.sectorSize]
+		if !write || l != b.sectorSize {
+			if err = b.readSector(pt, sector, entry); err != nil {
+				return n, err
+			}
+		}
+		if write {
+			copy(pt[sectorOff:], p[n:n+l])
+			if err = b.writeSector(buf, sector, entry); err != nil {
+				return n, err
+			}
+		} else {
+			copy(p[n:n+l], pt[sectorOff:])
+		}
+		n, off = n+l, off+int64(l)
+	}
+
+	return n, nil
+}
+
+// entry returns the metadata entry for a sector, marking the chunk dirty
+// if it is to be written.
+func (b *BlockStore) entry(sector uint64, write bool) ([]byte, error) {
+	c := sector / blockStoreChunkEntries
+	chunk, err := b.chunk(c)
+	if err != nil {
+		return nil, err
+	}
+	if write {
+		b.dirty[c] = chunk
+	}
+	return chunk[(sector%blockStoreChunkEntries)*blockStoreEntrySize:][:blockStoreEntrySize], nil
+}
+
+// chunk returns a metadata chunk, authenticating it against the tree, by
+// walking up from the leaf until reaching an authenticated node, which at
+// worst is the root.  The nodes along the way, and their siblings, are then
+// authenticated as well.
+func (b *BlockStore) chunk(c uint64) ([]byte, error) {
+	if chunk, ok := b.dirty[c]; ok {
+		return chunk, nil
+	}
+
+	chunk := make([]byte, blockStoreChunkSize)
+	if _, err := b.f.ReadAt(chunk, b.chunkOff(c)); err != nil {
+		return nil, err
+	}
+
+	var v [TagSize]byte
+	b.hashLeaf(v[:], c, chunk)
+	path := make(map[uint64][TagSize]byte)
+	for i := b.leafCount + c; ; i /= 2 {
+		if expected, ok := b.nodes[i]; ok {
+			if subtle.ConstantTimeCompare(v[:], expected[:]) != 1 {
+				return nil, ErrOpen
+			}
+			break
+		}
+
+		sib, ok := b.nodes[i^1]
+		if !ok {
+			if _, err := b.f.ReadAt(sib[:], b.nodeOff(i^1)); err != nil {
+				return nil, err
+			}
+		}
+		path[i], path[i^1] = v, sib
+		l, r := path[i&^1], path[i|1]
+		b.hashNode(v[:], i/2, l[:], r[:])
+	}
+	for i, v := range path {
+		b.nodes[i] = v
+	}
+
+	return chunk, nil
+}
+
+// prune discards the authenticated tree nodes that are not required to
+// Sync the dirty chunks, once there are more than blockStoreMaxNodes.
+func (b *BlockStore) prune() {
+	if len(b.nodes) <= blockStoreMaxNodes {
+		return
+	}
+
+	nodes := map[uint64][TagSize]byte{1: b.nodes[1]}
+	for c := range b.dirty {
+		for i := b.leafCount + c; i > 1; i /= 2 {
+			nodes[i], nodes[i^1] = b.nodes[i], b.nodes[i^1]
+		}
+	}
+	b.nodes = nodes
+}
+
+func (b *BlockStore) readSector(pt []byte, sector uint64, entry []byte) error {
+	ctr := binary.BigEndian.Uint64(entry[8:])
+	if ctr == 0 {
+		for i := range pt {
+			pt[i] = 0
+		}
+		return nil
+	}
+
+	ct := pt[:b.sectorSize+TagSize]
+	if _, err := b.f.ReadAt(ct[:b.sectorSize], b.sectorOff(sector)); err != nil {
+		return err
+	}
+	copy(ct[b.sectorSize:], entry[16:])
+
+	var nonce [NonceSize]byte
+	var ad [blockStoreFixedSize + 8]byte
+	b.sectorNonce(nonce[:], ad[:], sector, binary.BigEndian.Uint64(entry), ctr)
+	if _, ok := aeadDecrypt(b.aead.perm, ct[:0], ad[:], ct, nil, nonce[:], b.keys.sector[:]); !ok {
+		return ErrOpen
+	}
+	return nil
+}
+
+func (b *BlockStore) writeSector(buf []byte, sector uint64, entry []byte) error {
+	ctr := binary.BigEndian.Uint64(entry[8:]) + 1
+	if ctr == 0 {
+		return ErrInvalidBlockStore
+	}
+
+	var nonce [NonceSize]byte
+	var ad [blockStoreFixedSize + 8]byte
+	b.sectorNonce(nonce[:], ad[:], sector, b.generation, ctr)
+	ct := aeadEncrypt(b.aead.perm, buf[:0], ad[:], buf[:b.sectorSize], nil, nonce[:], b.keys.sector[:])
+
+	if _, err := b.f.WriteAt(ct[:b.sectorSize], b.sectorOff(sector)); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(entry, b.generation)
+	binary.BigEndian.PutUint64(entry[8:], ctr)
+	copy(entry[16:], ct[b.sectorSize:])
+
+	// The entry is written immediately (and again by Sync), so that
+	// RecoverBlockStore can recover writes that were never synced.
+	off := b.chunkOff(sector/blockStoreChunkEntries) + int64(sector%blockStoreChunkEntries)*int64(blockStoreEntrySize)
+	_, err := b.f.WriteAt(entry, off)
+	return err
+}
+
+// recover resets the metadata entries of the sectors that fail to
+// authenticate, and returns them.
+func (b *BlockStore) recover() ([]uint64, error) {
+	var lost []uint64
+	chunk := make([]byte, blockStoreChunkSize)
+	buf := make([]byte, b.sectorSize+TagSize)
+	defer burnBytes(buf)
+	for c := uint64(0); c < b.chunkCount; c++ {
+		if _, err := b.f.ReadAt(chunk, b.chunkOff(c)); err != nil {
+			return nil, err
+		}
+
+		var modified bool
+		for j := uint64(0); j < blockStoreChunkEntries; j++ {
+			sector := c*blockStoreChunkEntries + j
+			entry := chunk[j*blockStoreEntrySize:][:blockStoreEntrySize]
+			if sector < b.sectorCount {
+				err := b.readSector(buf, sector, entry)
+				if err == nil {
+					continue
+				} else if err != ErrOpen {
+					return nil, err
+				}
+				lost = append(lost, sector)
+			}
+			for i := range entry {
+				if entry[i] != 0 {
+					entry[i], modified = 0, true
+				}
+			}
+		}
+		if modified {
+			if _, err := b.f.WriteAt(chunk, b.chunkOff(c)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return lost, nil
+}
+
+// rebuild recomputes the entire tree from the metadata chunks, a level at a
+// time, starting from the leaves.
+func (b *BlockStore) rebuild() error {
+	buf := make([]byte, blockStoreBuildWindow*blockStoreChunkSize)
+	out := make([]byte, blockStoreBuildWindow*TagSize)
+	for m := b.leafCount; m > 0; m /= 2 {
+		for start := m; start < 2*m; start += blockStoreBuildWindow {
+			n := 2*m - start
+			if n > blockStoreBuildWindow {
+				n = blockStoreBuildWindow
+			}
+			vals := out[:n*TagSize]
+
+			if m == b.leafCount {
+				// The leaves past the final chunk are all zeros.
+				c := start - m
+				var nc uint64
+				if c < b.chunkCount {
+					nc = b.chunkCount - c
+					if nc > n {
+						nc = n
+					}
+				}
+				if _, err := b.f.ReadAt(buf[:nc*blockStoreChunkSize], b.chunkOff(c)); err != nil && nc > 0 {
+					return err
+				}
+				for k := uint64(0); k < n; k++ {
+					v := vals[k*TagSize:][:TagSize]
+					if k < nc {
+						b.hashLeaf(v, c+k, buf[k*blockStoreChunkSize:][:blockStoreChunkSize])
+					} else {
+						for i := range v {
+							v[i] = 0
+						}
+					}
+				}
+			} else {
+				children := buf[:2*n*TagSize]
+				if _, err := b.f.ReadAt(children, b.nodeOff(2*start)); err != nil {
+					return err
+				}
+				for k := uint64(0); k < n; k++ {
+					l := children[2*k*TagSize:][:TagSize]
+					r := children[(2*k+1)*TagSize:][:TagSize]
+					b.hashNode(vals[k*TagSize:][:TagSize], start+k, l, r)
+				}
+			}
+
+			if m == 1 {
+				var root [TagSize]byte
+				copy(root[:], vals)
+				b.nodes = map[uint64][TagSize]byte{1: root}
+			} else if _, err := b.f.WriteAt(vals, b.nodeOff(start)); err != nil {
+				return err
+			}
+		}
+	}
+	b.dirty = make(map[uint64][]byte)
+
+	return nil
+}
+
+// commit advances the generation, and writes the header with the current
+// root, once everything it covers is on stable storage.
+func (b *BlockStore) commit() error {
+	if err := b.f.Sync(); err != nil {
+		return err
+	}
+
+	// Writes must not be made under the new generation until the header
+	// is on stable storage.
+	b.stale = true
+	b.generation++
+	root := b.nodes[1]
+	binary.BigEndian.PutUint64(b.hdr[blockStoreFixedSize:], b.generation)
+	copy(b.hdr[blockStoreFixedSize+8:], root[:])
+	b.headerMAC(b.hdr[blockStoreFixedSize+8+TagSize:])
+	if _, err := b.f.WriteAt(b.hdr, 0); err != nil {
+		return err
+	}
+	if err := b.f.Sync(); err != nil {
+		return err
+	}
+	b.stale = false
+
+	return nil
+}
+
+// deriveKeys derives the per-image subkeys from the key and image nonce.
+func (b *BlockStore) deriveKeys() error {
+	nonce := b.hdr[blockStoreFixedSize-NonceSize : blockStoreFixedSize]
+
+	b.aead.lock.RLock()
+	defer b.aead.lock.RUnlock()
+
+	if b.aead.reset {
+		return ErrReset
+	}
+	deriveKey(b.aead.perm, b.keys.sector[:], b.aead.key, blockStoreKeyLabel, nonce)
+	deriveKey(b.aead.perm, b.keys.tree[:], b.aead.key, blockStoreTreeLabel, nonce)
+	return nil
+}
+
+// usable returns the error for operating on a closed block store, or one
+// whose AEAD has been reset.
+func (b *BlockStore) usable() error {
+	if b.closed {
+		return ErrBlockStoreClosed
+	}
+
+	b.aead.lock.RLock()
+	defer b.aead.lock.RUnlock()
+
+	if b.aead.reset {
+		return ErrReset
+	}
+	return nil
+}
+
+// hashLeaf computes the tree leaf for a metadata chunk.
+func (b *BlockStore) hashLeaf(out []byte, c uint64, chunk []byte) {
+	var in [8 + blockStoreChunkSize]byte
+	binary.BigEndian.PutUint64(in[:], c)
+	copy(in[8:], chunk)
+	deriveKey(b.aead.perm, out, b.keys.tree[:], blockStoreLeafLabel, in[:])
+}
+
+// hashNode computes the tree node i from its children.
+func (b *BlockStore) hashNode(out []byte, i uint64, l, r []byte) {
+	var in [8 + 2*TagSize]byte
+	binary.BigEndian.PutUint64(in[:], i)
+	copy(in[8:], l)
+	copy(in[8+TagSize:], r)
+	deriveKey(b.aead.perm, out, b.keys.tree[:], blockStoreNodeLabel, in[:])
+}
+
+// headerMAC computes the header MAC over the rest of the header.
+func (b *BlockStore) headerMAC(out []byte) {
+	deriveKey(b.aead.perm, out, b.keys.tree[:], blockStoreHeaderLabel, b.hdr[:blockStoreFixedSize+8+TagSize])
+}
+
+// sectorNonce sets the nonce for a sector write, under the per-image
+// subkey, to the big endian generation, sector number, and counter (left
+// padded with zeros), and the additional data, which is the fixed portion
+// of the header followed by the big endian sector number.
+func (b *BlockStore) sectorNonce(nonce, ad []byte, sector, gen, ctr uint64) {
+	binary.BigEndian.PutUint64(nonce[NonceSize-24:], gen)
+	binary.BigEndian.PutUint64(nonce[NonceSize-16:], sector)
+	binary.BigEndian.PutUint64(nonce[NonceSize-8:], ctr)
+
+	copy(ad, b.hdr[:blockStoreFixedSize])
+	binary.BigEndian.PutUint64(ad[blockStoreFixedSize:], sector)
+}
+
+func (b *BlockStore) chunkOff(c uint64) int64 {
+	return int64(BlockStoreHeaderSize) + int64(c)*int64(blockStoreChunkSize)
+}
+
+func (b *BlockStore) nodeOff(i uint64) int64 {
+	return b.treeOff + int64(i-2)*int64(TagSize)
+}
+
+func (b *BlockStore) sectorOff(sector uint64) int64 {
+	return b.dataOff + int64(sector)*int64(b.sectorSize)
+}
@@ -0,0 +1,207 @@
+// blockstore_test.go - Random access encrypted block store tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockStore(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	aead := newTestAEAD(k[:], 4)
+
+	f, err := ioutil.TempFile("", "norx-blockstore")
+	require.NoError(err, "TempFile()")
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	const sectorSize, sectorCount = 512, 80
+	b, err := aead.CreateBlockStore(f, &BlockStoreConfig{
+		SectorSize:  sectorSize,
+		SectorCount: sectorCount,
+	})
+	require.NoError(err, "CreateBlockStore()")
+	require.Equal(int64(sectorSize*sectorCount), b.Size(), "Size()")
+	require.Equal(uint64(1), b.Generation(), "Generation()")
+	require.Equal(uint64(3), b.chunkCount, "chunkCount")
+	require.Equal(uint64(4), b.leafCount, "leafCount")
+
+	// Unwritten sectors read as zeros.
+	expected := make([]byte, b.Size())
+	buf := make([]byte, b.Size())
+	n, err := b.ReadAt(buf, 0)
+	require.NoError(err, "ReadAt(): Unwritten")
+	require.Equal(len(buf), n, "ReadAt(): Unwritten")
+	require.Equal(expected, buf, "ReadAt(): Unwritten")
+
+	// Full, partial, and sector (and chunk) spanning writes.
+	for _, w := range [][2]int{{0, sectorSize}, {3 * sectorSize, 2 * sectorSize}, {100, 10}, {sectorSize - 5, 700}, {1000, 3000}, {31*sectorSize + 1, 2 * sectorSize}, {70 * sectorSize, 10}} {
+		off, l := w[0], w[1]
+		_, err = rand.Read(expected[off : off+l])
+		require.NoError(err, "rand.Read()")
+		n, err = b.WriteAt(expected[off:off+l], int64(off))
+		require.NoError(err, "WriteAt(%d, %d)", off, l)
+		require.Equal(l, n, "WriteAt(%d, %d)", off, l)
+
+		n, err = b.ReadAt(buf, 0)
+		require.NoError(err, "ReadAt(): After WriteAt(%d, %d)", off, l)
+		require.Equal(expected, buf, "ReadAt(): After WriteAt(%d, %d)", off, l)
+	}
+
+	n, err = b.ReadAt(buf[:10], b.Size()-5)
+	require.Equal(io.EOF, err, "ReadAt(): Past end")
+	require.Equal(5, n, "ReadAt(): Past end")
+	_, err = b.WriteAt(buf[:10], b.Size()-5)
+	require.Equal(ErrBlockStoreOutOfRange, err, "WriteAt(): Past end")
+
+	require.NoError(b.Sync(), "Sync()")
+	require.Equal(uint64(2), b.Generation(), "Generation(): Sync")
+	require.Len(b.dirty, 0, "Sync(): Dirty")
+	require.Len(b.nodes, 1, "Sync(): Nodes")
+
+	// Reopen.
+	b, err = aead.OpenBlockStore(f)
+	require.NoError(err, "OpenBlockStore()")
+	require.Equal(uint64(2), b.Generation(), "Generation(): Reopened")
+	_, err = b.ReadAt(buf, 0)
+	require.NoError(err, "ReadAt(): Reopened")
+	require.Equal(expected, buf, "ReadAt(): Reopened")
+
+	_, err = newTestAEAD(k[:], 6).OpenBlockStore(f)
+	require.Equal(ErrInvalidBlockStore, err, "OpenBlockStore(): Variant")
+	var k2 [KeySize]byte
+	_, err = newTestAEAD(k2[:], 4).OpenBlockStore(f)
+	require.Equal(ErrOpen, err, "OpenBlockStore(): Wrong key")
+
+	// Sync only touches the dirty chunks.
+	_, err = b.WriteAt(expected[:sectorSize], 0)
+	require.NoError(err, "WriteAt(): Rewrite")
+	require.Equal(uint64(3), b.Generation(), "Generation(): First write")
+	require.Len(b.dirty, 1, "WriteAt(): Dirty")
+	require.NoError(b.Sync(), "Sync(): Rewrite")
+	require.Equal(uint64(4), b.Generation(), "Generation(): Rewrite")
+
+	// Roll back an individual sector.
+	dataOff, metaOff := b.sectorOff(0), b.chunkOff(0)
+	oldData, oldMeta := readFileAt(t, f, dataOff, sectorSize), readFileAt(t, f, metaOff, blockStoreEntrySize)
+
+	_, err = b.WriteAt(make([]byte, sectorSize), 0)
+	require.NoError(err, "WriteAt(): Overwrite")
+	require.NoError(b.Sync(), "Sync(): Overwrite")
+
+	_, err = f.WriteAt(oldData, dataOff)
+	require.NoError(err, "Rollback data")
+	b, err = aead.OpenBlockStore(f)
+	require.NoError(err, "OpenBlockStore(): Data rollback")
+	_, err = b.ReadAt(buf[:1], 0)
+	require.Equal(ErrOpen, err, "ReadAt(): Data rollback")
+	_, err = b.ReadAt(buf[:1], sectorSize)
+	require.NoError(err, "ReadAt(): Other sector")
+	_, err = b.WriteAt(buf[:1], 0)
+	require.Equal(ErrOpen, err, "WriteAt(): Partial, data rollback")
+
+	_, err = f.WriteAt(oldMeta, metaOff)
+	require.NoError(err, "Rollback metadata")
+	b, err = aead.OpenBlockStore(f)
+	require.NoError(err, "OpenBlockStore(): Metadata rollback")
+	_, err = b.ReadAt(buf[:1], sectorSize)
+	require.Equal(ErrOpen, err, "ReadAt(): Metadata rollback")
+	_, err = b.ReadAt(buf[:1], 70*sectorSize)
+	require.NoError(err, "ReadAt(): Other chunk")
+
+	// Tampering with the tree is detected.
+	_, err = f.WriteAt(oldMeta, metaOff)
+	require.NoError(err, "Restore metadata")
+	b, err = aead.OpenBlockStore(f)
+	require.NoError(err, "OpenBlockStore(): Tree")
+	node := readFileAt(t, f, b.nodeOff(7), TagSize)
+	node[0] ^= 0x01
+	_, err = f.WriteAt(node, b.nodeOff(7))
+	require.NoError(err, "Modify tree")
+	_, err = b.ReadAt(buf[:1], 70*sectorSize)
+	require.Equal(ErrOpen, err, "ReadAt(): Modified tree")
+
+	// Writes without a Sync are detected, and can be recovered.
+	f2, err := ioutil.TempFile("", "norx-blockstore")
+	require.NoError(err, "TempFile()")
+	defer os.Remove(f2.Name())
+	defer f2.Close()
+
+	b, err = aead.CreateBlockStore(f2, &BlockStoreConfig{SectorCount: 2})
+	require.NoError(err, "CreateBlockStore(): Default sector size")
+	require.Equal(DefaultSectorSize, b.SectorSize(), "SectorSize()")
+	_, err = b.WriteAt([]byte("unsynced"), 0)
+	require.NoError(err, "WriteAt(): Unsynced")
+	gen := b.Generation()
+
+	b, err = aead.OpenBlockStore(f2)
+	require.NoError(err, "OpenBlockStore(): Unsynced")
+	_, err = b.ReadAt(buf[:8], 0)
+	require.Equal(ErrOpen, err, "ReadAt(): Unsynced")
+
+	_, _, err = aead.RecoverBlockStore(f2, gen+1)
+	require.Equal(ErrBlockStoreRollback, err, "RecoverBlockStore(): Rollback")
+	b, lost, err := aead.RecoverBlockStore(f2, gen)
+	require.NoError(err, "RecoverBlockStore()")
+	require.Len(lost, 0, "RecoverBlockStore(): Lost")
+	require.Equal(gen+1, b.Generation(), "RecoverBlockStore(): Generation")
+	_, err = b.ReadAt(buf[:8], 0)
+	require.NoError(err, "ReadAt(): Recovered")
+	require.Equal([]byte("unsynced"), buf[:8], "ReadAt(): Recovered")
+
+	// A write interrupted between the sector and metadata is lost.
+	_, err = b.WriteAt([]byte("first"), DefaultSectorSize)
+	require.NoError(err, "WriteAt(): First")
+	require.NoError(b.Sync(), "Sync(): First")
+	oldMeta = readFileAt(t, f2, b.chunkOff(0)+blockStoreEntrySize, blockStoreEntrySize)
+	_, err = b.WriteAt([]byte("torn"), DefaultSectorSize)
+	require.NoError(err, "WriteAt(): Torn")
+	_, err = f2.WriteAt(oldMeta, b.chunkOff(0)+blockStoreEntrySize)
+	require.NoError(err, "Tear write")
+	b, lost, err = aead.RecoverBlockStore(f2, 0)
+	require.NoError(err, "RecoverBlockStore(): Torn")
+	require.Equal([]uint64{1}, lost, "RecoverBlockStore(): Torn, lost")
+	_, err = b.ReadAt(buf[:DefaultSectorSize+8], 0)
+	require.NoError(err, "ReadAt(): Torn")
+	require.Equal([]byte("unsynced"), buf[:8], "ReadAt(): Torn")
+	require.Equal(make([]byte, DefaultSectorSize-8), buf[8:DefaultSectorSize], "ReadAt(): Torn")
+	require.Equal(make([]byte, 8), buf[DefaultSectorSize:DefaultSectorSize+8], "ReadAt(): Torn, lost")
+
+	require.NoError(b.Close(), "Close()")
+	require.Equal(blockStoreKeys{}, b.keys, "Close(): Subkeys")
+	_, err = b.ReadAt(buf[:8], 0)
+	require.Equal(ErrBlockStoreClosed, err, "ReadAt(): Closed")
+	_, err = b.WriteAt(buf[:8], 0)
+	require.Equal(ErrBlockStoreClosed, err, "WriteAt(): Closed")
+	require.Equal(ErrBlockStoreClosed, b.Sync(), "Sync(): Closed")
+	require.NoError(b.Close(), "Close(): Again")
+
+	require.NoError(f2.Truncate(int64(BlockStoreHeaderSize)), "Truncate()")
+	_, err = aead.OpenBlockStore(f2)
+	require.Equal(ErrInvalidBlockStore, err, "OpenBlockStore(): Truncated")
+
+	_, err = aead.CreateBlockStore(f2, &BlockStoreConfig{SectorSize: MaxSectorSize + 1})
+	require.Equal(ErrInvalidSectorSize, err, "CreateBlockStore(): Sector size")
+}
+
+func readFileAt(t *testing.T, f *os.File, off int64, l int) []byte {
+	b := make([]byte, l)
+	_, err := f.ReadAt(b, off)
+	require.New(t).NoError(err, "ReadAt(%d, %d)", off, l)
+	return b
+}
@@ -0,0 +1,466 @@
+// channel.go - Pre-shared key secure channel
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// ChannelVersion is the secure channel protocol version.
+	ChannelVersion = 1
+
+	// MaxChannelRecordSize is the maximum payload size of a secure channel
+	// record.
+	MaxChannelRecordSize = 16 * 1024
+
+	// ChannelRekeyInterval is the number of records sent in each direction
+	// after which the key for that direction is updated.
+	ChannelRekeyInterval = 1 << 24
+
+	channelMagic        = "NORXCHAN"
+	channelRandomSize   = 32
+	channelHelloSize    = len(channelMagic) + 1 + channelRandomSize
+	channelRecordHeader = 1 + 2
+
+	channelRecordData  = 1
+	channelRecordClose = 2
+
+	channelCloseTimeout = 5 * time.Second
+
+	channelClientKeyLabel      = "norx: channel client write key"
+	channelServerKeyLabel      = "norx: channel server write key"
+	channelClientFinishedLabel = "norx: channel client finished"
+	channelServerFinishedLabel = "norx: channel server finished"
+)
+
+var (
+	// ErrHandshake is the error returned when the secure channel handshake
+	// fails, including when the peer does not know the pre-shared key.
+	ErrHandshake = errors.New("norx: channel handshake failed")
+
+	// ErrInvalidRecord is the error returned when a secure channel record
+	// is malformed.
+	ErrInvalidRecord = errors.New("norx: invalid channel record")
+
+	errChannelClosed = errors.New("norx: use of closed channel")
+)
+
+// Conn is a secure channel over a net.Conn, authenticated with a pre-shared
+// key, that implements net.Conn.
+//
+// The handshake is performed on the first Read or Write (or an explicit call
+// to Handshake), and consists of:
+//
+//	client -> server: magic [8]byte, version uint8, clientRandom [32]byte
+//	server -> client: magic [8]byte, version uint8, serverRandom [32]byte,
+//	                  serverFinished [TagSize]byte
+//	client -> server: clientFinished [TagSize]byte
+//
+// The per-direction keys and finished messages are derived from the
+// pre-shared key and the transcript (both hellos, without serverFinished),
+// with the NORX permutation in a domain separate from Seal, and a
+// per-purpose label.  Each side verifies the peer's finished
+// message before sending or accepting any data, and since both sides
+// contribute fresh randoms, the keys are unique to each connection.
+//
+// Records are NORX64-4-1 sealed, and are:
+//
+//	kind       uint8  // 1 = data, 2 = close (empty payload)
+//	length     uint16 // Big endian, of the ciphertext and tag.
+//	ciphertext [length]byte
+//
+// The record header is authenticated as the NORX header, and the nonce is
+// the big endian record sequence number, left padded with zeros.  After
+// ChannelRekeyInterval records, the key for that direction is updated (as
+// with LimitedAEAD), and the sequence number is reset.  Close sends a close
+// record, so that truncation is detected, and results in
+// io.ErrUnexpectedEOF instead of io.EOF.
+//
+// Read and Write may be called concurrently, however errors (including
+// timeouts) are fatal to the direction they occur in.
+type Conn struct {
+	conn     net.Conn
+	psk      [KeySize]byte
+	isClient bool
+
+	handshakeLock sync.Mutex
+	handshakeDone bool
+	handshakeErr  error
+
+	in         channelHalf
+	out        channelHalf
+	rekeyAfter uint64
+
+	rbuf  []byte
+	avail []byte
+}
+
+type channelHalf struct {
+	lock sync.Mutex
+
+	aead *AEAD
+	seq  uint64
+	err  error
+}
+
+func (h *channelHalf) nonce(nonce []byte) {
+	binary.BigEndian.PutUint64(nonce[NonceSize-8:], h.seq)
+}
+
+func (h *channelHalf) advance(rekeyAfter uint64) {
+	if h.seq++; h.seq < rekeyAfter {
+		return
+	}
+
+	var nextKey [KeySize]byte
+	h.aead.deriveNextKey(&nextKey)
+	h.aead.setKey(nextKey[:])
+	burnBytes(nextKey[:])
+	h.seq = 0
+}
+
+// Client returns a new client side secure channel over conn, authenticated
+// with psk, which must be KeySize bytes.
+func Client(conn net.Conn, psk []byte) *Conn {
+	return newConn(conn, psk, true)
+}
+
+// Server returns a new server side secure channel over conn, authenticated
+// with psk, which must be KeySize bytes.
+func Server(conn net.Conn, psk []byte) *Conn {
+	return newConn(conn, psk, false)
+}
+
+func newConn(conn net.Conn, psk []byte, isClient bool) *Conn {
+	if len(psk) != KeySize {
+		panic(ErrInvalidKeySize)
+	}
+
+	c := &Conn{
+		conn:       conn,
+		isClient:   isClient,
+		rekeyAfter: ChannelRekeyInterval,
+	}
+	copy(c.psk[:], psk)
+
+	return c
+}
+
+// Handshake runs the handshake if it has not yet been run.  Most uses of
+// this package need not call Handshake explicitly.
+func (c *Conn) Handshake() error {
+	c.handshakeLock.Lock()
+	defer c.handshakeLock.Unlock()
+
+	if c.handshakeDone || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+
+	// The pre-shared key is only used by the handshake, so it is burned
+	// regardless of the outcome.
+	defer burnBytes(c.psk[:])
+
+	if c.isClient {
+		c.handshakeErr = c.clientHandshake()
+	} else {
+		c.handshakeErr = c.serverHandshake()
+	}
+	if c.handshakeErr != nil {
+		c.resetKeys()
+	}
+	c.handshakeDone = c.handshakeErr == nil
+
+	return c.handshakeErr
+}
+
+func (c *Conn) clientHandshake() error {
+	transcript := make([]byte, 2*channelHelloSize)
+	clientHello, serverHello := transcript[:channelHelloSize], transcript[channelHelloSize:]
+	if err := newChannelHello(clientHello); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(clientHello); err != nil {
+		return err
+	}
+
+	var serverFinished [TagSize]byte
+	if _, err := io.ReadFull(c.conn, serverHello); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c.conn, serverFinished[:]); err != nil {
+		return err
+	}
+	if !validChannelHello(serverHello) {
+		return ErrHandshake
+	}
+
+	var expected, clientFinished [TagSize]byte
+	c.kdf(expected[:], channelServerFinishedLabel, transcript)
+	if subtle.ConstantTimeCompare(expected[:], serverFinished[:]) != 1 {
+		return ErrHandshake
+	}
+	c.kdf(clientFinished[:], channelClientFinishedLabel, transcript)
+	if _, err := c.conn.Write(clientFinished[:]); err != nil {
+		return err
+	}
+
+	c.setKeys(transcript, channelServerKeyLabel, channelClientKeyLabel)
+
+	return nil
+}
+
+func (c *Conn) serverHandshake() error {
+	transcript := make([]byte, 2*channelHelloSize)
+	clientHello, serverHello := transcript[:channelHelloSize], transcript[channelHelloSize:]
+	if _, err := io.ReadFull(c.conn, clientHello); err != nil {
+		return err
+	}
+	if !validChannelHello(clientHello) {
+		return ErrHandshake
+	}
+	if err := newChannelHello(serverHello); err != nil {
+		return err
+	}
+
+	msg := make([]byte, 0, channelHelloSize+TagSize)
+	msg = append(msg, serverHello...)
+	msg = msg[:channelHelloSize+TagSize]
+	c.kdf(msg[channelHelloSize:], channelServerFinishedLabel, transcript)
+	if _, err := c.conn.Write(msg); err != nil {
+		return err
+	}
+
+	var expected, clientFinished [TagSize]byte
+	if _, err := io.ReadFull(c.conn, clientFinished[:]); err != nil {
+		return err
+	}
+	c.kdf(expected[:], channelClientFinishedLabel, transcript)
+	if subtle.ConstantTimeCompare(expected[:], clientFinished[:]) != 1 {
+		return ErrHandshake
+	}
+
+	c.setKeys(transcript, channelClientKeyLabel, channelServerKeyLabel)
+
+	return nil
+}
+
+func (c *Conn) setKeys(transcript []byte, inLabel, outLabel string) {
+	var key [KeySize]byte
+	defer burnBytes(key[:])
+
+	c.kdf(key[:], inLabel, transcript)
+	c.in.aead = newAEAD(key[:], 4)
+	c.kdf(key[:], outLabel, transcript)
+	c.out.aead = newAEAD(key[:], 4)
+}
+
+// resetKeys burns the traffic keys, if any.
+func (c *Conn) resetKeys() {
+	for _, h := range []*channelHalf{&c.in, &c.out} {
+		if h.aead != nil {
+			h.aead.Reset()
+			h.aead = nil
+		}
+	}
+}
+
+// kdf derives a value from the pre-shared key and the transcript.
+func (c *Conn) kdf(out []byte, label string, transcript []byte) {
+	deriveKey(permutationL4, out, c.psk[:], label, transcript)
+}
+
+func newChannelHello(b []byte) error {
+	copy(b, channelMagic)
+	b[len(channelMagic)] = ChannelVersion
+	_, err := io.ReadFull(rand.Reader, b[len(channelMagic)+1:])
+	return err
+}
+
+func validChannelHello(b []byte) bool {
+	return string(b[:len(channelMagic)]) == channelMagic && b[len(channelMagic)] == ChannelVersion
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.in.lock.Lock()
+	defer c.in.lock.Unlock()
+
+	for len(c.avail) == 0 {
+		if c.in.err != nil {
+			return 0, c.in.err
+		}
+		c.in.err = c.readRecord()
+	}
+
+	n := copy(p, c.avail)
+	c.avail = c.avail[n:]
+	return n, nil
+}
+
+func (c *Conn) readRecord() error {
+	var hdr [channelRecordHeader]byte
+	if _, err := io.ReadFull(c.conn, hdr[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	kind, length := hdr[0], int(binary.BigEndian.Uint16(hdr[1:]))
+	if length < TagSize || length > MaxChannelRecordSize+TagSize {
+		return ErrInvalidRecord
+	}
+	switch kind {
+	case channelRecordData:
+	case channelRecordClose:
+		if length != TagSize {
+			return ErrInvalidRecord
+		}
+	default:
+		return ErrInvalidRecord
+	}
+
+	if c.rbuf == nil {
+		c.rbuf = make([]byte, MaxChannelRecordSize+TagSize)
+	}
+	ct := c.rbuf[:length]
+	if _, err := io.ReadFull(c.conn, ct); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	var nonce [NonceSize]byte
+	c.in.nonce(nonce[:])
+	pt, err := c.in.aead.Open(ct[:0], nonce[:], ct, hdr[:], nil)
+	if err != nil {
+		return err
+	}
+	c.in.advance(c.rekeyAfter)
+
+	if kind == channelRecordClose {
+		return io.EOF
+	}
+	c.avail = pt
+	return nil
+}
+
+// Write writes data to the connection, split into records of at most
+// MaxChannelRecordSize bytes.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.out.lock.Lock()
+	defer c.out.lock.Unlock()
+
+	var n int
+	for len(p) > 0 {
+		if c.out.err != nil {
+			return n, c.out.err
+		}
+
+		l := len(p)
+		if l > MaxChannelRecordSize {
+			l = MaxChannelRecordSize
+		}
+		if c.out.err = c.writeRecord(channelRecordData, p[:l]); c.out.err == nil {
+			n, p = n+l, p[l:]
+		}
+	}
+
+	return n, c.out.err
+}
+
+func (c *Conn) writeRecord(kind byte, p []byte) error {
+	var nonce [NonceSize]byte
+	c.out.nonce(nonce[:])
+
+	rec := make([]byte, channelRecordHeader, channelRecordHeader+len(p)+TagSize)
+	rec[0] = kind
+	binary.BigEndian.PutUint16(rec[1:], uint16(len(p)+TagSize))
+	rec = c.out.aead.Seal(rec, nonce[:], p, rec[:channelRecordHeader], nil)
+
+	if _, err := c.conn.Write(rec); err != nil {
+		return err
+	}
+	c.out.advance(c.rekeyAfter)
+
+	return nil
+}
+
+// Close sends a close record (if the handshake has completed), burns the
+// keys, and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.handshakeLock.Lock()
+	handshakeDone := c.handshakeDone
+	if !handshakeDone && c.handshakeErr == nil {
+		c.handshakeErr = errChannelClosed
+	}
+	burnBytes(c.psk[:])
+	c.handshakeLock.Unlock()
+
+	if handshakeDone {
+		c.out.lock.Lock()
+		if c.out.err == nil {
+			c.conn.SetWriteDeadline(time.Now().Add(channelCloseTimeout))
+			if c.out.err = c.writeRecord(channelRecordClose, nil); c.out.err == nil {
+				c.out.err = errChannelClosed
+			}
+		}
+		c.out.aead.Reset()
+		c.out.lock.Unlock()
+	}
+
+	err := c.conn.Close()
+	if handshakeDone {
+		c.in.aead.Reset()
+	}
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying
+// connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+var _ net.Conn = (*Conn)(nil)
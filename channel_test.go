@@ -0,0 +1,173 @@
+// channel_test.go - Pre-shared key secure channel tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannel(t *testing.T) {
+	require := require.New(t)
+
+	var psk [KeySize]byte
+	_, err := rand.Read(psk[:])
+	require.NoError(err, "rand.Read(psk)")
+
+	newPair := func(rekeyAfter uint64) (*Conn, *Conn) {
+		c, s := net.Pipe()
+		client, server := Client(c, psk[:]), Server(s, psk[:])
+		client.rekeyAfter, server.rekeyAfter = rekeyAfter, rekeyAfter
+		return client, server
+	}
+
+	// Echo, with the server reading everything until the close record.
+	client, server := newPair(3)
+	msgs := [][]byte{
+		[]byte("hello"),
+		make([]byte, MaxChannelRecordSize),
+		make([]byte, 2*MaxChannelRecordSize+1),
+		[]byte("goodbye"),
+	}
+	var expected []byte
+	for _, msg := range msgs[1:3] {
+		_, err = rand.Read(msg)
+		require.NoError(err, "rand.Read(msg)")
+	}
+	for _, msg := range msgs {
+		expected = append(expected, msg...)
+	}
+
+	serverErr := make(chan error, 1)
+	serverData := make(chan []byte, 1)
+	go func() {
+		b, err := ioutil.ReadAll(server)
+		serverData <- b
+		serverErr <- err
+	}()
+	for i, msg := range msgs {
+		n, err := client.Write(msg)
+		require.NoError(err, "Write(%d)", i)
+		require.Equal(len(msg), n, "Write(%d)", i)
+	}
+	require.NoError(client.Close(), "Close()")
+	require.NoError(<-serverErr, "ReadAll()")
+	require.Equal(expected, <-serverData, "ReadAll()")
+	// 6 data records, and the close record.
+	require.Equal(uint64(7%3), server.in.seq, "Rekeyed")
+	_, err = client.Write([]byte("late"))
+	require.Equal(errChannelClosed, err, "Write(): Closed")
+
+	// Bidirectional.
+	client, server = newPair(ChannelRekeyInterval)
+	go func() {
+		buf := make([]byte, 64)
+		n, err := server.Read(buf)
+		if err == nil {
+			_, err = server.Write(bytes.ToUpper(buf[:n]))
+		}
+		serverErr <- err
+	}()
+	_, err = client.Write([]byte("ping"))
+	require.NoError(err, "Write(): Ping")
+	buf := make([]byte, 64)
+	n, err := client.Read(buf)
+	require.NoError(err, "Read(): Pong")
+	require.Equal([]byte("PING"), buf[:n], "Read(): Pong")
+	require.NoError(<-serverErr, "Server")
+	require.Equal(client.RemoteAddr(), client.conn.RemoteAddr(), "RemoteAddr()")
+
+	// Truncation is detected.
+	go func() {
+		_, err := ioutil.ReadAll(server)
+		serverErr <- err
+	}()
+	_, err = client.Write([]byte("truncated"))
+	require.NoError(err, "Write(): Truncated")
+	require.NoError(client.conn.Close(), "Close(): Underlying")
+	require.Equal(io.ErrUnexpectedEOF, <-serverErr, "ReadAll(): Truncated")
+
+	// Mismatched rekey intervals fail to authenticate.
+	client, server = newPair(2)
+	server.rekeyAfter = 3
+	go func() {
+		_, err := ioutil.ReadAll(server)
+		serverErr <- err
+	}()
+	for i := 0; i < 3; i++ {
+		_, err = client.Write([]byte("record"))
+		require.NoError(err, "Write(%d): Rekey mismatch", i)
+	}
+	require.Equal(ErrOpen, <-serverErr, "ReadAll(): Rekey mismatch")
+	client.conn.Close()
+
+	// Wrong pre-shared key.
+	c, s := net.Pipe()
+	var wrongPSK [KeySize]byte
+	client, server = Client(c, wrongPSK[:]), Server(s, psk[:])
+	go func() {
+		serverErr <- server.Handshake()
+	}()
+	require.Equal(ErrHandshake, client.Handshake(), "Handshake(): Wrong PSK")
+	_, err = client.Write([]byte("x"))
+	require.Equal(ErrHandshake, err, "Write(): Wrong PSK")
+	client.Close()
+	require.Error(<-serverErr, "Handshake(): Wrong PSK, server")
+	require.Equal(make([]byte, KeySize), server.psk[:], "Handshake(): Wrong PSK, burned")
+	require.Nil(server.in.aead, "Handshake(): Wrong PSK, in")
+	require.Nil(server.out.aead, "Handshake(): Wrong PSK, out")
+
+	// Closing before the handshake burns the pre-shared key.
+	c, s = net.Pipe()
+	client = Client(c, psk[:])
+	require.NoError(client.Close(), "Close(): Before handshake")
+	require.Equal(make([]byte, KeySize), client.psk[:], "Close(): Before handshake, burned")
+	require.Equal(errChannelClosed, client.Handshake(), "Handshake(): Closed")
+	s.Close()
+
+	// Tampering is detected.
+	c, relayC := net.Pipe()
+	relayS, s := net.Pipe()
+	client, server = Client(c, psk[:]), Server(s, psk[:])
+	go flipRelay(relayS, relayC, channelHelloSize+TagSize+channelRecordHeader+1)
+	go flipRelay(relayC, relayS, -1)
+	go func() {
+		_, err := ioutil.ReadAll(server)
+		serverErr <- err
+	}()
+	_, err = client.Write([]byte("tampered"))
+	require.NoError(err, "Write(): Tampered")
+	require.Equal(ErrOpen, <-serverErr, "ReadAll(): Tampered")
+	client.conn.Close()
+
+	require.Panics(func() { Client(c, psk[:16]) }, "Client(): Short PSK")
+}
+
+// flipRelay copies src to dst, flipping a bit of the byte at offset pos.
+func flipRelay(dst, src net.Conn, pos int) {
+	defer dst.Close()
+
+	var off int
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if pos >= off && pos < off+n {
+			buf[pos-off] ^= 0x01
+		}
+		off += n
+		if _, werr := dst.Write(buf[:n]); werr != nil || err != nil {
+			return
+		}
+	}
+}
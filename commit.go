@@ -0,0 +1,99 @@
+// commit.go - Key committing mode
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import "crypto/subtle"
+
+const (
+	// CommitmentSize is the size of a key commitment in bytes.
+	CommitmentSize = 32
+
+	// CommittingOverhead is the difference between the lengths of a
+	// plaintext and its key committing ciphertext, which is CommitmentSize
+	// bytes more than that of Seal.
+	CommittingOverhead = CommitmentSize + TagSize
+
+	commitLabel = "norx: key commitment"
+)
+
+// SealCommitting encrypts and authenticates plaintext as with Seal, and
+// appends a key commitment followed by the result to dst, returning the
+// updated slice.  The output is CommitmentSize bytes longer than that of
+// Seal (CommittingOverhead in total), and can only be opened by
+// OpenCommitting.
+//
+// NORX tags (like those of most AEAD constructions) do not commit to the
+// key, so it is possible to construct a ciphertext that opens successfully
+// under multiple keys, which enables partitioning oracle attacks in
+// protocols that try multiple (eg: password derived or per-recipient) keys.
+// The commitment is derived from the key and nonce with the NORX
+// permutation, in a domain that Seal can not reach, which guarantees that a ciphertext
+// will only open under the key and nonce that it was sealed with.
+//
+// The plaintext and dst must not overlap.
+func (ae *AEAD) SealCommitting(dst, nonce, plaintext, header, footer []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		panic(ErrReset)
+	}
+	if ae.nonceGuard != nil {
+		ae.nonceGuard.check(nonce)
+	}
+
+	var commitment [CommitmentSize]byte
+	ae.commitment(&commitment, nonce)
+
+	dst = append(dst, commitment[:]...)
+	return aeadEncrypt(ae.perm, dst, header, plaintext, footer, nonce, ae.key)
+}
+
+// OpenCommitting decrypts and authenticates ciphertext produced by
+// SealCommitting as with Open, after verifying the key commitment, and if
+// successful, appends the resulting plaintext to dst, returning the updated
+// slice.  No decryption is done if the commitment does not match.
+//
+// The ciphertext and dst must not overlap.
+func (ae *AEAD) OpenCommitting(dst, nonce, ciphertext, header, footer []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return dst, ErrReset
+	}
+	if len(ciphertext) < CommittingOverhead {
+		return dst, ErrOpen
+	}
+
+	var commitment [CommitmentSize]byte
+	ae.commitment(&commitment, nonce)
+	if subtle.ConstantTimeCompare(commitment[:], ciphertext[:CommitmentSize]) != 1 {
+		return dst, ErrOpen
+	}
+
+	dst, ok := aeadDecrypt(ae.perm, dst, header, ciphertext[CommitmentSize:], footer, nonce, ae.key)
+	if !ok {
+		return dst, ErrOpen
+	}
+	return dst, nil
+}
+
+// commitment computes the key commitment for the nonce, with deriveKey
+// keyed by the key.  The caller must hold the read lock.
+func (ae *AEAD) commitment(out *[CommitmentSize]byte, nonce []byte) {
+	deriveKey(ae.perm, out[:], ae.key, commitLabel, nonce)
+}
@@ -0,0 +1,72 @@
+// commit_test.go - Key committing mode tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitting(t *testing.T) {
+	require := require.New(t)
+
+	var k, k2 [KeySize]byte
+	var nonce, nonce2 [NonceSize]byte
+	for _, b := range [][]byte{k[:], k2[:], nonce[:], nonce2[:]} {
+		_, err := rand.Read(b)
+		require.NoError(err, "rand.Read()")
+	}
+
+	for _, l := range []int{4, 6} {
+		aead, aead2 := newTestAEAD(k[:], l), newTestAEAD(k2[:], l)
+		msg, hdr, ftr := []byte("committed message"), []byte("header"), []byte("footer")
+
+		ct := aead.SealCommitting(nil, nonce[:], msg, hdr, ftr)
+		require.Len(ct, len(msg)+CommittingOverhead, "SealCommitting(): Length")
+		require.Equal(aead.Seal(nil, nonce[:], msg, hdr, ftr), ct[CommitmentSize:], "SealCommitting(): Seal compatible")
+
+		pt, err := aead.OpenCommitting(nil, nonce[:], ct, hdr, ftr)
+		require.NoError(err, "OpenCommitting()")
+		require.Equal(msg, pt, "OpenCommitting()")
+
+		// The commitment depends on both the key and the nonce.
+		ctK := aead2.SealCommitting(nil, nonce[:], msg, hdr, ftr)
+		ctN := aead.SealCommitting(nil, nonce2[:], msg, hdr, ftr)
+		require.NotEqual(ct[:CommitmentSize], ctK[:CommitmentSize], "SealCommitting(): Key")
+		require.NotEqual(ct[:CommitmentSize], ctN[:CommitmentSize], "SealCommitting(): Nonce")
+
+		_, err = aead2.OpenCommitting(nil, nonce[:], ct, hdr, ftr)
+		require.Equal(ErrOpen, err, "OpenCommitting(): Wrong key")
+		_, err = aead.OpenCommitting(nil, nonce2[:], ct, hdr, ftr)
+		require.Equal(ErrOpen, err, "OpenCommitting(): Wrong nonce")
+		_, err = aead.OpenCommitting(nil, nonce[:], ct, nil, ftr)
+		require.Equal(ErrOpen, err, "OpenCommitting(): Wrong header")
+
+		// A valid ciphertext with a substituted commitment is rejected.
+		bad := append(append([]byte{}, ctK[:CommitmentSize]...), ct[CommitmentSize:]...)
+		_, err = aead.OpenCommitting(nil, nonce[:], bad, hdr, ftr)
+		require.Equal(ErrOpen, err, "OpenCommitting(): Substituted commitment")
+
+		_, err = aead.OpenCommitting(nil, nonce[:], ct[:CommittingOverhead-1], hdr, ftr)
+		require.Equal(ErrOpen, err, "OpenCommitting(): Truncated")
+
+		// Seal under the all zero (public) key can not produce the
+		// commitment, including with the nonce that was once used to
+		// compute it that way.
+		var zeroKey [KeySize]byte
+		oldNonce := make([]byte, NonceSize)
+		copy(oldNonce, "NORX key commit")
+		hdrC := append(append([]byte(commitLabel), k[:]...), nonce[:]...)
+		for _, n := range [][]byte{zeroKey[:], nonce[:], oldNonce} {
+			zct := newTestAEAD(zeroKey[:], l).Seal(nil, n, nil, hdrC, nil)
+			require.NotEqual(ct[:CommitmentSize], zct, "SealCommitting(): Zero key Seal")
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// envelope.go - Self-describing ciphertext envelope
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// EnvelopeVersion is the envelope format version.
+	EnvelopeVersion = 1
+
+	// EnvelopeHeaderSize is the size of the envelope header, which
+	// precedes the ciphertext.
+	EnvelopeHeaderSize = len(envelopeMagic) + 1 + 1 + 4 + NonceSize
+
+	// EnvelopeOverhead is the difference between the length of a
+	// marshaled envelope and its plaintext.
+	EnvelopeOverhead = EnvelopeHeaderSize + TagSize
+
+	envelopeMagic = "NORX"
+)
+
+var (
+	// ErrInvalidEnvelope is the error returned when an envelope is
+	// malformed.
+	ErrInvalidEnvelope = errors.New("norx: invalid envelope")
+
+	// ErrUnsupportedEnvelopeVersion is the error returned when an envelope
+	// has an unknown format version.
+	ErrUnsupportedEnvelopeVersion = errors.New("norx: unsupported envelope version")
+
+	// ErrEnvelopeVariantMismatch is the error returned when opening an
+	// envelope with an AEAD instance of a different variant.
+	ErrEnvelopeVariantMismatch = errors.New("norx: envelope variant mismatch")
+)
+
+// Envelope is a self-describing NORX ciphertext, carrying all of the
+// metadata (other than the key) needed to decrypt it.
+//
+// The marshaled form is:
+//
+//	magic      [4]byte // "NORX"
+//	version    uint8   // EnvelopeVersion
+//	variant    uint8   // Variant
+//	keyID      uint32  // Big endian
+//	nonce      [NonceSize]byte
+//	ciphertext []byte  // Including the tag
+//
+// All of the fields preceding the ciphertext form the envelope header,
+// which is authenticated by prepending it to the NORX header data.
+type Envelope struct {
+	Variant    Variant
+	KeyID      uint32
+	Nonce      [NonceSize]byte
+	Ciphertext []byte
+}
+
+// Marshal returns the binary form of the envelope.
+func (e *Envelope) Marshal() ([]byte, error) {
+	if !e.Variant.Valid() {
+		return nil, ErrInvalidVariant
+	}
+	if len(e.Ciphertext) < TagSize {
+		return nil, ErrInvalidEnvelope
+	}
+
+	b := make([]byte, 0, EnvelopeHeaderSize+len(e.Ciphertext))
+	b = e.appendHeader(b)
+	return append(b, e.Ciphertext...), nil
+}
+
+// Unmarshal parses the binary form of an envelope.  Envelopes with an
+// unknown version or variant, or that are truncated are rejected.  The
+// ciphertext is copied, and does not alias b.
+func (e *Envelope) Unmarshal(b []byte) error {
+	if len(b) < len(envelopeMagic)+1 || string(b[:len(envelopeMagic)]) != envelopeMagic {
+		return ErrInvalidEnvelope
+	}
+	b = b[len(envelopeMagic):]
+	if b[0] != EnvelopeVersion {
+		return ErrUnsupportedEnvelopeVersion
+	}
+	b = b[1:]
+	if len(b) < EnvelopeOverhead-len(envelopeMagic)-1 {
+		return ErrInvalidEnvelope
+	}
+
+	v := Variant(b[0])
+	if !v.Valid() {
+		return ErrInvalidVariant
+	}
+	e.Variant = v
+	e.KeyID = binary.BigEndian.Uint32(b[1:5])
+	copy(e.Nonce[:], b[5:5+NonceSize])
+	e.Ciphertext = append([]byte{}, b[5+NonceSize:]...)
+
+	return nil
+}
+
+func (e *Envelope) appendHeader(dst []byte) []byte {
+	dst = append(dst, envelopeMagic...)
+	dst = append(dst, EnvelopeVersion, byte(e.Variant))
+	dst = append(dst, byte(e.KeyID>>24), byte(e.KeyID>>16), byte(e.KeyID>>8), byte(e.KeyID))
+	return append(dst, e.Nonce[:]...)
+}
+
+// SealEnvelope encrypts and authenticates plaintext as with Seal, and
+// returns the resulting envelope, tagged with keyID.  The envelope header is
+// authenticated in addition to the optional header and footer.
+func (ae *AEAD) SealEnvelope(keyID uint32, nonce, plaintext, header, footer []byte) *Envelope {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	e := &Envelope{
+		Variant: ae.Variant(),
+		KeyID:   keyID,
+	}
+	copy(e.Nonce[:], nonce)
+
+	hdr := append(e.appendHeader(make([]byte, 0, EnvelopeHeaderSize+len(header))), header...)
+	e.Ciphertext = ae.Seal(nil, nonce, plaintext, hdr, footer)
+
+	return e
+}
+
+// OpenEnvelope decrypts and authenticates the envelope as with Open, with
+// the optional header and footer, and if successful, appends the resulting
+// plaintext to dst, returning the updated slice.  The caller is responsible
+// for selecting the AEAD instance based on the envelope's KeyID.
+func (ae *AEAD) OpenEnvelope(dst []byte, e *Envelope, header, footer []byte) ([]byte, error) {
+	if e.Variant != ae.Variant() {
+		return dst, ErrEnvelopeVariantMismatch
+	}
+
+	hdr := append(e.appendHeader(make([]byte, 0, EnvelopeHeaderSize+len(header))), header...)
+	return ae.Open(dst, e.Nonce[:], e.Ciphertext, hdr, footer)
+}
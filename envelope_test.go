@@ -0,0 +1,72 @@
+// envelope_test.go - Ciphertext envelope tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	_, err = rand.Read(nonce[:])
+	require.NoError(err, "rand.Read(nonce)")
+
+	aead := newTestAEAD(k[:], 6)
+	require.Equal(VariantNORX6461, aead.Variant(), "Variant()")
+
+	msg, hdr, ftr := []byte("envelope payload"), []byte("header"), []byte("footer")
+	e := aead.SealEnvelope(0xdeadbeef, nonce[:], msg, hdr, ftr)
+	b, err := e.Marshal()
+	require.NoError(err, "Marshal()")
+	require.Len(b, len(msg)+EnvelopeOverhead, "Marshal(): Length")
+
+	var e2 Envelope
+	require.NoError(e2.Unmarshal(b), "Unmarshal()")
+	require.Equal(e, &e2, "Unmarshal(): Round trip")
+	require.Equal(uint32(0xdeadbeef), e2.KeyID, "Unmarshal(): KeyID")
+
+	pt, err := aead.OpenEnvelope(nil, &e2, hdr, ftr)
+	require.NoError(err, "OpenEnvelope()")
+	require.Equal(msg, pt, "OpenEnvelope()")
+
+	// The envelope header is authenticated.
+	e2.KeyID++
+	_, err = aead.OpenEnvelope(nil, &e2, hdr, ftr)
+	require.Equal(ErrOpen, err, "OpenEnvelope(): Altered KeyID")
+
+	aead4 := newTestAEAD(k[:], 4)
+	_, err = aead4.OpenEnvelope(nil, e, hdr, ftr)
+	require.Equal(ErrEnvelopeVariantMismatch, err, "OpenEnvelope(): Variant mismatch")
+
+	// Strict parsing.
+	bad := append([]byte{}, b...)
+	bad[len(envelopeMagic)] = EnvelopeVersion + 1
+	require.Equal(ErrUnsupportedEnvelopeVersion, e2.Unmarshal(bad), "Unmarshal(): Version")
+
+	bad = append([]byte{}, b...)
+	bad[0] ^= 1
+	require.Equal(ErrInvalidEnvelope, e2.Unmarshal(bad), "Unmarshal(): Magic")
+
+	bad = append([]byte{}, b...)
+	bad[len(envelopeMagic)+1] = 0
+	require.Equal(ErrInvalidVariant, e2.Unmarshal(bad), "Unmarshal(): Variant")
+
+	require.Equal(ErrInvalidEnvelope, e2.Unmarshal(b[:EnvelopeOverhead-1]), "Unmarshal(): Truncated")
+	require.Equal(ErrInvalidEnvelope, e2.Unmarshal(nil), "Unmarshal(): Empty")
+
+	_, err = (&Envelope{Variant: 0, Ciphertext: make([]byte, TagSize)}).Marshal()
+	require.Equal(ErrInvalidVariant, err, "Marshal(): Variant")
+}
@@ -0,0 +1,156 @@
+// fields.go - Structured additional data
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const fieldsVersion = 1
+
+// ErrInvalidFields is the error returned when encoded fields are malformed.
+var ErrInvalidFields = errors.New("norx: invalid fields")
+
+// Field is a labeled additional data field.
+type Field struct {
+	Label string
+	Value []byte
+}
+
+// Fields is an ordered list of labeled additional data fields, that is
+// canonically encoded, so that distinct lists of fields (unlike simple
+// concatenation) always result in distinct additional data.
+//
+// The encoding of an empty list is empty, otherwise it is:
+//
+//	version uint8  // 1
+//	count   uint32 // Big endian
+//	fields  [count]struct {
+//		labelLen uint32 // Big endian
+//		label    [labelLen]byte
+//		valueLen uint32 // Big endian
+//		value    [valueLen]byte
+//	}
+type Fields []Field
+
+// Encode returns the canonical encoding of the fields.  Labels and values
+// must each be less than 4 GiB.
+func (f Fields) Encode() []byte {
+	if len(f) == 0 {
+		return nil
+	}
+
+	sz := 1 + 4
+	for _, field := range f {
+		if uint64(len(field.Label)) > 0xffffffff || uint64(len(field.Value)) > 0xffffffff {
+			panic(ErrInvalidFields)
+		}
+		sz += 4 + len(field.Label) + 4 + len(field.Value)
+	}
+
+	b := make([]byte, 0, sz)
+	b = append(b, fieldsVersion)
+	b = appendUint32(b, len(f))
+	for _, field := range f {
+		b = appendUint32(b, len(field.Label))
+		b = append(b, field.Label...)
+		b = appendUint32(b, len(field.Value))
+		b = append(b, field.Value...)
+	}
+
+	return b
+}
+
+// String returns a human readable representation of the fields, for
+// debugging.
+func (f Fields) String() string {
+	var sb strings.Builder
+
+	sb.WriteByte('[')
+	for i, field := range f {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(strconv.Quote(field.Label))
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Quote(string(field.Value)))
+	}
+	sb.WriteByte(']')
+
+	return sb.String()
+}
+
+// DecodeFields decodes canonically encoded fields, as returned by Encode.
+// The values alias b.
+func DecodeFields(b []byte) (Fields, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < 1+4 || b[0] != fieldsVersion {
+		return nil, ErrInvalidFields
+	}
+
+	count := binary.BigEndian.Uint32(b[1:])
+	b = b[1+4:]
+	if count == 0 || uint64(count) > uint64(len(b)/8) {
+		// Each field is at least 8 bytes, and an empty list has an empty
+		// encoding.
+		return nil, ErrInvalidFields
+	}
+
+	f := make(Fields, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var label, value []byte
+		var ok bool
+		if label, b, ok = splitLengthPrefixed(b); !ok {
+			return nil, ErrInvalidFields
+		}
+		if value, b, ok = splitLengthPrefixed(b); !ok {
+			return nil, ErrInvalidFields
+		}
+		f = append(f, Field{Label: string(label), Value: value})
+	}
+	if len(b) != 0 {
+		return nil, ErrInvalidFields
+	}
+
+	return f, nil
+}
+
+// SealFields encrypts and authenticates plaintext as with Seal, using the
+// canonical encodings of the header and footer fields as the additional
+// data.
+func (ae *AEAD) SealFields(dst, nonce, plaintext []byte, header, footer Fields) []byte {
+	return ae.Seal(dst, nonce, plaintext, header.Encode(), footer.Encode())
+}
+
+// OpenFields decrypts and authenticates ciphertext as with Open, using the
+// canonical encodings of the header and footer fields as the additional
+// data.
+func (ae *AEAD) OpenFields(dst, nonce, ciphertext []byte, header, footer Fields) ([]byte, error) {
+	return ae.Open(dst, nonce, ciphertext, header.Encode(), footer.Encode())
+}
+
+func appendUint32(b []byte, v int) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func splitLengthPrefixed(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	l := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if uint64(l) > uint64(len(b)) {
+		return nil, nil, false
+	}
+	return b[:l], b[l:], true
+}
@@ -0,0 +1,78 @@
+// fields_test.go - Structured additional data tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFields(t *testing.T) {
+	require := require.New(t)
+
+	f := Fields{
+		{"tenant", []byte("acme")},
+		{"path", []byte("/a/b")},
+		{"version", []byte{0, 1}},
+	}
+	b := f.Encode()
+	require.Len(b, 1+4+3*8+len("tenant")+4+len("path")+4+len("version")+2, "Encode(): Length")
+
+	f2, err := DecodeFields(b)
+	require.NoError(err, "DecodeFields()")
+	require.Equal(f, f2, "DecodeFields(): Round trip")
+	require.Equal(`["tenant":"acme", "path":"/a/b", "version":"\x00\x01"]`, f2.String(), "String()")
+
+	require.Nil(Fields{}.Encode(), "Encode(): Empty")
+	f2, err = DecodeFields(nil)
+	require.NoError(err, "DecodeFields(): Empty")
+	require.Len(f2, 0, "DecodeFields(): Empty")
+
+	// Encodings that would be equal if concatenated are distinct.
+	a := Fields{{"ab", []byte("c")}}.Encode()
+	c := Fields{{"a", []byte("bc")}}.Encode()
+	d := Fields{{"a", nil}, {"", []byte("bc")}}.Encode()
+	require.NotEqual(a, c, "Encode(): Label/value boundary")
+	require.NotEqual(c, d, "Encode(): Field boundary")
+
+	// Strict decoding.
+	for i := 1; i < len(b); i++ {
+		_, err = DecodeFields(b[:i])
+		require.Equal(ErrInvalidFields, err, "DecodeFields(): Truncated %d", i)
+	}
+	_, err = DecodeFields(append(append([]byte{}, b...), 0))
+	require.Equal(ErrInvalidFields, err, "DecodeFields(): Trailing garbage")
+	bad := append([]byte{}, b...)
+	bad[0] = fieldsVersion + 1
+	_, err = DecodeFields(bad)
+	require.Equal(ErrInvalidFields, err, "DecodeFields(): Version")
+	_, err = DecodeFields([]byte{fieldsVersion, 0, 0, 0, 0})
+	require.Equal(ErrInvalidFields, err, "DecodeFields(): Zero count")
+
+	// Integration.
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err = rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	aead := newTestAEAD(k[:], 6)
+
+	msg := []byte("structured")
+	trailer := Fields{{"checksum", []byte{0xaa}}}
+	ct := aead.SealFields(nil, nonce[:], msg, f, trailer)
+	require.Equal(aead.Seal(nil, nonce[:], msg, b, trailer.Encode()), ct, "SealFields(): Seal compatible")
+
+	pt, err := aead.OpenFields(nil, nonce[:], ct, f, trailer)
+	require.NoError(err, "OpenFields()")
+	require.Equal(msg, pt, "OpenFields()")
+	_, err = aead.OpenFields(nil, nonce[:], ct, trailer, f)
+	require.Equal(ErrOpen, err, "OpenFields(): Swapped")
+	_, err = aead.OpenFields(nil, nonce[:], ct, f[:2], trailer)
+	require.Equal(ErrOpen, err, "OpenFields(): Missing field")
+}
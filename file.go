@@ -0,0 +1,408 @@
+// file.go - Seekable segmented file format
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// FileVersion is the segmented file format version.
+	FileVersion = 1
+
+	// FileIDSize is the size of a file identifier.
+	FileIDSize = 16
+
+	// FileHeaderSize is the size of the segmented file header.
+	FileHeaderSize = len(fileMagic) + 1 + 1 + 4 + 8 + FileIDSize + NonceSize
+
+	// DefaultFileSegmentSize is the default segment size.
+	DefaultFileSegmentSize = 64 * 1024
+
+	// MaxFileSegmentSize is the maximum segment size.
+	MaxFileSegmentSize = 16 * 1024 * 1024
+
+	fileMagic    = "NORXFILE"
+	fileKeyLabel = "norx: file key"
+)
+
+var (
+	// ErrInvalidFile is the error returned when a segmented file is
+	// malformed, truncated, or is of a different variant.
+	ErrInvalidFile = errors.New("norx: invalid file")
+
+	// ErrUnsupportedFileVersion is the error returned when a segmented file
+	// has an unknown format version.
+	ErrUnsupportedFileVersion = errors.New("norx: unsupported file version")
+
+	// ErrInvalidSegmentSize is the error returned when a segment size is
+	// out of range.
+	ErrInvalidSegmentSize = errors.New("norx: invalid segment size")
+
+	// ErrFileClosed is the error returned when reading from a closed
+	// segmented file.
+	ErrFileClosed = errors.New("norx: file closed")
+
+	errNegativeOffset = errors.New("norx: negative offset")
+	errInvalidWhence  = errors.New("norx: invalid whence")
+)
+
+// FileConfig is the configuration for a segmented file.
+type FileConfig struct {
+	// ID is an application defined file identifier, that is authenticated
+	// as part of every segment.
+	ID [FileIDSize]byte
+
+	// SegmentSize is the number of plaintext bytes per segment, with 0
+	// meaning DefaultFileSegmentSize.
+	SegmentSize int
+}
+
+func (cfg *FileConfig) segmentSize() (int, error) {
+	if cfg == nil || cfg.SegmentSize == 0 {
+		return DefaultFileSegmentSize, nil
+	}
+	if cfg.SegmentSize < 0 || cfg.SegmentSize > MaxFileSegmentSize {
+		return 0, ErrInvalidSegmentSize
+	}
+	return cfg.SegmentSize, nil
+}
+
+// SealFile reads size bytes of plaintext from r, and writes it to w as a
+// segmented file, where each segment is sealed independently, allowing
+// random access with OpenFile.  The format is:
+//
+//	magic        [8]byte // "NORXFILE"
+//	version      uint8   // FileVersion
+//	variant      uint8   // Variant
+//	segmentSize  uint32  // Big endian
+//	segmentCount uint64  // Big endian
+//	id           [FileIDSize]byte
+//	nonce        [NonceSize]byte
+//	segments     [segmentCount]struct {
+//		ciphertext [segmentSize]byte // Shorter for the final segment.
+//		tag        [TagSize]byte
+//	}
+//
+// Each segment is sealed with a per-file subkey derived from the key and the
+// nonce, with the big endian segment index (left padded with zeros) as the
+// nonce, and the header followed by the big endian segment index as the
+// additional data.  Since the segment count is authenticated, reordering,
+// truncation, and extension are all detected.  There is always at least one
+// segment, even if size is 0.
+//
+// The nonce MUST be unique for all time, for a given key.
+func (ae *AEAD) SealFile(w io.Writer, r io.Reader, size int64, nonce []byte, cfg *FileConfig) error {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+	segSize, err := cfg.segmentSize()
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return errNegativeOffset
+	}
+
+	count := uint64(size) / uint64(segSize)
+	if uint64(size)%uint64(segSize) != 0 || count == 0 {
+		count++
+	}
+
+	var hdr [FileHeaderSize + 8]byte
+	copy(hdr[:], fileMagic)
+	off := len(fileMagic)
+	hdr[off], hdr[off+1] = FileVersion, byte(ae.Variant())
+	binary.BigEndian.PutUint32(hdr[off+2:], uint32(segSize))
+	binary.BigEndian.PutUint64(hdr[off+6:], count)
+	if cfg != nil {
+		copy(hdr[off+14:], cfg.ID[:])
+	}
+	copy(hdr[FileHeaderSize-NonceSize:], nonce)
+
+	var key [KeySize]byte
+	defer burnBytes(key[:])
+
+	ae.lock.RLock()
+	if ae.reset {
+		ae.lock.RUnlock()
+		return ErrReset
+	}
+	if ae.nonceGuard != nil {
+		ae.nonceGuard.check(nonce)
+	}
+	ae.fileKey(&key, hdr[:])
+	ae.lock.RUnlock()
+
+	if _, err = w.Write(hdr[:FileHeaderSize]); err != nil {
+		return err
+	}
+
+	buf := make([]byte, segSize+TagSize)
+	defer burnBytes(buf)
+	remaining := uint64(size)
+	for idx := uint64(0); idx < count; idx++ {
+		n := uint64(segSize)
+		if remaining < n {
+			n = remaining
+		}
+		remaining -= n
+
+		pt := buf[:n]
+		if _, err = io.ReadFull(r, pt); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		var ct []byte
+		if ct, err = ae.sealSegment(buf[:0], pt, hdr[:], key[:], idx); err != nil {
+			return err
+		}
+		if _, err = w.Write(ct); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ae *AEAD) sealSegment(dst, pt, hdr, key []byte, idx uint64) ([]byte, error) {
+	var nonce [NonceSize]byte
+	segmentNonce(nonce[:], hdr, idx)
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return nil, ErrReset
+	}
+
+	return aeadEncrypt(ae.perm, dst, hdr, pt, nil, nonce[:], key), nil
+}
+
+// OpenFile is a segmented file opened for reading, that implements
+// io.Reader, io.ReaderAt, and io.Seeker, decrypting only the segments that
+// are touched by each read.  No unauthenticated plaintext is ever returned,
+// and any failure to authenticate a segment results in ErrOpen.
+//
+// ReadAt may be called concurrently, provided that the underlying
+// io.ReaderAt supports it, but Read, Seek, and Close may not.
+type OpenFile struct {
+	aead    *AEAD
+	r       io.ReaderAt
+	hdr     [FileHeaderSize]byte
+	key     [KeySize]byte
+	id      [FileIDSize]byte
+	segSize int
+	count   uint64
+	size    int64
+	off     int64
+	closed  bool
+}
+
+// OpenFile opens a segmented file of size bytes, produced by SealFile, for
+// reading.  The header and final segment are authenticated immediately, so
+// that the plaintext size is trustworthy.
+func (ae *AEAD) OpenFile(r io.ReaderAt, size int64) (*OpenFile, error) {
+	if size < int64(FileHeaderSize+TagSize) {
+		return nil, ErrInvalidFile
+	}
+
+	var hdr [FileHeaderSize]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	off := len(fileMagic)
+	if string(hdr[:off]) != fileMagic {
+		return nil, ErrInvalidFile
+	}
+	if hdr[off] != FileVersion {
+		return nil, ErrUnsupportedFileVersion
+	}
+	if hdr[off+1] != byte(ae.Variant()) {
+		return nil, ErrInvalidFile
+	}
+
+	f := &OpenFile{
+		aead:    ae,
+		r:       r,
+		hdr:     hdr,
+		segSize: int(binary.BigEndian.Uint32(hdr[off+2:])),
+		count:   binary.BigEndian.Uint64(hdr[off+6:]),
+	}
+	copy(f.id[:], hdr[off+14:])
+	if f.segSize <= 0 || f.segSize > MaxFileSegmentSize || f.count == 0 {
+		return nil, ErrInvalidFile
+	}
+
+	// All but the final segment are full, and the final segment may only
+	// be empty if it is the only one.
+	stride := uint64(f.segSize + TagSize)
+	body := uint64(size - int64(FileHeaderSize))
+	if f.count-1 > body/stride {
+		return nil, ErrInvalidFile
+	}
+	last := body - (f.count-1)*stride
+	if last < TagSize || last > stride || (f.count > 1 && last == TagSize) {
+		return nil, ErrInvalidFile
+	}
+	f.size = int64(body - f.count*TagSize)
+
+	ae.lock.RLock()
+	if ae.reset {
+		ae.lock.RUnlock()
+		return nil, ErrReset
+	}
+	ae.fileKey(&f.key, hdr[:])
+	ae.lock.RUnlock()
+
+	// Authenticate the final segment, and with it the header.
+	buf := make([]byte, f.segSize+TagSize)
+	pt, err := f.readSegment(buf, f.count-1)
+	if len(pt) > 0 {
+		burnBytes(pt)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ID returns the file identifier.
+func (f *OpenFile) ID() [FileIDSize]byte {
+	return f.id
+}
+
+// Size returns the size of the plaintext.
+func (f *OpenFile) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(p) bytes of plaintext starting at offset off.
+func (f *OpenFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	var n int
+	buf := make([]byte, f.segSize+TagSize)
+	defer burnBytes(buf)
+	for n < len(p) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+
+		idx := uint64(off / int64(f.segSize))
+		pt, err := f.readSegment(buf, idx)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], pt[off%int64(f.segSize):])
+		n, off = n+m, off+int64(m)
+	}
+
+	return n, nil
+}
+
+// Read reads plaintext from the current offset.
+func (f *OpenFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Close burns the per-file subkey, after which all reads will fail.  The
+// underlying io.ReaderAt is not closed.
+func (f *OpenFile) Close() error {
+	if !f.closed {
+		burnBytes(f.key[:])
+		f.closed = true
+	}
+	return nil
+}
+
+// Seek sets the offset for the next Read, as with io.Seeker.
+func (f *OpenFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *OpenFile) readSegment(buf []byte, idx uint64) ([]byte, error) {
+	if f.closed {
+		return nil, ErrFileClosed
+	}
+
+	n := int64(f.segSize)
+	if idx == f.count-1 {
+		n = f.size - int64(idx)*n
+	}
+	ct := buf[:n+TagSize]
+	if m, err := f.r.ReadAt(ct, int64(FileHeaderSize)+int64(idx)*int64(f.segSize+TagSize)); m != len(ct) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	var nonce [NonceSize]byte
+	var ad [FileHeaderSize + 8]byte
+	copy(ad[:], f.hdr[:])
+	segmentNonce(nonce[:], ad[:], idx)
+
+	f.aead.lock.RLock()
+	defer f.aead.lock.RUnlock()
+
+	if f.aead.reset {
+		return nil, ErrReset
+	}
+
+	pt, ok := aeadDecrypt(f.aead.perm, ct[:0], ad[:], ct, nil, nonce[:], f.key[:])
+	if !ok {
+		return nil, ErrOpen
+	}
+	return pt, nil
+}
+
+// fileKey derives the per-file subkey from the key and the file nonce in
+// the header.  The caller must hold the read lock.
+func (ae *AEAD) fileKey(key *[KeySize]byte, hdr []byte) {
+	deriveKey(ae.perm, key[:], ae.key, fileKeyLabel, hdr[FileHeaderSize-NonceSize:FileHeaderSize])
+}
+
+// segmentNonce sets the nonce for a segment under the per-file subkey, and
+// appends the segment index to the header, which must have 8 bytes of space
+// after it.
+func segmentNonce(nonce, hdr []byte, idx uint64) {
+	binary.BigEndian.PutUint64(hdr[FileHeaderSize:], idx)
+	copy(nonce[NonceSize-8:], hdr[FileHeaderSize:])
+}
@@ -0,0 +1,151 @@
+// file_test.go - Seekable segmented file format tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	_, err = rand.Read(nonce[:])
+	require.NoError(err, "rand.Read(nonce)")
+
+	aead := newTestAEAD(k[:], 4)
+	cfg := &FileConfig{
+		ID:          [FileIDSize]byte{'m', 'e', 'd', 'i', 'a'},
+		SegmentSize: 100,
+	}
+
+	sealFile := func(msg []byte) []byte {
+		var b bytes.Buffer
+		err := aead.SealFile(&b, bytes.NewReader(msg), int64(len(msg)), nonce[:], cfg)
+		require.NoError(err, "SealFile(%d)", len(msg))
+		return b.Bytes()
+	}
+
+	for _, sz := range []int{0, 1, 99, 100, 101, 200, 1234} {
+		msg := make([]byte, sz)
+		_, err = rand.Read(msg)
+		require.NoError(err, "rand.Read(msg)")
+
+		ct := sealFile(msg)
+		nSegments := (sz + 99) / 100
+		if nSegments == 0 {
+			nSegments = 1
+		}
+		require.Len(ct, FileHeaderSize+sz+nSegments*TagSize, "SealFile(%d): Length", sz)
+
+		f, err := aead.OpenFile(bytes.NewReader(ct), int64(len(ct)))
+		require.NoError(err, "OpenFile(%d)", sz)
+		require.Equal(int64(sz), f.Size(), "Size(%d)", sz)
+		require.Equal(cfg.ID, f.ID(), "ID(%d)", sz)
+
+		pt, err := ioutil.ReadAll(f)
+		require.NoError(err, "ReadAll(%d)", sz)
+		require.Equal(msg, append([]byte{}, pt...), "ReadAll(%d)", sz)
+
+		// Random access, including ranges that span segments.
+		for _, r := range [][2]int{{0, 1}, {50, 100}, {99, 2}, {150, 300}, {sz - 1, 1}} {
+			off, l := r[0], r[1]
+			if off < 0 || off+l > sz {
+				continue
+			}
+			b := make([]byte, l)
+			n, err := f.ReadAt(b, int64(off))
+			require.NoError(err, "ReadAt(%d): %d, %d", sz, off, l)
+			require.Equal(l, n, "ReadAt(%d): %d, %d", sz, off, l)
+			require.Equal(msg[off:off+l], b, "ReadAt(%d): %d, %d", sz, off, l)
+		}
+
+		b := make([]byte, 10)
+		n, err := f.ReadAt(b, int64(sz)-5)
+		if sz >= 5 {
+			require.Equal(io.EOF, err, "ReadAt(%d): Past end", sz)
+			require.Equal(5, n, "ReadAt(%d): Past end", sz)
+		}
+
+		pos, err := f.Seek(-1, io.SeekEnd)
+		if sz > 0 {
+			require.NoError(err, "Seek(%d)", sz)
+			require.Equal(int64(sz-1), pos, "Seek(%d)", sz)
+			n, err = f.Read(b)
+			require.NoError(err, "Read(%d): Seeked", sz)
+			require.Equal(msg[sz-1:], b[:n], "Read(%d): Seeked", sz)
+			_, err = f.Read(b)
+			require.Equal(io.EOF, err, "Read(%d): EOF", sz)
+		} else {
+			require.Error(err, "Seek(%d): Negative", sz)
+		}
+	}
+
+	msg := make([]byte, 350)
+	ct := sealFile(msg)
+
+	// Only the segments that are touched are authenticated.
+	bad := append([]byte{}, ct...)
+	bad[FileHeaderSize+1] ^= 0x01
+	f, err := aead.OpenFile(bytes.NewReader(bad), int64(len(bad)))
+	require.NoError(err, "OpenFile(): Tampered first segment")
+	_, err = f.ReadAt(make([]byte, 10), 200)
+	require.NoError(err, "ReadAt(): Untouched segment")
+	_, err = f.ReadAt(make([]byte, 10), 95)
+	require.Equal(ErrOpen, err, "ReadAt(): Tampered segment")
+
+	// Closing burns the subkey, after which reads fail.
+	require.NoError(f.Close(), "Close()")
+	require.Equal(make([]byte, KeySize), f.key[:], "Close(): Subkey")
+	_, err = f.ReadAt(make([]byte, 10), 200)
+	require.Equal(ErrFileClosed, err, "ReadAt(): Closed")
+
+	// Tampering with the header, swapping segments, truncation, and
+	// extension are detected.
+	bad = append([]byte{}, ct...)
+	bad[FileHeaderSize-NonceSize-1] ^= 0x01
+	_, err = aead.OpenFile(bytes.NewReader(bad), int64(len(bad)))
+	require.Equal(ErrOpen, err, "OpenFile(): Tampered ID")
+
+	stride := 100 + TagSize
+	bad = append([]byte{}, ct...)
+	copy(bad[FileHeaderSize:], ct[FileHeaderSize+stride:FileHeaderSize+2*stride])
+	copy(bad[FileHeaderSize+stride:], ct[FileHeaderSize:FileHeaderSize+stride])
+	f, err = aead.OpenFile(bytes.NewReader(bad), int64(len(bad)))
+	require.NoError(err, "OpenFile(): Swapped")
+	_, err = f.ReadAt(make([]byte, 1), 0)
+	require.Equal(ErrOpen, err, "ReadAt(): Swapped")
+
+	for _, l := range []int{len(ct) - 1, len(ct) - (50 + TagSize), len(ct) + 1, FileHeaderSize} {
+		b := make([]byte, l)
+		copy(b, ct)
+		_, err = aead.OpenFile(bytes.NewReader(b), int64(l))
+		require.Error(err, "OpenFile(): Length %d", l)
+	}
+
+	bad = append([]byte{}, ct...)
+	bad[len(fileMagic)] = FileVersion + 1
+	_, err = aead.OpenFile(bytes.NewReader(bad), int64(len(bad)))
+	require.Equal(ErrUnsupportedFileVersion, err, "OpenFile(): Version")
+	_, err = newTestAEAD(k[:], 6).OpenFile(bytes.NewReader(ct), int64(len(ct)))
+	require.Equal(ErrInvalidFile, err, "OpenFile(): Variant")
+
+	err = aead.SealFile(ioutil.Discard, bytes.NewReader(msg), int64(len(msg))+1, nonce[:], cfg)
+	require.Equal(io.ErrUnexpectedEOF, err, "SealFile(): Short input")
+	err = aead.SealFile(ioutil.Discard, bytes.NewReader(msg), 0, nonce[:], &FileConfig{SegmentSize: -1})
+	require.Equal(ErrInvalidSegmentSize, err, "SealFile(): Segment size")
+}
@@ -0,0 +1,30 @@
+// gen.go - Code generation driver
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build ignore
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/Yawning/norx/internal/permgen"
+)
+
+func main() {
+	files, err := permgen.Generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, f := range files {
+		if err := ioutil.WriteFile(f.Name, f.Data, 0644); err != nil {
+			log.Fatalf("failed to write %s: %v", f.Name, err)
+		}
+	}
+}
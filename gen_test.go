@@ -0,0 +1,29 @@
+// gen_test.go - Generated code tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/Yawning/norx/internal/permgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerated(t *testing.T) {
+	require := require.New(t)
+
+	files, err := permgen.Generate()
+	require.NoError(err, "permgen.Generate()")
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f.Name)
+		require.NoError(err, "ioutil.ReadFile(%s)", f.Name)
+		require.Equal(string(f.Data), string(b), "%s is stale, run go generate", f.Name)
+	}
+}
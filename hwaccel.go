@@ -12,31 +12,41 @@ var (
 	hardwareAccelImpl     = implReference
 
 	implReference = &hwaccelImpl{
-		name:          "Reference",
-		initFn:        initRef,
-		absorbDataFn:  absorbDataRef,
-		encryptDataFn: encryptDataRef,
-		decryptDataFn: decryptDataRef,
-		finalizeFn:    finalizeRef,
+		name: "Reference",
 	}
 )
 
+// hwaccelImpl identifies a backend.  The actual dispatch is done by the
+// per-architecture state methods (init, absorbData, encryptData,
+// decryptData, finalize) via a switch on hardwareAccelImpl, so that the
+// hot path consists entirely of direct calls, and the state does not
+// escape to the heap.
 type hwaccelImpl struct {
-	name          string
-	initFn        func(*state, []byte, []byte)
-	absorbDataFn  func(*state, []byte, uint64)
-	encryptDataFn func(*state, []byte, []byte)
-	decryptDataFn func(*state, []byte, []byte)
-	finalizeFn    func(*state, []byte, []byte)
+	name string
+}
+
+func setHardwareAccelImpl(impl *hwaccelImpl) {
+	isHardwareAccelerated = impl != implReference
+	hardwareAccelImpl = impl
 }
 
 func forceDisableHardwareAcceleration() {
-	isHardwareAccelerated = false
-	hardwareAccelImpl = implReference
+	setHardwareAccelImpl(implReference)
+}
+
+func initHardwareAcceleration() {
+	// supportedHardwareAccelImpls returns the implementations in
+	// ascending order of preference.
+	impls := supportedHardwareAccelImpls()
+	if len(impls) == 0 {
+		forceDisableHardwareAcceleration()
+		return
+	}
+	setHardwareAccelImpl(impls[len(impls)-1])
 }
 
 // IsHardwareAccelerated returns true iff the NORX implementation will use
-// hardware acceleration (eg: AVX2).
+// hardware acceleration (eg: AVX2, SSSE3).
 func IsHardwareAccelerated() bool {
 	return isHardwareAccelerated
 }
@@ -0,0 +1,135 @@
+// hwaccel_386.go - 386 optimized routines
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build 386,!gccgo,!noasm,go1.10
+
+package norx
+
+//go:noescape
+func cpuid386(cpuidParams *uint32)
+
+func supportsSSE2() bool {
+	const sse2Bit = 1 << 26
+
+	// CPUID.(EAX=01H, ECX=0H):EDX.SSE2[bit 26]==1
+	regs := [4]uint32{0x01}
+	cpuid386(&regs[0])
+	return regs[3]&sse2Bit != 0
+}
+
+var implSSE2 = &hwaccelImpl{
+	name: "SSE2",
+}
+
+func (s *state) init(key, nonce []byte) {
+	switch hardwareAccelImpl {
+	case implSSE2:
+		initXMM(s, key, nonce)
+	default:
+		initRef(s, key, nonce)
+	}
+}
+
+func (s *state) absorbData(in []byte, tag uint64) {
+	switch hardwareAccelImpl {
+	case implSSE2:
+		absorbDataXMM(s, in, tag)
+	default:
+		absorbDataRef(s, in, tag)
+	}
+}
+
+func (s *state) encryptData(out, in []byte) {
+	switch hardwareAccelImpl {
+	case implSSE2:
+		encryptDataXMM(s, out, in)
+	default:
+		encryptDataRef(s, out, in)
+	}
+}
+
+func (s *state) decryptData(out, in []byte) {
+	switch hardwareAccelImpl {
+	case implSSE2:
+		decryptDataXMM(s, out, in)
+	default:
+		decryptDataRef(s, out, in)
+	}
+}
+
+// encryptBlocks encrypts the full blocks of payload in in, without the final
+// padded block, for incremental processing.
+func (s *state) encryptBlocks(out, in []byte) {
+	blocks := len(in) / bytesR
+	if blocks == 0 {
+		return
+	}
+
+	switch hardwareAccelImpl {
+	case implSSE2:
+		encryptBlocksXMM(s.perm, &s.s[0], &out[0], &in[0], uint64(blocks))
+	default:
+		encryptBlocksRef(s, out, in)
+	}
+}
+
+// decryptBlocks decrypts the full blocks of payload in in, without the final
+// padded block, for incremental processing.
+func (s *state) decryptBlocks(out, in []byte) {
+	blocks := len(in) / bytesR
+	if blocks == 0 {
+		return
+	}
+
+	switch hardwareAccelImpl {
+	case implSSE2:
+		decryptBlocksXMM(s.perm, &s.s[0], &out[0], &in[0], uint64(blocks))
+	default:
+		decryptBlocksRef(s, out, in)
+	}
+}
+
+func (s *state) finalize(tag, key []byte) {
+	switch hardwareAccelImpl {
+	case implSSE2:
+		finalizeXMM(s, tag, key)
+	default:
+		finalizeRef(s, tag, key)
+	}
+}
+
+func (s *state) permute() {
+	permuteRef(s)
+}
+
+func permuteX2(s0, s1 *state) {
+	s0.permute()
+	s1.permute()
+}
+
+func cryptBlocksX2(s0, s1 *state, out0, in0, out1, in1 []byte, blocks int, decrypt bool) bool {
+	return false
+}
+
+func isMultiBufferAccelerated() bool {
+	return false
+}
+
+func sealSmall(p *permutation, out, a, m, z, nonce, key []byte) bool {
+	return false
+}
+
+func openSmall(p *permutation, out, a, c, z, nonce, key, tag []byte) bool {
+	return false
+}
+
+func supportedHardwareAccelImpls() []*hwaccelImpl {
+	if supportsSSE2() {
+		return []*hwaccelImpl{implSSE2}
+	}
+	return nil
+}
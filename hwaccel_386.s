@@ -0,0 +1,21 @@
+// +build !noasm,go1.10
+// hwaccel_386.s - 386 SSE2 optimized routines
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+#include "textflag.h"
+
+// func cpuid386(cpuidParams *uint32)
+TEXT ·cpuid386(SB), NOSPLIT, $0-4
+	MOVL cpuidParams+0(FP), DI
+	MOVL 0(DI), AX
+	MOVL 8(DI), CX
+	CPUID
+	MOVL AX, 0(DI)
+	MOVL BX, 4(DI)
+	MOVL CX, 8(DI)
+	MOVL DX, 12(DI)
+	RET
@@ -15,23 +15,18 @@ func cpuidAmd64(cpuidParams *uint32)
 //go:noescape
 func xgetbv0Amd64(xcrVec *uint32)
 
-//go:noescape
-func initAVX2(s *uint64, key, nonce *byte, initConsts, instConsts *uint64)
-
-//go:noescape
-func absorbBlocksAVX2(s *uint64, in *byte, rounds, blocks uint64, tag *uint64)
+// smallMaxBlocks is the maximum number of padded header, payload, and
+// trailer blocks that will be processed via the fused single call routines.
+const smallMaxBlocks = 4
 
-//go:noescape
-func encryptBlocksAVX2(s *uint64, out, in *byte, rounds, blocks uint64)
-
-//go:noescape
-func decryptBlocksAVX2(s *uint64, out, in *byte, rounds, blocks uint64)
+func supportsSSSE3() bool {
+	const ssse3Bit = 1 << 9
 
-//go:noescape
-func decryptLastBlockAVX2(s *uint64, out, in *byte, rounds, inLen uint64)
-
-//go:noescape
-func finalizeAVX2(s *uint64, out, key *byte, rounds uint64)
+	// CPUID.(EAX=01H, ECX=0H):ECX.SSSE3[bit 9]==1
+	regs := [4]uint32{0x01}
+	cpuidAmd64(&regs[0])
+	return regs[2]&ssse3Bit != 0
+}
 
 func supportsAVX2() bool {
 	// https://software.intel.com/en-us/articles/how-to-detect-new-instruction-support-in-the-4th-generation-intel-core-processor-family
@@ -68,18 +63,110 @@ func supportsAVX2() bool {
 	return regs[1]&avx2Bit != 0
 }
 
-var implAVX2 = &hwaccelImpl{
-	name:          "AVX2",
-	initFn:        initYMM,
-	absorbDataFn:  absorbDataYMM,
-	encryptDataFn: encryptDataYMM,
-	decryptDataFn: decryptDataYMM,
-	finalizeFn:    finalizeYMM,
+var (
+	implAVX2 = &hwaccelImpl{
+		name: "AVX2",
+	}
+
+	implSSSE3 = &hwaccelImpl{
+		name: "SSSE3",
+	}
+)
+
+func (s *state) init(key, nonce []byte) {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		initYMM(s, key, nonce)
+	case implSSSE3:
+		initXMM(s, key, nonce)
+	default:
+		initRef(s, key, nonce)
+	}
+}
+
+func (s *state) absorbData(in []byte, tag uint64) {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		absorbDataYMM(s, in, tag)
+	case implSSSE3:
+		absorbDataXMM(s, in, tag)
+	default:
+		absorbDataRef(s, in, tag)
+	}
+}
+
+func (s *state) encryptData(out, in []byte) {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		encryptDataYMM(s, out, in)
+	case implSSSE3:
+		encryptDataXMM(s, out, in)
+	default:
+		encryptDataRef(s, out, in)
+	}
+}
+
+func (s *state) decryptData(out, in []byte) {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		decryptDataYMM(s, out, in)
+	case implSSSE3:
+		decryptDataXMM(s, out, in)
+	default:
+		decryptDataRef(s, out, in)
+	}
+}
+
+// encryptBlocks encrypts the full blocks of payload in in, without the final
+// padded block, for incremental processing.
+func (s *state) encryptBlocks(out, in []byte) {
+	blocks := len(in) / bytesR
+	if blocks == 0 {
+		return
+	}
+
+	switch hardwareAccelImpl {
+	case implAVX2:
+		encryptBlocksAVX2(s.perm, &s.s[0], &out[0], &in[0], uint64(blocks))
+	case implSSSE3:
+		encryptBlocksXMM(s.perm, &s.s[0], &out[0], &in[0], uint64(blocks))
+	default:
+		encryptBlocksRef(s, out, in)
+	}
+}
+
+// decryptBlocks decrypts the full blocks of payload in in, without the final
+// padded block, for incremental processing.
+func (s *state) decryptBlocks(out, in []byte) {
+	blocks := len(in) / bytesR
+	if blocks == 0 {
+		return
+	}
+
+	switch hardwareAccelImpl {
+	case implAVX2:
+		decryptBlocksAVX2(s.perm, &s.s[0], &out[0], &in[0], uint64(blocks))
+	case implSSSE3:
+		decryptBlocksXMM(s.perm, &s.s[0], &out[0], &in[0], uint64(blocks))
+	default:
+		decryptBlocksRef(s, out, in)
+	}
+}
+
+func (s *state) finalize(tag, key []byte) {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		finalizeYMM(s, tag, key)
+	case implSSSE3:
+		finalizeXMM(s, tag, key)
+	default:
+		finalizeRef(s, tag, key)
+	}
 }
 
 func initYMM(s *state, key, nonce []byte) {
-	var instConsts = [4]uint64{paramW, uint64(s.rounds), paramP, paramT}
-	initAVX2(&s.s[0], &key[0], &nonce[0], &initializationConstants[8], &instConsts[0])
+	var instConsts = [4]uint64{paramW, uint64(s.perm.rounds), paramP, paramT}
+	initAVX2(s.perm, &s.s[0], &key[0], &nonce[0], &initializationConstants[8], &instConsts[0])
 }
 
 func absorbDataYMM(s *state, in []byte, tag uint64) {
@@ -91,14 +178,14 @@ func absorbDataYMM(s *state, in []byte, tag uint64) {
 	var tagVec = [4]uint64{0, 0, 0, tag}
 	var off int
 	if inBlocks := inLen / bytesR; inBlocks > 0 {
-		absorbBlocksAVX2(&s.s[0], &in[0], uint64(s.rounds), uint64(inBlocks), &tagVec[0])
+		absorbBlocksAVX2(s.perm, &s.s[0], &in[0], uint64(inBlocks), &tagVec[0])
 		off += inBlocks * bytesR
 	}
 	in = in[off:]
 
 	var lastBlock [bytesR]byte
 	padRef(&lastBlock, in)
-	absorbBlocksAVX2(&s.s[0], &lastBlock[0], uint64(s.rounds), 1, &tagVec[0])
+	absorbBlocksAVX2(s.perm, &s.s[0], &lastBlock[0], 1, &tagVec[0])
 }
 
 func encryptDataYMM(s *state, out, in []byte) {
@@ -109,14 +196,14 @@ func encryptDataYMM(s *state, out, in []byte) {
 
 	var off int
 	if inBlocks := inLen / bytesR; inBlocks > 0 {
-		encryptBlocksAVX2(&s.s[0], &out[0], &in[0], uint64(s.rounds), uint64(inBlocks))
+		encryptBlocksAVX2(s.perm, &s.s[0], &out[0], &in[0], uint64(inBlocks))
 		off += inBlocks * bytesR
 	}
 	out, in = out[off:], in[off:]
 
 	var lastBlock [bytesR]byte
 	padRef(&lastBlock, in)
-	encryptBlocksAVX2(&s.s[0], &lastBlock[0], &lastBlock[0], uint64(s.rounds), 1)
+	encryptBlocksAVX2(s.perm, &s.s[0], &lastBlock[0], &lastBlock[0], 1)
 	copy(out, lastBlock[:len(in)])
 }
 
@@ -128,7 +215,7 @@ func decryptDataYMM(s *state, out, in []byte) {
 
 	var off int
 	if inBlocks := inLen / bytesR; inBlocks > 0 {
-		decryptBlocksAVX2(&s.s[0], &out[0], &in[0], uint64(s.rounds), uint64(inBlocks))
+		decryptBlocksAVX2(s.perm, &s.s[0], &out[0], &in[0], uint64(inBlocks))
 		off += inBlocks * bytesR
 	}
 	out, in = out[off:], in[off:]
@@ -138,7 +225,7 @@ func decryptDataYMM(s *state, out, in []byte) {
 	if len(in) != 0 {
 		inPtr = &in[0]
 	}
-	decryptLastBlockAVX2(&s.s[0], &lastBlock[0], inPtr, uint64(s.rounds), uint64(len(in)))
+	decryptLastBlockAVX2(s.perm, &s.s[0], &lastBlock[0], inPtr, uint64(len(in)))
 	copy(out, lastBlock[:len(in)])
 	burnBytes(lastBlock[:])
 }
@@ -146,15 +233,140 @@ func decryptDataYMM(s *state, out, in []byte) {
 func finalizeYMM(s *state, tag, key []byte) {
 	var lastBlock [bytesC]byte
 
-	finalizeAVX2(&s.s[0], &lastBlock[0], &key[0], uint64(s.rounds))
+	finalizeAVX2(s.perm, &s.s[0], &lastBlock[0], &key[0])
 	copy(tag, lastBlock[:bytesT])
 	burnBytes(lastBlock[:]) // burn buffer
 	burnUint64s(s.s[:])     // at this point we can also burn the state
 }
 
-func initHardwareAcceleration() {
+func (s *state) permute() {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		permuteAVX2(s.perm, &s.s[0])
+	default:
+		permuteRef(s)
+	}
+}
+
+// permuteX2 permutes two states with the same number of rounds.
+func permuteX2(s0, s1 *state) {
+	switch hardwareAccelImpl {
+	case implAVX2:
+		permuteX2AVX2(s0.perm, &s0.s[0], &s1.s[0])
+	default:
+		s0.permute()
+		s1.permute()
+	}
+}
+
+// cryptBlocksX2 encrypts or decrypts blocks full blocks of payload for each of
+// two states with the same number of rounds, returning false if this is not
+// supported.
+func cryptBlocksX2(s0, s1 *state, out0, in0, out1, in1 []byte, blocks int, decrypt bool) bool {
+	if hardwareAccelImpl != implAVX2 {
+		return false
+	}
+
+	if decrypt {
+		decryptBlocksX2AVX2(s0.perm, &s0.s[0], &s1.s[0], &out0[0], &in0[0], &out1[0], &in1[0], uint64(blocks))
+	} else {
+		encryptBlocksX2AVX2(s0.perm, &s0.s[0], &s1.s[0], &out0[0], &in0[0], &out1[0], &in1[0], uint64(blocks))
+	}
+	return true
+}
+
+func isMultiBufferAccelerated() bool {
+	return hardwareAccelImpl == implAVX2
+}
+
+// sealSmall encrypts and authenticates a message in a single call to the
+// fused AVX2 routine if possible, and returns false if the message is not
+// eligible.
+func sealSmall(p *permutation, out, a, m, z, nonce, key []byte) bool {
+	if hardwareAccelImpl != implAVX2 {
+		return false
+	}
+
+	hBlocks, mBlocks, tBlocks := dataBlocks(len(a)), dataBlocks(len(m)), dataBlocks(len(z))
+	if hBlocks+mBlocks+tBlocks > smallMaxBlocks {
+		return false
+	}
+
+	var blocks [smallMaxBlocks * bytesR]byte
+	var instConsts = [4]uint64{paramW, uint64(p.rounds), paramP, paramT}
+	off := padBlocks(blocks[:], a)
+	mOff := off
+	off += padBlocks(blocks[off:], m)
+	padBlocks(blocks[off:], z)
+
+	mLen := len(m)
+	sealSmallAVX2(p, &key[0], &nonce[0], &instConsts[0], &blocks[0], uint64(hBlocks), uint64(mBlocks), uint64(tBlocks), &out[mLen])
+	copy(out, blocks[mOff:mOff+mLen])
+	burnBytes(blocks[:])
+
+	return true
+}
+
+// openSmall decrypts and calculates the tag for a message in a single call
+// to the fused AVX2 routine if possible, and returns false if the message
+// is not eligible.
+func openSmall(p *permutation, out, a, c, z, nonce, key, tag []byte) bool {
+	if hardwareAccelImpl != implAVX2 {
+		return false
+	}
+
+	hBlocks, cBlocks, tBlocks := dataBlocks(len(a)), dataBlocks(len(c)), dataBlocks(len(z))
+	if hBlocks+cBlocks+tBlocks > smallMaxBlocks {
+		return false
+	}
+
+	var blocks [smallMaxBlocks * bytesR]byte
+	var instConsts = [4]uint64{paramW, uint64(p.rounds), paramP, paramT}
+	off := padBlocks(blocks[:], a)
+	cOff := off
+	off += padBlocks(blocks[off:], c)
+	padBlocks(blocks[off:], z)
+
+	cLen := len(c)
+	openSmallAVX2(p, &key[0], &nonce[0], &instConsts[0], &blocks[0], uint64(hBlocks), uint64(cBlocks), uint64(tBlocks), uint64(cLen%bytesR), &tag[0])
+	copy(out, blocks[cOff:cOff+cLen])
+	burnBytes(blocks[:])
+
+	return true
+}
+
+// dataBlocks returns the number of blocks that absorbing/encrypting/decrypting
+// n bytes of data will process.
+func dataBlocks(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return n/bytesR + 1
+}
+
+// padBlocks copies in to out, pads the last block, and returns the number of
+// bytes of out that were used.  out MUST be zero initialized.
+func padBlocks(out, in []byte) int {
+	inLen := len(in)
+	if inLen == 0 {
+		return 0
+	}
+
+	copy(out, in)
+	lastOff := (inLen / bytesR) * bytesR
+	out[inLen] = 0x01
+	out[lastOff+bytesR-1] |= 0x80
+
+	return lastOff + bytesR
+}
+
+func supportedHardwareAccelImpls() []*hwaccelImpl {
+	var impls []*hwaccelImpl
+	if supportsSSSE3() {
+		impls = append(impls, implSSSE3)
+	}
 	if supportsAVX2() {
-		isHardwareAccelerated = true
-		hardwareAccelImpl = implAVX2
+		impls = append(impls, implAVX2)
 	}
+	return impls
 }
@@ -0,0 +1,944 @@
+// hwaccel_avx2_amd64.h - AMD64 AVX2 optimized routines
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// This is included by permute_avx2_amd64.s once per round count, with
+// PERMUTE and PERMUTE_X2 defined as the matching permutation, and the
+// *_FN macros defined as the entry point names.
+
+#ifndef HWACCEL_AVX2_AMD64_H
+#define HWACCEL_AVX2_AMD64_H
+
+// Based heavily on the `ymm` referece implementation, but using assembly
+// language instead of using intrinsics like in a sane language.
+//
+// The TWEAK_LOW_LATENCY variant is used for the permutation.
+
+DATA ·vpshufb_idx_r0<>+0x00(SB)/8, $0x0007060504030201
+DATA ·vpshufb_idx_r0<>+0x08(SB)/8, $0x080f0e0d0c0b0a09
+DATA ·vpshufb_idx_r0<>+0x10(SB)/8, $0x0007060504030201
+DATA ·vpshufb_idx_r0<>+0x18(SB)/8, $0x080f0e0d0c0b0a09
+GLOBL ·vpshufb_idx_r0<>(SB), (NOPTR+RODATA), $32
+
+DATA ·vpshufb_idx_r2<>+0x00(SB)/8, $0x0403020100070605
+DATA ·vpshufb_idx_r2<>+0x08(SB)/8, $0x0c0b0a09080f0e0d
+DATA ·vpshufb_idx_r2<>+0x10(SB)/8, $0x0403020100070605
+DATA ·vpshufb_idx_r2<>+0x18(SB)/8, $0x0c0b0a09080f0e0d
+GLOBL ·vpshufb_idx_r2<>(SB), (NOPTR+RODATA), $32
+
+DATA ·tag_header<>+0x00(SB)/8, $0x0000000000000000
+DATA ·tag_header<>+0x08(SB)/8, $0x0000000000000000
+DATA ·tag_header<>+0x10(SB)/8, $0x0000000000000000
+DATA ·tag_header<>+0x18(SB)/8, $0x0000000000000001
+GLOBL ·tag_header<>(SB), (NOPTR+RODATA), $32
+
+DATA ·tag_payload<>+0x00(SB)/8, $0x0000000000000000
+DATA ·tag_payload<>+0x08(SB)/8, $0x0000000000000000
+DATA ·tag_payload<>+0x10(SB)/8, $0x0000000000000000
+DATA ·tag_payload<>+0x18(SB)/8, $0x0000000000000002
+GLOBL ·tag_payload<>(SB), (NOPTR+RODATA), $32
+
+DATA ·tag_final<>+0x00(SB)/8, $0x0000000000000000
+DATA ·tag_final<>+0x08(SB)/8, $0x0000000000000000
+DATA ·tag_final<>+0x10(SB)/8, $0x0000000000000000
+DATA ·tag_final<>+0x18(SB)/8, $0x0000000000000008
+GLOBL ·tag_final<>(SB), (NOPTR+RODATA), $32
+
+DATA ·tag_trailer<>+0x00(SB)/8, $0x0000000000000000
+DATA ·tag_trailer<>+0x08(SB)/8, $0x0000000000000000
+DATA ·tag_trailer<>+0x10(SB)/8, $0x0000000000000000
+DATA ·tag_trailer<>+0x18(SB)/8, $0x0000000000000004
+GLOBL ·tag_trailer<>(SB), (NOPTR+RODATA), $32
+
+// 96 bytes of 0xff followed by 96 bytes of 0x00, used to build the byte mask
+// for the last (partial) block when decrypting.
+DATA ·block_mask<>+0x00(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x08(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x10(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x18(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x20(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x28(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x30(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x38(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x40(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x48(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x50(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x58(SB)/8, $0xffffffffffffffff
+DATA ·block_mask<>+0x60(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x68(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x70(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x78(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x80(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x88(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x90(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0x98(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0xa0(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0xa8(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0xb0(SB)/8, $0x0000000000000000
+DATA ·block_mask<>+0xb8(SB)/8, $0x0000000000000000
+GLOBL ·block_mask<>(SB), (NOPTR+RODATA), $192
+
+#define G(A, B, C, D, T0, T1, R0, R2) \
+	VPXOR   A, B, T0   \
+	VPAND   A, B, T1   \
+	VPADDQ  T1, T1, T1 \
+	VPXOR   T0, T1, A  \
+	VPXOR   D, T0, D   \
+	VPXOR   D, T1, D   \
+	VPSHUFB R0, D, D   \
+	                   \
+	VPXOR   C, D, T0   \
+	VPAND   C, D, T1   \
+	VPADDQ  T1, T1, T1 \
+	VPXOR   T0, T1, C  \
+	VPXOR   B, T0, B   \
+	VPXOR   B, T1, B   \
+	VPSRLQ  $19, B, T0 \
+	VPSLLQ  $45, B, T1 \
+	VPOR    T0, T1, B  \
+	                   \
+	VPXOR   A, B, T0   \
+	VPAND   A, B, T1   \
+	VPADDQ  T1, T1, T1 \
+	VPXOR   T0, T1, A  \
+	VPXOR   D, T0, D   \
+	VPXOR   D, T1, D   \
+	VPSHUFB R2, D, D   \
+	                   \
+	VPXOR   C, D, T0   \
+	VPAND   C, D, T1   \
+	VPADDQ  T1, T1, T1 \
+	VPXOR   T0, T1, C  \
+	VPXOR   B, T0, B   \
+	VPXOR   B, T1, B   \
+	VPADDQ  B, B, T0   \
+	VPSRLQ  $63, B, T1 \
+	VPOR    T0, T1, B
+
+// -109 -> 147 (See: https://github.com/golang/go/issues/24378)
+#define DIAGONALIZE(A, B, C, D) \
+	VPERMQ $-109, D, D \
+	VPERMQ $78, C, C   \
+	VPERMQ $57, B, B
+
+#define UNDIAGONALIZE(A, B, C, D) \
+	VPERMQ $57, D, D   \
+	VPERMQ $78, C, C   \
+	VPERMQ $-109, B, B
+
+// A single round (column step and diagonal step) on the state in Y0-Y3, with
+// the rotation shuffles in Y13 and Y12, for use with PERMUTE.
+#define ROUND() \
+	G(Y0, Y1, Y2, Y3, Y15, Y14, Y13, Y12) \
+	DIAGONALIZE(Y0, Y1, Y2, Y3)           \
+	G(Y0, Y1, Y2, Y3, Y15, Y14, Y13, Y12) \
+	UNDIAGONALIZE(Y0, Y1, Y2, Y3)
+
+// Multi-buffer support.  Two independent states are permuted at once, with
+// the G function for each interleaved so that the long dependency chains
+// within each can overlap.
+
+#define G2(A0, B0, C0, D0, T00, T01, A1, B1, C1, D1, T10, T11, R0, R2) \
+	VPXOR   A0, B0, T00   \
+	VPXOR   A1, B1, T10   \
+	VPAND   A0, B0, T01   \
+	VPAND   A1, B1, T11   \
+	VPADDQ  T01, T01, T01 \
+	VPADDQ  T11, T11, T11 \
+	VPXOR   T00, T01, A0  \
+	VPXOR   T10, T11, A1  \
+	VPXOR   D0, T00, D0   \
+	VPXOR   D1, T10, D1   \
+	VPXOR   D0, T01, D0   \
+	VPXOR   D1, T11, D1   \
+	VPSHUFB R0, D0, D0    \
+	VPSHUFB R0, D1, D1    \
+	                      \
+	VPXOR   C0, D0, T00   \
+	VPXOR   C1, D1, T10   \
+	VPAND   C0, D0, T01   \
+	VPAND   C1, D1, T11   \
+	VPADDQ  T01, T01, T01 \
+	VPADDQ  T11, T11, T11 \
+	VPXOR   T00, T01, C0  \
+	VPXOR   T10, T11, C1  \
+	VPXOR   B0, T00, B0   \
+	VPXOR   B1, T10, B1   \
+	VPXOR   B0, T01, B0   \
+	VPXOR   B1, T11, B1   \
+	VPSRLQ  $19, B0, T00  \
+	VPSRLQ  $19, B1, T10  \
+	VPSLLQ  $45, B0, T01  \
+	VPSLLQ  $45, B1, T11  \
+	VPOR    T00, T01, B0  \
+	VPOR    T10, T11, B1  \
+	                      \
+	VPXOR   A0, B0, T00   \
+	VPXOR   A1, B1, T10   \
+	VPAND   A0, B0, T01   \
+	VPAND   A1, B1, T11   \
+	VPADDQ  T01, T01, T01 \
+	VPADDQ  T11, T11, T11 \
+	VPXOR   T00, T01, A0  \
+	VPXOR   T10, T11, A1  \
+	VPXOR   D0, T00, D0   \
+	VPXOR   D1, T10, D1   \
+	VPXOR   D0, T01, D0   \
+	VPXOR   D1, T11, D1   \
+	VPSHUFB R2, D0, D0    \
+	VPSHUFB R2, D1, D1    \
+	                      \
+	VPXOR   C0, D0, T00   \
+	VPXOR   C1, D1, T10   \
+	VPAND   C0, D0, T01   \
+	VPAND   C1, D1, T11   \
+	VPADDQ  T01, T01, T01 \
+	VPADDQ  T11, T11, T11 \
+	VPXOR   T00, T01, C0  \
+	VPXOR   T10, T11, C1  \
+	VPXOR   B0, T00, B0   \
+	VPXOR   B1, T10, B1   \
+	VPXOR   B0, T01, B0   \
+	VPXOR   B1, T11, B1   \
+	VPADDQ  B0, B0, T00   \
+	VPADDQ  B1, B1, T10   \
+	VPSRLQ  $63, B0, T01  \
+	VPSRLQ  $63, B1, T11  \
+	VPOR    T00, T01, B0  \
+	VPOR    T10, T11, B1
+
+// A single round on two states, held in Y0-Y3 and Y4-Y7, for use with
+// PERMUTE_X2.
+#define ROUND_X2() \
+	G2(Y0, Y1, Y2, Y3, Y15, Y14, Y4, Y5, Y6, Y7, Y11, Y10, Y13, Y12) \
+	DIAGONALIZE(Y0, Y1, Y2, Y3)                                      \
+	DIAGONALIZE(Y4, Y5, Y6, Y7)                                      \
+	G2(Y0, Y1, Y2, Y3, Y15, Y14, Y4, Y5, Y6, Y7, Y11, Y10, Y13, Y12) \
+	UNDIAGONALIZE(Y0, Y1, Y2, Y3)                                    \
+	UNDIAGONALIZE(Y4, Y5, Y6, Y7)
+
+#endif
+
+// func initLnAVX2(s *uint64, key, nonce *byte, initConsts, instConsts *uint64)
+TEXT INIT_FN, NOSPLIT, $0-40
+	MOVQ s+0(FP), R8
+	MOVQ key+8(FP), R9
+	MOVQ nonce+16(FP), R10
+	MOVQ initConsts+24(FP), R11
+	MOVQ instConsts+32(FP), R12
+
+	VMOVDQU (R10), Y0
+	VMOVDQU (R9), Y1
+	VMOVDQU (R11), Y2
+	VMOVDQU 32(R11), Y3
+
+	VMOVDQU (R12), Y4
+	VMOVDQA Y1, Y5
+
+	VPXOR Y3, Y4, Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+	PERMUTE()
+
+	VPXOR Y3, Y5, Y3
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VZEROUPPER
+	RET
+
+// func absorbBlocksLnAVX2(s *uint64, in *byte, blocks uint64, tag *uint64)
+TEXT ABSORB_BLOCKS_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ in+8(FP), R10
+	MOVQ blocks+16(FP), R12
+	MOVQ tag+24(FP), R13
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+	VMOVDQU (R13), Y11
+
+loopblocks:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VMOVDQU (R10), Y4
+	VMOVDQU 32(R10), Y5
+	VMOVDQU 64(R10), Y6
+
+	VPXOR Y0, Y4, Y0
+	VPXOR Y1, Y5, Y1
+	VPXOR Y2, Y6, Y2
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+
+	ADDQ $96, R10
+
+	SUBQ $1, R12
+	JNZ  loopblocks
+
+	VMOVDQU Y3, 96(R8)
+
+	VZEROUPPER
+	RET
+
+// func encryptBlocksLnAVX2(s *uint64, out, in *byte, blocks uint64)
+TEXT ENCRYPT_BLOCKS_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ in+16(FP), R10
+	MOVQ blocks+24(FP), R12
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+	VMOVDQU ·tag_payload<>(SB), Y11
+
+loopblocks:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VMOVDQU (R10), Y4
+	VMOVDQU 32(R10), Y5
+	VMOVDQU 64(R10), Y6
+
+	VPXOR Y0, Y4, Y0
+	VPXOR Y1, Y5, Y1
+	VPXOR Y2, Y6, Y2
+
+	VMOVDQU Y0, (R9)
+	VMOVDQU Y1, 32(R9)
+	VMOVDQU Y2, 64(R9)
+
+	ADDQ $96, R9
+	ADDQ $96, R10
+
+	SUBQ $1, R12
+	JNZ  loopblocks
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VZEROUPPER
+	RET
+
+// func decryptBlocksLnAVX2(s *uint64, out, in *byte, blocks uint64)
+TEXT DECRYPT_BLOCKS_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ in+16(FP), R10
+	MOVQ blocks+24(FP), R12
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+	VMOVDQU ·tag_payload<>(SB), Y11
+
+loopblocks:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VMOVDQU (R10), Y4
+	VMOVDQU 32(R10), Y5
+	VMOVDQU 64(R10), Y6
+
+	VPXOR Y0, Y4, Y0
+	VPXOR Y1, Y5, Y1
+	VPXOR Y2, Y6, Y2
+
+	VMOVDQU Y0, (R9)
+	VMOVDQU Y1, 32(R9)
+	VMOVDQU Y2, 64(R9)
+
+	VMOVDQA Y4, Y0
+	VMOVDQA Y5, Y1
+	VMOVDQA Y6, Y2
+
+	ADDQ $96, R9
+	ADDQ $96, R10
+
+	SUBQ $1, R12
+	JNZ  loopblocks
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VZEROUPPER
+	RET
+
+// func decryptLastBlockLnAVX2(s *uint64, out, in *byte, inLen uint64)
+TEXT DECRYPT_LAST_BLOCK_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ in+16(FP), R10
+	MOVQ inLen+24(FP), R12
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+	VMOVDQU ·tag_payload<>(SB), Y11
+
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VMOVDQU Y0, (R9)
+	VMOVDQU Y1, 32(R9)
+	VMOVDQU Y2, 64(R9)
+
+	CMPQ R12, $0
+	JEQ  skipcopy
+	XORQ AX, AX
+
+loopcopy:
+	MOVB (R10)(AX*1), BX
+	MOVB BX, (R9)(AX*1)
+	ADDQ $1, AX
+	CMPQ AX, R12
+	JNE  loopcopy
+
+skipcopy:
+
+	XORB $0x01, (R9)(R12*1)
+	XORB $0x80, 95(R9)
+
+	VMOVDQU (R9), Y4
+	VMOVDQU 32(R9), Y5
+	VMOVDQU 64(R9), Y6
+
+	VPXOR Y0, Y4, Y0
+	VPXOR Y1, Y5, Y1
+	VPXOR Y2, Y6, Y2
+
+	VMOVDQU Y0, (R9)
+	VMOVDQU Y1, 32(R9)
+	VMOVDQU Y2, 64(R9)
+
+	VMOVDQU Y4, (R8)
+	VMOVDQU Y5, 32(R8)
+	VMOVDQU Y6, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VZEROUPPER
+	RET
+
+// func finalizeLnAVX2(s *uint64, out, key *byte)
+TEXT FINALIZE_FN, NOSPLIT, $0-24
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ key+16(FP), R10
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+	VMOVDQU ·tag_final<>(SB), Y11
+
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VMOVDQU (R10), Y11
+	VPXOR   Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR   Y3, Y11, Y3
+	VMOVDQU Y3, (R9)
+
+	VZEROUPPER
+	RET
+
+// The fused routines process an entire small message in a single call, with
+// the state held in registers throughout.  The header, payload and trailer
+// are passed as a contiguous run of pre-padded blocks, with the output
+// written back to the payload blocks in place.
+
+// func sealSmallLnAVX2(key, nonce *byte, instConsts *uint64, blocks *byte, hBlocks, mBlocks, tBlocks uint64, tag *byte)
+TEXT SEAL_SMALL_FN, NOSPLIT, $0-64
+	MOVQ key+0(FP), R9
+	MOVQ nonce+8(FP), R10
+	MOVQ instConsts+16(FP), R12
+	MOVQ blocks+24(FP), R13
+	MOVQ hBlocks+32(FP), CX
+	MOVQ mBlocks+40(FP), DX
+	MOVQ tBlocks+48(FP), BX
+	MOVQ tag+56(FP), R8
+
+	VMOVDQU (R10), Y0
+	VMOVDQU (R9), Y1
+	VMOVDQU ·initializationConstants+64(SB), Y2
+	VMOVDQU ·initializationConstants+96(SB), Y3
+
+	VMOVDQU (R12), Y4
+	VMOVDQA Y1, Y10
+
+	VPXOR Y3, Y4, Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+	// Initialization.
+	PERMUTE()
+
+	VPXOR Y3, Y10, Y3
+
+	// Header.
+	TESTQ CX, CX
+	JZ    payload
+	VMOVDQU ·tag_header<>(SB), Y11
+
+loopheader:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR (R13), Y0, Y0
+	VPXOR 32(R13), Y1, Y1
+	VPXOR 64(R13), Y2, Y2
+
+	ADDQ $96, R13
+
+	SUBQ $1, CX
+	JNZ  loopheader
+
+payload:
+	// Payload.
+	TESTQ DX, DX
+	JZ    trailer
+	VMOVDQU ·tag_payload<>(SB), Y11
+
+looppayload:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR (R13), Y0, Y0
+	VPXOR 32(R13), Y1, Y1
+	VPXOR 64(R13), Y2, Y2
+
+	VMOVDQU Y0, (R13)
+	VMOVDQU Y1, 32(R13)
+	VMOVDQU Y2, 64(R13)
+
+	ADDQ $96, R13
+
+	SUBQ $1, DX
+	JNZ  looppayload
+
+trailer:
+	// Trailer.
+	TESTQ BX, BX
+	JZ    finalize
+	VMOVDQU ·tag_trailer<>(SB), Y11
+
+looptrailer:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR (R13), Y0, Y0
+	VPXOR 32(R13), Y1, Y1
+	VPXOR 64(R13), Y2, Y2
+
+	ADDQ $96, R13
+
+	SUBQ $1, BX
+	JNZ  looptrailer
+
+finalize:
+	// Finalization.
+	VMOVDQU ·tag_final<>(SB), Y11
+	VPXOR   Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR Y3, Y10, Y3
+
+	PERMUTE()
+
+	VPXOR   Y3, Y10, Y3
+	VMOVDQU Y3, (R8)
+
+	VZEROUPPER
+	RET
+
+// func openSmallLnAVX2(key, nonce *byte, instConsts *uint64, blocks *byte, hBlocks, mBlocks, tBlocks, lastLen uint64, tag *byte)
+TEXT OPEN_SMALL_FN, NOSPLIT, $0-72
+	MOVQ key+0(FP), R9
+	MOVQ nonce+8(FP), R10
+	MOVQ instConsts+16(FP), R12
+	MOVQ blocks+24(FP), R13
+	MOVQ hBlocks+32(FP), CX
+	MOVQ mBlocks+40(FP), DX
+	MOVQ tBlocks+48(FP), BX
+	MOVQ lastLen+56(FP), DI
+	MOVQ tag+64(FP), R8
+
+	// The mask for the full blocks is all 1s, the mask for the last block
+	// only covers the lastLen bytes of actual ciphertext.
+	LEAQ ·block_mask<>(SB), R14
+	MOVQ R14, SI
+	ADDQ $96, SI
+	SUBQ DI, SI
+	MOVQ SI, DI
+
+	VMOVDQU (R10), Y0
+	VMOVDQU (R9), Y1
+	VMOVDQU ·initializationConstants+64(SB), Y2
+	VMOVDQU ·initializationConstants+96(SB), Y3
+
+	VMOVDQU (R12), Y4
+	VMOVDQA Y1, Y10
+
+	VPXOR Y3, Y4, Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+	// Initialization.
+	PERMUTE()
+
+	VPXOR Y3, Y10, Y3
+
+	// Header.
+	TESTQ CX, CX
+	JZ    payload
+	VMOVDQU ·tag_header<>(SB), Y11
+
+loopheader:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR (R13), Y0, Y0
+	VPXOR 32(R13), Y1, Y1
+	VPXOR 64(R13), Y2, Y2
+
+	ADDQ $96, R13
+
+	SUBQ $1, CX
+	JNZ  loopheader
+
+payload:
+	// Payload.
+	//
+	// The ciphertext blocks are padded exactly as plaintext blocks would
+	// be, so with B as the ciphertext block and M as the mask:
+	//
+	//   P = S ^ B
+	//   S = S ^ (P & M) ^ (B &^ M)
+	TESTQ DX, DX
+	JZ    trailer
+	VMOVDQU ·tag_payload<>(SB), Y11
+
+looppayload:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	MOVQ    R14, SI
+	CMPQ    DX, $1
+	CMOVQEQ DI, SI
+
+	VMOVDQU (R13), Y4
+	VMOVDQU 32(R13), Y5
+	VMOVDQU 64(R13), Y6
+	VMOVDQU (SI), Y7
+	VMOVDQU 32(SI), Y8
+	VMOVDQU 64(SI), Y9
+
+	VPXOR   Y0, Y4, Y14
+	VMOVDQU Y14, (R13)
+	VPAND   Y14, Y7, Y14
+	VPANDN  Y4, Y7, Y15
+	VPXOR   Y0, Y14, Y0
+	VPXOR   Y0, Y15, Y0
+
+	VPXOR   Y1, Y5, Y14
+	VMOVDQU Y14, 32(R13)
+	VPAND   Y14, Y8, Y14
+	VPANDN  Y5, Y8, Y15
+	VPXOR   Y1, Y14, Y1
+	VPXOR   Y1, Y15, Y1
+
+	VPXOR   Y2, Y6, Y14
+	VMOVDQU Y14, 64(R13)
+	VPAND   Y14, Y9, Y14
+	VPANDN  Y6, Y9, Y15
+	VPXOR   Y2, Y14, Y2
+	VPXOR   Y2, Y15, Y2
+
+	ADDQ $96, R13
+
+	SUBQ $1, DX
+	JNZ  looppayload
+
+trailer:
+	// Trailer.
+	TESTQ BX, BX
+	JZ    finalize
+	VMOVDQU ·tag_trailer<>(SB), Y11
+
+looptrailer:
+	VPXOR Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR (R13), Y0, Y0
+	VPXOR 32(R13), Y1, Y1
+	VPXOR 64(R13), Y2, Y2
+
+	ADDQ $96, R13
+
+	SUBQ $1, BX
+	JNZ  looptrailer
+
+finalize:
+	// Finalization.
+	VMOVDQU ·tag_final<>(SB), Y11
+	VPXOR   Y3, Y11, Y3
+
+	PERMUTE()
+
+	VPXOR Y3, Y10, Y3
+
+	PERMUTE()
+
+	VPXOR   Y3, Y10, Y3
+	VMOVDQU Y3, (R8)
+
+	VZEROUPPER
+	RET
+
+// func permuteLnAVX2(s *uint64)
+TEXT PERMUTE_FN, NOSPLIT, $0-8
+	MOVQ s+0(FP), R8
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+	PERMUTE()
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VZEROUPPER
+	RET
+
+// func permuteX2LnAVX2(s0, s1 *uint64)
+TEXT PERMUTE_X2_FN, NOSPLIT, $0-16
+	MOVQ s0+0(FP), R8
+	MOVQ s1+8(FP), R9
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU (R9), Y4
+	VMOVDQU 32(R9), Y5
+	VMOVDQU 64(R9), Y6
+	VMOVDQU 96(R9), Y7
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+	PERMUTE_X2()
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VMOVDQU Y4, (R9)
+	VMOVDQU Y5, 32(R9)
+	VMOVDQU Y6, 64(R9)
+	VMOVDQU Y7, 96(R9)
+
+	VZEROUPPER
+	RET
+
+// func encryptBlocksX2LnAVX2(s0, s1 *uint64, out0, in0, out1, in1 *byte, blocks uint64)
+TEXT ENCRYPT_BLOCKS_X2_FN, NOSPLIT, $0-56
+	MOVQ s0+0(FP), R8
+	MOVQ s1+8(FP), R9
+	MOVQ out0+16(FP), R10
+	MOVQ in0+24(FP), R11
+	MOVQ out1+32(FP), R12
+	MOVQ in1+40(FP), R13
+	MOVQ blocks+48(FP), CX
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU (R9), Y4
+	VMOVDQU 32(R9), Y5
+	VMOVDQU 64(R9), Y6
+	VMOVDQU 96(R9), Y7
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+loopblocks:
+	VPXOR ·tag_payload<>(SB), Y3, Y3
+	VPXOR ·tag_payload<>(SB), Y7, Y7
+
+	PERMUTE_X2()
+
+	VPXOR   (R11), Y0, Y0
+	VMOVDQU Y0, (R10)
+	VPXOR   32(R11), Y1, Y1
+	VMOVDQU Y1, 32(R10)
+	VPXOR   64(R11), Y2, Y2
+	VMOVDQU Y2, 64(R10)
+
+	VPXOR   (R13), Y4, Y4
+	VMOVDQU Y4, (R12)
+	VPXOR   32(R13), Y5, Y5
+	VMOVDQU Y5, 32(R12)
+	VPXOR   64(R13), Y6, Y6
+	VMOVDQU Y6, 64(R12)
+
+	ADDQ $96, R10
+	ADDQ $96, R11
+	ADDQ $96, R12
+	ADDQ $96, R13
+
+	SUBQ $1, CX
+	JNZ  loopblocks
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VMOVDQU Y4, (R9)
+	VMOVDQU Y5, 32(R9)
+	VMOVDQU Y6, 64(R9)
+	VMOVDQU Y7, 96(R9)
+
+	VZEROUPPER
+	RET
+
+// func decryptBlocksX2LnAVX2(s0, s1 *uint64, out0, in0, out1, in1 *byte, blocks uint64)
+TEXT DECRYPT_BLOCKS_X2_FN, NOSPLIT, $0-56
+	MOVQ s0+0(FP), R8
+	MOVQ s1+8(FP), R9
+	MOVQ out0+16(FP), R10
+	MOVQ in0+24(FP), R11
+	MOVQ out1+32(FP), R12
+	MOVQ in1+40(FP), R13
+	MOVQ blocks+48(FP), CX
+
+	VMOVDQU (R8), Y0
+	VMOVDQU 32(R8), Y1
+	VMOVDQU 64(R8), Y2
+	VMOVDQU 96(R8), Y3
+
+	VMOVDQU (R9), Y4
+	VMOVDQU 32(R9), Y5
+	VMOVDQU 64(R9), Y6
+	VMOVDQU 96(R9), Y7
+
+	VMOVDQU ·vpshufb_idx_r0<>(SB), Y13
+	VMOVDQU ·vpshufb_idx_r2<>(SB), Y12
+
+loopblocks:
+	VPXOR ·tag_payload<>(SB), Y3, Y3
+	VPXOR ·tag_payload<>(SB), Y7, Y7
+
+	PERMUTE_X2()
+
+	VMOVDQU (R11), Y14
+	VPXOR   Y0, Y14, Y15
+	VMOVDQU Y15, (R10)
+	VMOVDQA Y14, Y0
+	VMOVDQU 32(R11), Y14
+	VPXOR   Y1, Y14, Y15
+	VMOVDQU Y15, 32(R10)
+	VMOVDQA Y14, Y1
+	VMOVDQU 64(R11), Y14
+	VPXOR   Y2, Y14, Y15
+	VMOVDQU Y15, 64(R10)
+	VMOVDQA Y14, Y2
+
+	VMOVDQU (R13), Y14
+	VPXOR   Y4, Y14, Y15
+	VMOVDQU Y15, (R12)
+	VMOVDQA Y14, Y4
+	VMOVDQU 32(R13), Y14
+	VPXOR   Y5, Y14, Y15
+	VMOVDQU Y15, 32(R12)
+	VMOVDQA Y14, Y5
+	VMOVDQU 64(R13), Y14
+	VPXOR   Y6, Y14, Y15
+	VMOVDQU Y15, 64(R12)
+	VMOVDQA Y14, Y6
+
+	ADDQ $96, R10
+	ADDQ $96, R11
+	ADDQ $96, R12
+	ADDQ $96, R13
+
+	SUBQ $1, CX
+	JNZ  loopblocks
+
+	VMOVDQU Y0, (R8)
+	VMOVDQU Y1, 32(R8)
+	VMOVDQU Y2, 64(R8)
+	VMOVDQU Y3, 96(R8)
+
+	VMOVDQU Y4, (R9)
+	VMOVDQU Y5, 32(R9)
+	VMOVDQU Y6, 64(R9)
+	VMOVDQU Y7, 96(R9)
+
+	VZEROUPPER
+	RET
@@ -5,10 +5,63 @@
 // Commons "CC0" public domain dedication. See LICENSE or
 // <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
 
-// +build !amd64 gccgo noasm !go1.10
+// +build !amd64,!386 gccgo noasm !go1.10
 
 package norx
 
-func initHardwareAcceleration() {
-	forceDisableHardwareAcceleration()
+func supportedHardwareAccelImpls() []*hwaccelImpl {
+	return nil
+}
+
+func sealSmall(p *permutation, out, a, m, z, nonce, key []byte) bool {
+	return false
+}
+
+func openSmall(p *permutation, out, a, c, z, nonce, key, tag []byte) bool {
+	return false
+}
+
+func (s *state) init(key, nonce []byte) {
+	initRef(s, key, nonce)
+}
+
+func (s *state) absorbData(in []byte, tag uint64) {
+	absorbDataRef(s, in, tag)
+}
+
+func (s *state) encryptData(out, in []byte) {
+	encryptDataRef(s, out, in)
+}
+
+func (s *state) decryptData(out, in []byte) {
+	decryptDataRef(s, out, in)
+}
+
+func (s *state) encryptBlocks(out, in []byte) {
+	encryptBlocksRef(s, out, in)
+}
+
+func (s *state) decryptBlocks(out, in []byte) {
+	decryptBlocksRef(s, out, in)
+}
+
+func (s *state) finalize(tag, key []byte) {
+	finalizeRef(s, tag, key)
+}
+
+func (s *state) permute() {
+	permuteRef(s)
+}
+
+func permuteX2(s0, s1 *state) {
+	s0.permute()
+	s1.permute()
+}
+
+func cryptBlocksX2(s0, s1 *state, out0, in0, out1, in1 []byte, blocks int, decrypt bool) bool {
+	return false
+}
+
+func isMultiBufferAccelerated() bool {
+	return false
 }
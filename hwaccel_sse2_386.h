@@ -0,0 +1,397 @@
+// hwaccel_sse2_386.h - 386 SSE2 optimized routines
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// This is included by permute_sse2_386.s once per round count, with
+// PERMUTE defined as the matching permutation, and the *_FN macros defined
+// as the entry point names.
+
+#ifndef HWACCEL_SSE2_386_H
+#define HWACCEL_SSE2_386_H
+
+// There are only 8 XMM registers on 386, which is exactly enough to hold
+// the state, with nothing left over.  Instead, the state is kept in memory,
+// and each pair of G invocations (as 2x64 bit vectors) loads the relevant
+// words, does the computation, and writes the result back.
+//
+// All of the columns and diagonals can be loaded with a single unaligned
+// load, with the exception of (S[15], S[12]) and (S[7], S[4]), which are
+// assembled from two halves.
+//
+// SSSE3 is not assumed to be present, so all of the rotations are done
+// with shifts.
+
+#define H(A, B, T0, T1) \
+	MOVO  A, T0 \
+	PXOR  B, T0 \
+	MOVO  A, T1 \
+	PAND  B, T1 \
+	PADDQ T1, T1 \
+	MOVO  T0, A \
+	PXOR  T1, A
+
+#define ROTR(A, N, M, T) \
+	MOVO  A, T  \
+	PSRLQ $N, T \
+	PSLLQ $M, A \
+	POR   T, A
+
+#define G(A, B, C, D, T0, T1) \
+	H(A, B, T0, T1)      \
+	PXOR A, D            \
+	ROTR(D, 8, 56, T0)   \
+	                     \
+	H(C, D, T0, T1)      \
+	PXOR C, B            \
+	ROTR(B, 19, 45, T0)  \
+	                     \
+	H(A, B, T0, T1)      \
+	PXOR A, D            \
+	ROTR(D, 40, 24, T0)  \
+	                     \
+	H(C, D, T0, T1)      \
+	PXOR C, B            \
+	ROTR(B, 63, 1, T0)
+
+// A single round on the state at S, for use with PERMUTE.
+#define ROUND(S) \
+	MOVOU  (S), X0                  \
+	MOVOU  32(S), X1                \
+	MOVOU  64(S), X2                \
+	MOVOU  96(S), X3                \
+	G(X0, X1, X2, X3, X4, X5)       \
+	MOVOU  X0, (S)                  \
+	MOVOU  X1, 32(S)                \
+	MOVOU  X2, 64(S)                \
+	MOVOU  X3, 96(S)                \
+	                                \
+	MOVOU  16(S), X0                \
+	MOVOU  48(S), X1                \
+	MOVOU  80(S), X2                \
+	MOVOU  112(S), X3               \
+	G(X0, X1, X2, X3, X4, X5)       \
+	MOVOU  X0, 16(S)                \
+	MOVOU  X1, 48(S)                \
+	MOVOU  X2, 80(S)                \
+	MOVOU  X3, 112(S)               \
+	                                \
+	MOVOU  (S), X0                  \
+	MOVOU  40(S), X1                \
+	MOVOU  80(S), X2                \
+	MOVQ   120(S), X3               \
+	MOVHPD 96(S), X3                \
+	G(X0, X1, X2, X3, X4, X5)       \
+	MOVOU  X0, (S)                  \
+	MOVOU  X1, 40(S)                \
+	MOVOU  X2, 80(S)                \
+	MOVQ   X3, 120(S)               \
+	MOVHPD X3, 96(S)                \
+	                                \
+	MOVOU  16(S), X0                \
+	MOVQ   56(S), X1                \
+	MOVHPD 32(S), X1                \
+	MOVOU  64(S), X2                \
+	MOVOU  104(S), X3               \
+	G(X0, X1, X2, X3, X4, X5)       \
+	MOVOU  X0, 16(S)                \
+	MOVQ   X1, 56(S)                \
+	MOVHPD X1, 32(S)                \
+	MOVOU  X2, 64(S)                \
+	MOVOU  X3, 104(S)
+
+// XOR 32 bytes from K into S[12:16].
+#define XOR_KEY(S, K) \
+	MOVOU (K), X0    \
+	MOVOU 16(K), X1  \
+	MOVOU 96(S), X2  \
+	MOVOU 112(S), X3 \
+	PXOR  X0, X2     \
+	PXOR  X1, X3     \
+	MOVOU X2, 96(S)  \
+	MOVOU X3, 112(S)
+
+#endif
+
+// func initStateLnXMM(s *uint64, key, nonce *byte, initConsts, instConsts *uint64)
+TEXT INIT_STATE_FN, NOSPLIT, $0-20
+	MOVL s+0(FP), DI
+	MOVL key+4(FP), SI
+	MOVL nonce+8(FP), DX
+	MOVL initConsts+12(FP), BX
+	MOVL instConsts+16(FP), CX
+
+	MOVOU (DX), X0
+	MOVOU 16(DX), X1
+	MOVOU X0, (DI)
+	MOVOU X1, 16(DI)
+
+	MOVOU (SI), X0
+	MOVOU 16(SI), X1
+	MOVOU X0, 32(DI)
+	MOVOU X1, 48(DI)
+
+	MOVOU (BX), X0
+	MOVOU 16(BX), X1
+	MOVOU X0, 64(DI)
+	MOVOU X1, 80(DI)
+
+	MOVOU 32(BX), X0
+	MOVOU 48(BX), X1
+	MOVOU (CX), X2
+	MOVOU 16(CX), X3
+	PXOR  X2, X0
+	PXOR  X3, X1
+	MOVOU X0, 96(DI)
+	MOVOU X1, 112(DI)
+
+	PERMUTE(DI)
+
+	XOR_KEY(DI, SI)
+
+	RET
+
+// func absorbBlocksLnXMM(s *uint64, in *byte, blocks uint64, tag *uint64)
+TEXT ABSORB_BLOCKS_FN, NOSPLIT, $0-20
+	MOVL s+0(FP), DI
+	MOVL in+4(FP), SI
+	MOVL blocks_lo+8(FP), CX
+	MOVL tag+16(FP), DX
+	MOVL 24(DX), DX
+
+loopblocks:
+	XORL DX, 120(DI)
+
+	PERMUTE(DI)
+
+	MOVOU (SI), X0
+	MOVOU (DI), X1
+	PXOR  X0, X1
+	MOVOU X1, (DI)
+	MOVOU 16(SI), X0
+	MOVOU 16(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 16(DI)
+	MOVOU 32(SI), X0
+	MOVOU 32(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 32(DI)
+	MOVOU 48(SI), X0
+	MOVOU 48(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 48(DI)
+	MOVOU 64(SI), X0
+	MOVOU 64(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 64(DI)
+	MOVOU 80(SI), X0
+	MOVOU 80(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 80(DI)
+
+	ADDL $96, SI
+
+	DECL CX
+	JNZ  loopblocks
+
+	RET
+
+// func encryptBlocksLnXMM(s *uint64, out, in *byte, blocks uint64)
+TEXT ENCRYPT_BLOCKS_FN, NOSPLIT, $0-20
+	MOVL s+0(FP), DI
+	MOVL out+4(FP), BX
+	MOVL in+8(FP), SI
+	MOVL blocks_lo+12(FP), CX
+
+loopblocks:
+	XORL $0x02, 120(DI)
+
+	PERMUTE(DI)
+
+	MOVOU (SI), X0
+	MOVOU (DI), X1
+	PXOR  X0, X1
+	MOVOU X1, (DI)
+	MOVOU X1, (BX)
+	MOVOU 16(SI), X0
+	MOVOU 16(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 16(DI)
+	MOVOU X1, 16(BX)
+	MOVOU 32(SI), X0
+	MOVOU 32(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 32(DI)
+	MOVOU X1, 32(BX)
+	MOVOU 48(SI), X0
+	MOVOU 48(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 48(DI)
+	MOVOU X1, 48(BX)
+	MOVOU 64(SI), X0
+	MOVOU 64(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 64(DI)
+	MOVOU X1, 64(BX)
+	MOVOU 80(SI), X0
+	MOVOU 80(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 80(DI)
+	MOVOU X1, 80(BX)
+
+	ADDL $96, BX
+	ADDL $96, SI
+
+	DECL CX
+	JNZ  loopblocks
+
+	RET
+
+// func decryptBlocksLnXMM(s *uint64, out, in *byte, blocks uint64)
+TEXT DECRYPT_BLOCKS_FN, NOSPLIT, $0-20
+	MOVL s+0(FP), DI
+	MOVL out+4(FP), BX
+	MOVL in+8(FP), SI
+	MOVL blocks_lo+12(FP), CX
+
+loopblocks:
+	XORL $0x02, 120(DI)
+
+	PERMUTE(DI)
+
+	MOVOU (SI), X0
+	MOVOU (DI), X1
+	PXOR  X0, X1
+	MOVOU X1, (BX)
+	MOVOU X0, (DI)
+	MOVOU 16(SI), X0
+	MOVOU 16(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 16(BX)
+	MOVOU X0, 16(DI)
+	MOVOU 32(SI), X0
+	MOVOU 32(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 32(BX)
+	MOVOU X0, 32(DI)
+	MOVOU 48(SI), X0
+	MOVOU 48(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 48(BX)
+	MOVOU X0, 48(DI)
+	MOVOU 64(SI), X0
+	MOVOU 64(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 64(BX)
+	MOVOU X0, 64(DI)
+	MOVOU 80(SI), X0
+	MOVOU 80(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 80(BX)
+	MOVOU X0, 80(DI)
+
+	ADDL $96, BX
+	ADDL $96, SI
+
+	DECL CX
+	JNZ  loopblocks
+
+	RET
+
+// func decryptLastBlockLnXMM(s *uint64, out, in *byte, inLen uint64)
+TEXT DECRYPT_LAST_BLOCK_FN, NOSPLIT, $0-20
+	MOVL s+0(FP), DI
+	MOVL out+4(FP), BX
+	MOVL in+8(FP), SI
+	MOVL inLen_lo+12(FP), CX
+
+	XORL $0x02, 120(DI)
+
+	PERMUTE(DI)
+
+	MOVOU (DI), X0
+	MOVOU X0, (BX)
+	MOVOU 16(DI), X0
+	MOVOU X0, 16(BX)
+	MOVOU 32(DI), X0
+	MOVOU X0, 32(BX)
+	MOVOU 48(DI), X0
+	MOVOU X0, 48(BX)
+	MOVOU 64(DI), X0
+	MOVOU X0, 64(BX)
+	MOVOU 80(DI), X0
+	MOVOU X0, 80(BX)
+
+	CMPL CX, $0
+	JEQ  skipcopy
+	XORL AX, AX
+
+loopcopy:
+	MOVB (SI)(AX*1), DX
+	MOVB DX, (BX)(AX*1)
+	INCL AX
+	CMPL AX, CX
+	JNE  loopcopy
+
+skipcopy:
+
+	XORB $0x01, (BX)(CX*1)
+	XORB $0x80, 95(BX)
+
+	MOVOU (BX), X0
+	MOVOU (DI), X1
+	PXOR  X0, X1
+	MOVOU X1, (BX)
+	MOVOU X0, (DI)
+	MOVOU 16(BX), X0
+	MOVOU 16(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 16(BX)
+	MOVOU X0, 16(DI)
+	MOVOU 32(BX), X0
+	MOVOU 32(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 32(BX)
+	MOVOU X0, 32(DI)
+	MOVOU 48(BX), X0
+	MOVOU 48(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 48(BX)
+	MOVOU X0, 48(DI)
+	MOVOU 64(BX), X0
+	MOVOU 64(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 64(BX)
+	MOVOU X0, 64(DI)
+	MOVOU 80(BX), X0
+	MOVOU 80(DI), X1
+	PXOR  X0, X1
+	MOVOU X1, 80(BX)
+	MOVOU X0, 80(DI)
+
+	RET
+
+// func finalizeStateLnXMM(s *uint64, out, key *byte)
+TEXT FINALIZE_STATE_FN, NOSPLIT, $0-12
+	MOVL s+0(FP), DI
+	MOVL out+4(FP), BX
+	MOVL key+8(FP), SI
+
+	XORL $0x08, 120(DI)
+
+	PERMUTE(DI)
+
+	XOR_KEY(DI, SI)
+
+	PERMUTE(DI)
+
+	XOR_KEY(DI, SI)
+
+	MOVOU 96(DI), X0
+	MOVOU 112(DI), X1
+	MOVOU X0, (BX)
+	MOVOU X1, 16(BX)
+
+	RET
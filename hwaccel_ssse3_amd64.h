@@ -0,0 +1,409 @@
+// hwaccel_ssse3_amd64.h - AMD64 SSSE3 optimized routines
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// This is included by permute_ssse3_amd64.s once per round count, with
+// PERMUTE defined as the matching permutation, and the *_FN macros defined
+// as the entry point names.
+
+#ifndef HWACCEL_SSSE3_AMD64_H
+#define HWACCEL_SSSE3_AMD64_H
+
+// The SSSE3 code is the same algorithm as the AVX2 code, except that each
+// row of the state is split across a pair of XMM registers.  The column
+// step therefore is two invocations of G (left and right halves), and the
+// (un)diagonalization is done with PALIGNR instead of VPERMQ.
+//
+// Register usage (for the permutation):
+//   X0 - X7   State (X0 = S[0:2], X1 = S[2:4], ..., X7 = S[14:16])
+//   X8 - X9   G temporaries
+//   X10 - X11 PSHUFB indexes for R0, R2
+//   X12 - X13 (Un)diagonalization temporaries
+
+DATA ·pshufb_idx_r0<>+0x00(SB)/8, $0x0007060504030201
+DATA ·pshufb_idx_r0<>+0x08(SB)/8, $0x080f0e0d0c0b0a09
+GLOBL ·pshufb_idx_r0<>(SB), (NOPTR+RODATA), $16
+
+DATA ·pshufb_idx_r2<>+0x00(SB)/8, $0x0403020100070605
+DATA ·pshufb_idx_r2<>+0x08(SB)/8, $0x0c0b0a09080f0e0d
+GLOBL ·pshufb_idx_r2<>(SB), (NOPTR+RODATA), $16
+
+DATA ·xmm_tag_payload<>+0x00(SB)/8, $0x0000000000000000
+DATA ·xmm_tag_payload<>+0x08(SB)/8, $0x0000000000000002
+GLOBL ·xmm_tag_payload<>(SB), (NOPTR+RODATA), $16
+
+DATA ·xmm_tag_final<>+0x00(SB)/8, $0x0000000000000000
+DATA ·xmm_tag_final<>+0x08(SB)/8, $0x0000000000000008
+GLOBL ·xmm_tag_final<>(SB), (NOPTR+RODATA), $16
+
+#define H(A, B, T0, T1) \
+	MOVO  A, T0 \
+	PXOR  B, T0 \
+	MOVO  A, T1 \
+	PAND  B, T1 \
+	PADDQ T1, T1 \
+	MOVO  T0, A \
+	PXOR  T1, A
+
+#define G(A, B, C, D, T0, T1, R0, R2) \
+	H(A, B, T0, T1)    \
+	PXOR   A, D        \
+	PSHUFB R0, D       \
+	                   \
+	H(C, D, T0, T1)    \
+	PXOR   C, B        \
+	MOVO   B, T0       \
+	PSRLQ  $19, T0     \
+	PSLLQ  $45, B      \
+	POR    T0, B       \
+	                   \
+	H(A, B, T0, T1)    \
+	PXOR   A, D        \
+	PSHUFB R2, D       \
+	                   \
+	H(C, D, T0, T1)    \
+	PXOR   C, B        \
+	MOVO   B, T0       \
+	PSRLQ  $63, T0     \
+	PADDQ  B, B        \
+	POR    T0, B
+
+// B = B <<< 1, C = C <<< 2, D = D <<< 3 (in words).
+#define DIAGONALIZE(B0, B1, C0, C1, D0, D1, T0, T1) \
+	MOVO    B1, T0    \
+	PALIGNR $8, B0, T0 \
+	MOVO    B0, T1    \
+	PALIGNR $8, B1, T1 \
+	MOVO    T0, B0    \
+	MOVO    T1, B1    \
+	                  \
+	MOVO    C0, T0    \
+	MOVO    C1, C0    \
+	MOVO    T0, C1    \
+	                  \
+	MOVO    D0, T0    \
+	PALIGNR $8, D1, T0 \
+	MOVO    D1, T1    \
+	PALIGNR $8, D0, T1 \
+	MOVO    T0, D0    \
+	MOVO    T1, D1
+
+// B = B >>> 1, C = C >>> 2, D = D >>> 3 (in words).
+#define UNDIAGONALIZE(B0, B1, C0, C1, D0, D1, T0, T1) \
+	MOVO    B0, T0    \
+	PALIGNR $8, B1, T0 \
+	MOVO    B1, T1    \
+	PALIGNR $8, B0, T1 \
+	MOVO    T0, B0    \
+	MOVO    T1, B1    \
+	                  \
+	MOVO    C0, T0    \
+	MOVO    C1, C0    \
+	MOVO    T0, C1    \
+	                  \
+	MOVO    D1, T0    \
+	PALIGNR $8, D0, T0 \
+	MOVO    D0, T1    \
+	PALIGNR $8, D1, T1 \
+	MOVO    T0, D0    \
+	MOVO    T1, D1
+
+// A single round (column step and diagonal step) on the state in X0-X7,
+// with the rotation shuffles in X10 and X11, for use with PERMUTE.
+#define ROUND() \
+	G(X0, X2, X4, X6, X8, X9, X10, X11)           \
+	G(X1, X3, X5, X7, X8, X9, X10, X11)           \
+	DIAGONALIZE(X2, X3, X4, X5, X6, X7, X12, X13) \
+	G(X0, X2, X4, X6, X8, X9, X10, X11)           \
+	G(X1, X3, X5, X7, X8, X9, X10, X11)           \
+	UNDIAGONALIZE(X2, X3, X4, X5, X6, X7, X12, X13)
+
+#define LOAD_STATE(S) \
+	MOVOU (S), X0    \
+	MOVOU 16(S), X1  \
+	MOVOU 32(S), X2  \
+	MOVOU 48(S), X3  \
+	MOVOU 64(S), X4  \
+	MOVOU 80(S), X5  \
+	MOVOU 96(S), X6  \
+	MOVOU 112(S), X7
+
+#define STORE_RATE(S) \
+	MOVOU X0, (S)    \
+	MOVOU X1, 16(S)  \
+	MOVOU X2, 32(S)  \
+	MOVOU X3, 48(S)  \
+	MOVOU X4, 64(S)  \
+	MOVOU X5, 80(S)
+
+#define STORE_STATE(S) \
+	STORE_RATE(S)    \
+	MOVOU X6, 96(S)  \
+	MOVOU X7, 112(S)
+
+#define LOAD_SHUFFLES() \
+	MOVOU ·pshufb_idx_r0<>(SB), X10 \
+	MOVOU ·pshufb_idx_r2<>(SB), X11
+
+#endif
+
+// func initStateLnXMM(s *uint64, key, nonce *byte, initConsts, instConsts *uint64)
+TEXT INIT_STATE_FN, NOSPLIT, $0-40
+	MOVQ s+0(FP), R8
+	MOVQ key+8(FP), R9
+	MOVQ nonce+16(FP), R10
+	MOVQ initConsts+24(FP), R11
+	MOVQ instConsts+32(FP), R12
+
+	MOVOU (R10), X0
+	MOVOU 16(R10), X1
+	MOVOU (R9), X2
+	MOVOU 16(R9), X3
+	MOVOU (R11), X4
+	MOVOU 16(R11), X5
+	MOVOU 32(R11), X6
+	MOVOU 48(R11), X7
+
+	MOVOU (R12), X8
+	MOVOU 16(R12), X9
+	PXOR  X8, X6
+	PXOR  X9, X7
+
+	LOAD_SHUFFLES()
+
+	PERMUTE()
+
+	MOVOU (R9), X8
+	MOVOU 16(R9), X9
+	PXOR  X8, X6
+	PXOR  X9, X7
+
+	STORE_STATE(R8)
+
+	RET
+
+// func absorbBlocksLnXMM(s *uint64, in *byte, blocks uint64, tag *uint64)
+TEXT ABSORB_BLOCKS_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ in+8(FP), R10
+	MOVQ blocks+16(FP), R12
+	MOVQ tag+24(FP), R13
+
+	LOAD_STATE(R8)
+	LOAD_SHUFFLES()
+	MOVOU 16(R13), X14
+
+loopblocks:
+	PXOR X14, X7
+
+	PERMUTE()
+
+	MOVOU (R10), X8
+	PXOR  X8, X0
+	MOVOU 16(R10), X8
+	PXOR  X8, X1
+	MOVOU 32(R10), X8
+	PXOR  X8, X2
+	MOVOU 48(R10), X8
+	PXOR  X8, X3
+	MOVOU 64(R10), X8
+	PXOR  X8, X4
+	MOVOU 80(R10), X8
+	PXOR  X8, X5
+
+	ADDQ $96, R10
+
+	SUBQ $1, R12
+	JNZ  loopblocks
+
+	STORE_STATE(R8)
+
+	RET
+
+// func encryptBlocksLnXMM(s *uint64, out, in *byte, blocks uint64)
+TEXT ENCRYPT_BLOCKS_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ in+16(FP), R10
+	MOVQ blocks+24(FP), R12
+
+	LOAD_STATE(R8)
+	LOAD_SHUFFLES()
+	MOVOU ·xmm_tag_payload<>(SB), X14
+
+loopblocks:
+	PXOR X14, X7
+
+	PERMUTE()
+
+	MOVOU (R10), X8
+	PXOR  X8, X0
+	MOVOU 16(R10), X8
+	PXOR  X8, X1
+	MOVOU 32(R10), X8
+	PXOR  X8, X2
+	MOVOU 48(R10), X8
+	PXOR  X8, X3
+	MOVOU 64(R10), X8
+	PXOR  X8, X4
+	MOVOU 80(R10), X8
+	PXOR  X8, X5
+
+	STORE_RATE(R9)
+
+	ADDQ $96, R9
+	ADDQ $96, R10
+
+	SUBQ $1, R12
+	JNZ  loopblocks
+
+	STORE_STATE(R8)
+
+	RET
+
+// func decryptBlocksLnXMM(s *uint64, out, in *byte, blocks uint64)
+TEXT DECRYPT_BLOCKS_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ in+16(FP), R10
+	MOVQ blocks+24(FP), R12
+
+	LOAD_STATE(R8)
+	LOAD_SHUFFLES()
+	MOVOU ·xmm_tag_payload<>(SB), X14
+
+loopblocks:
+	PXOR X14, X7
+
+	PERMUTE()
+
+	MOVOU (R10), X8
+	PXOR  X8, X0
+	MOVOU X0, (R9)
+	MOVO  X8, X0
+	MOVOU 16(R10), X8
+	PXOR  X8, X1
+	MOVOU X1, 16(R9)
+	MOVO  X8, X1
+	MOVOU 32(R10), X8
+	PXOR  X8, X2
+	MOVOU X2, 32(R9)
+	MOVO  X8, X2
+	MOVOU 48(R10), X8
+	PXOR  X8, X3
+	MOVOU X3, 48(R9)
+	MOVO  X8, X3
+	MOVOU 64(R10), X8
+	PXOR  X8, X4
+	MOVOU X4, 64(R9)
+	MOVO  X8, X4
+	MOVOU 80(R10), X8
+	PXOR  X8, X5
+	MOVOU X5, 80(R9)
+	MOVO  X8, X5
+
+	ADDQ $96, R9
+	ADDQ $96, R10
+
+	SUBQ $1, R12
+	JNZ  loopblocks
+
+	STORE_STATE(R8)
+
+	RET
+
+// func decryptLastBlockLnXMM(s *uint64, out, in *byte, inLen uint64)
+TEXT DECRYPT_LAST_BLOCK_FN, NOSPLIT, $0-32
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ in+16(FP), R10
+	MOVQ inLen+24(FP), R12
+
+	LOAD_STATE(R8)
+	LOAD_SHUFFLES()
+	MOVOU ·xmm_tag_payload<>(SB), X14
+
+	PXOR X14, X7
+
+	PERMUTE()
+
+	STORE_RATE(R9)
+
+	CMPQ R12, $0
+	JEQ  skipcopy
+	XORQ AX, AX
+
+loopcopy:
+	MOVB (R10)(AX*1), BX
+	MOVB BX, (R9)(AX*1)
+	ADDQ $1, AX
+	CMPQ AX, R12
+	JNE  loopcopy
+
+skipcopy:
+
+	XORB $0x01, (R9)(R12*1)
+	XORB $0x80, 95(R9)
+
+	MOVOU (R9), X8
+	PXOR  X8, X0
+	MOVOU X0, (R9)
+	MOVO  X8, X0
+	MOVOU 16(R9), X8
+	PXOR  X8, X1
+	MOVOU X1, 16(R9)
+	MOVO  X8, X1
+	MOVOU 32(R9), X8
+	PXOR  X8, X2
+	MOVOU X2, 32(R9)
+	MOVO  X8, X2
+	MOVOU 48(R9), X8
+	PXOR  X8, X3
+	MOVOU X3, 48(R9)
+	MOVO  X8, X3
+	MOVOU 64(R9), X8
+	PXOR  X8, X4
+	MOVOU X4, 64(R9)
+	MOVO  X8, X4
+	MOVOU 80(R9), X8
+	PXOR  X8, X5
+	MOVOU X5, 80(R9)
+	MOVO  X8, X5
+
+	STORE_STATE(R8)
+
+	RET
+
+// func finalizeStateLnXMM(s *uint64, out, key *byte)
+TEXT FINALIZE_STATE_FN, NOSPLIT, $0-24
+	MOVQ s+0(FP), R8
+	MOVQ out+8(FP), R9
+	MOVQ key+16(FP), R10
+
+	LOAD_STATE(R8)
+	LOAD_SHUFFLES()
+	MOVOU ·xmm_tag_final<>(SB), X14
+
+	PXOR X14, X7
+
+	PERMUTE()
+
+	MOVOU (R10), X8
+	MOVOU 16(R10), X9
+	PXOR  X8, X6
+	PXOR  X9, X7
+
+	PERMUTE()
+
+	MOVOU (R10), X8
+	MOVOU 16(R10), X9
+	PXOR  X8, X6
+	PXOR  X9, X7
+
+	MOVOU X6, (R9)
+	MOVOU X7, 16(R9)
+
+	RET
@@ -0,0 +1,88 @@
+// hwaccel_xmm.go - Shared SSE2/SSSE3 routine wrappers
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build amd64,!gccgo,!noasm,go1.10 386,!gccgo,!noasm,go1.10
+
+package norx
+
+// The XMM routines are implemented in assembly per architecture (SSSE3 on
+// amd64, SSE2 on 386), with the same signatures.
+
+func initXMM(s *state, key, nonce []byte) {
+	var instConsts = [4]uint64{paramW, uint64(s.perm.rounds), paramP, paramT}
+	initStateXMM(s.perm, &s.s[0], &key[0], &nonce[0], &initializationConstants[8], &instConsts[0])
+}
+
+func absorbDataXMM(s *state, in []byte, tag uint64) {
+	inLen := len(in)
+	if inLen == 0 {
+		return
+	}
+
+	var tagVec = [4]uint64{0, 0, 0, tag}
+	var off int
+	if inBlocks := inLen / bytesR; inBlocks > 0 {
+		absorbBlocksXMM(s.perm, &s.s[0], &in[0], uint64(inBlocks), &tagVec[0])
+		off += inBlocks * bytesR
+	}
+	in = in[off:]
+
+	var lastBlock [bytesR]byte
+	padRef(&lastBlock, in)
+	absorbBlocksXMM(s.perm, &s.s[0], &lastBlock[0], 1, &tagVec[0])
+}
+
+func encryptDataXMM(s *state, out, in []byte) {
+	inLen := len(in)
+	if inLen == 0 {
+		return
+	}
+
+	var off int
+	if inBlocks := inLen / bytesR; inBlocks > 0 {
+		encryptBlocksXMM(s.perm, &s.s[0], &out[0], &in[0], uint64(inBlocks))
+		off += inBlocks * bytesR
+	}
+	out, in = out[off:], in[off:]
+
+	var lastBlock [bytesR]byte
+	padRef(&lastBlock, in)
+	encryptBlocksXMM(s.perm, &s.s[0], &lastBlock[0], &lastBlock[0], 1)
+	copy(out, lastBlock[:len(in)])
+}
+
+func decryptDataXMM(s *state, out, in []byte) {
+	inLen := len(in)
+	if inLen == 0 {
+		return
+	}
+
+	var off int
+	if inBlocks := inLen / bytesR; inBlocks > 0 {
+		decryptBlocksXMM(s.perm, &s.s[0], &out[0], &in[0], uint64(inBlocks))
+		off += inBlocks * bytesR
+	}
+	out, in = out[off:], in[off:]
+
+	var lastBlock [bytesR]byte
+	var inPtr *byte
+	if len(in) != 0 {
+		inPtr = &in[0]
+	}
+	decryptLastBlockXMM(s.perm, &s.s[0], &lastBlock[0], inPtr, uint64(len(in)))
+	copy(out, lastBlock[:len(in)])
+	burnBytes(lastBlock[:])
+}
+
+func finalizeXMM(s *state, tag, key []byte) {
+	var lastBlock [bytesC]byte
+
+	finalizeStateXMM(s.perm, &s.s[0], &lastBlock[0], &key[0])
+	copy(tag, lastBlock[:bytesT])
+	burnBytes(lastBlock[:]) // burn buffer
+	burnUint64s(s.s[:])     // at this point we can also burn the state
+}
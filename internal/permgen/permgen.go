@@ -0,0 +1,456 @@
+// permgen.go - Permutation code generator
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package permgen generates the fully unrolled, round count specialized
+// NORX permutation code used by the norx package, both in pure Go, and
+// as assembly macros for the optimized backends, along with one set of
+// assembly entry points per round count, so that no code ever branches on
+// the round count at runtime.
+package permgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Rounds is the list of supported round counts (NORX_L), one per variant.
+// Adding a new variant requires adding the round count here, and
+// regenerating the code.
+var Rounds = []int{4, 6}
+
+// File is a generated file.
+type File struct {
+	Name string
+	Data []byte
+}
+
+const generatedHeader = "// Code generated by permgen. DO NOT EDIT.\n\n"
+
+const licenseHeader = `//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+`
+
+var (
+	// The column and diagonal steps, as indexes into the state.
+	columns = [4][4]int{
+		{0, 4, 8, 12},
+		{1, 5, 9, 13},
+		{2, 6, 10, 14},
+		{3, 7, 11, 15},
+	}
+	diagonals = [4][4]int{
+		{0, 5, 10, 15},
+		{1, 6, 11, 12},
+		{2, 7, 8, 13},
+		{3, 4, 9, 14},
+	}
+)
+
+// asmMacro is a permutation macro, that is built out of repeated
+// invocations of a round macro defined in the including assembly file.
+type asmMacro struct {
+	name   string
+	params []string
+	round  string
+	desc   string
+}
+
+// asmHeader is a generated assembly header.
+type asmHeader struct {
+	name   string
+	desc   string
+	macros []asmMacro
+}
+
+var (
+	amd64Header = &asmHeader{
+		name: "permute_amd64.h",
+		desc: "AMD64",
+		macros: []asmMacro{
+			{
+				name:  "PERMUTE",
+				round: "ROUND()",
+				desc:  "the state",
+			},
+			{
+				name:  "PERMUTE_X2",
+				round: "ROUND_X2()",
+				desc:  "two states at once",
+			},
+		},
+	}
+
+	i386Header = &asmHeader{
+		name: "permute_386.h",
+		desc: "386",
+		macros: []asmMacro{
+			{
+				name:   "PERMUTE",
+				params: []string{"S"},
+				round:  "ROUND(S)",
+				desc:   "the state at S",
+			},
+		},
+	}
+
+	asmHeaders = []*asmHeader{amd64Header, i386Header}
+)
+
+// asmFunc is an assembly routine that uses the permutation, and that is
+// instantiated once per round count.
+type asmFunc struct {
+	name   string // Base name, eg: absorbBlocks.
+	params string // Go parameters.
+}
+
+// asmInst is a generated assembly file, that instantiates the routines in
+// a hand written body header once per round count.
+type asmInst struct {
+	name   string
+	desc   string
+	header *asmHeader
+	body   string
+}
+
+// asmBackend is a family of assembly routines, that share the Go
+// declarations and dispatch wrappers.
+type asmBackend struct {
+	name  string // Suffix of the routine names, eg: AVX2.
+	file  string
+	desc  string
+	build string
+	funcs []asmFunc
+	insts []asmInst
+}
+
+var asmBackends = []asmBackend{
+	{
+		name:  "AVX2",
+		file:  "permute_avx2_amd64.go",
+		desc:  "AVX2",
+		build: "amd64,!gccgo,!noasm,go1.10",
+		funcs: []asmFunc{
+			{"init", "s *uint64, key, nonce *byte, initConsts, instConsts *uint64"},
+			{"absorbBlocks", "s *uint64, in *byte, blocks uint64, tag *uint64"},
+			{"encryptBlocks", "s *uint64, out, in *byte, blocks uint64"},
+			{"decryptBlocks", "s *uint64, out, in *byte, blocks uint64"},
+			{"decryptLastBlock", "s *uint64, out, in *byte, inLen uint64"},
+			{"finalize", "s *uint64, out, key *byte"},
+			{"sealSmall", "key, nonce *byte, instConsts *uint64, blocks *byte, hBlocks, mBlocks, tBlocks uint64, tag *byte"},
+			{"openSmall", "key, nonce *byte, instConsts *uint64, blocks *byte, hBlocks, mBlocks, tBlocks, lastLen uint64, tag *byte"},
+			{"permute", "s *uint64"},
+			{"permuteX2", "s0, s1 *uint64"},
+			{"encryptBlocksX2", "s0, s1 *uint64, out0, in0, out1, in1 *byte, blocks uint64"},
+			{"decryptBlocksX2", "s0, s1 *uint64, out0, in0, out1, in1 *byte, blocks uint64"},
+		},
+		insts: []asmInst{
+			{
+				name:   "permute_avx2_amd64.s",
+				desc:   "AVX2",
+				header: amd64Header,
+				body:   "hwaccel_avx2_amd64.h",
+			},
+		},
+	},
+	{
+		name:  "XMM",
+		file:  "permute_xmm.go",
+		desc:  "SSE2/SSSE3",
+		build: "amd64,!gccgo,!noasm,go1.10 386,!gccgo,!noasm,go1.10",
+		funcs: []asmFunc{
+			{"initState", "s *uint64, key, nonce *byte, initConsts, instConsts *uint64"},
+			{"absorbBlocks", "s *uint64, in *byte, blocks uint64, tag *uint64"},
+			{"encryptBlocks", "s *uint64, out, in *byte, blocks uint64"},
+			{"decryptBlocks", "s *uint64, out, in *byte, blocks uint64"},
+			{"decryptLastBlock", "s *uint64, out, in *byte, inLen uint64"},
+			{"finalizeState", "s *uint64, out, key *byte"},
+		},
+		insts: []asmInst{
+			{
+				name:   "permute_ssse3_amd64.s",
+				desc:   "SSSE3",
+				header: amd64Header,
+				body:   "hwaccel_ssse3_amd64.h",
+			},
+			{
+				name:   "permute_sse2_386.s",
+				desc:   "SSE2",
+				header: i386Header,
+				body:   "hwaccel_sse2_386.h",
+			},
+		},
+	},
+}
+
+// Generate returns all of the generated files.
+func Generate() ([]File, error) {
+	rounds := append([]int{}, Rounds...)
+	sort.Ints(rounds)
+	if len(rounds) == 0 {
+		return nil, fmt.Errorf("permgen: no round counts")
+	}
+	for i, l := range rounds {
+		if l <= 0 || (i > 0 && l == rounds[i-1]) {
+			return nil, fmt.Errorf("permgen: invalid round count: %d", l)
+		}
+	}
+
+	f, err := generateGo(rounds)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{f}
+	for _, h := range asmHeaders {
+		files = append(files, generateAsm(h, rounds))
+	}
+	for i := range asmBackends {
+		be := &asmBackends[i]
+		f, err = generateBackendGo(be, rounds)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		for j := range be.insts {
+			files = append(files, generateBackendAsm(be, &be.insts[j], rounds))
+		}
+	}
+
+	return files, nil
+}
+
+func generateGo(rounds []int) (File, error) {
+	const name = "permute_ref.go"
+
+	var b bytes.Buffer
+	b.WriteString(generatedHeader)
+	fmt.Fprintf(&b, "// %s - Round specialized permutations (portable)\n", name)
+	b.WriteString(licenseHeader)
+	b.WriteString("\npackage norx\n\n")
+
+	b.WriteString("var (\n")
+	for _, l := range rounds {
+		fmt.Fprintf(&b, "permutationL%d = &permutation{rounds: %d}\n", l, l)
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// permutationFor returns the permutation with the round count, or nil if\n")
+	b.WriteString("// the round count is not supported.\n")
+	b.WriteString("func permutationFor(rounds int) *permutation {\n")
+	b.WriteString("switch rounds {\n")
+	for _, l := range rounds {
+		fmt.Fprintf(&b, "case %d:\nreturn permutationL%d\n", l, l)
+	}
+	b.WriteString("default:\nreturn nil\n}\n}\n\n")
+
+	b.WriteString("// permuteRef applies the state's NORX permutation to the state.\n")
+	b.WriteString("func permuteRef(s *state) {\n")
+	b.WriteString("switch s.perm {\n")
+	for _, l := range rounds {
+		fmt.Fprintf(&b, "case permutationL%d:\npermuteL%dRef(&s.s)\n", l, l)
+	}
+	b.WriteString("default:\npanic(\"BUG: unsupported permutation\")\n}\n}\n")
+
+	// The reference code uses a few macros and has much better
+	// readability here, but Go does not have macros, and at least as of
+	// Go 1.10, a quarter round routine is over the inliner budget, hence
+	// the code is generated.
+	for _, l := range rounds {
+		fmt.Fprintf(&b, "\n// permuteL%dRef is the NORX permutation F^%d, fully unrolled.\n", l, l)
+		b.WriteString("//\n")
+		b.WriteString("// Performance: Explicitly load the state into temp vars, and write\n")
+		b.WriteString("// it back on completion since the compiler will do all of the\n")
+		b.WriteString("// loads/stores otherwise.\n")
+		fmt.Fprintf(&b, "func permuteL%dRef(s *[16]uint64) {\n", l)
+		b.WriteString("s0, s1, s2, s3, s4, s5, s6, s7, s8, s9, s10, s11, s12, s13, s14, s15 := s[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11], s[12], s[13], s[14], s[15]\n")
+		for r := 1; r <= l; r++ {
+			fmt.Fprintf(&b, "\n// Round %d: Column step\n", r)
+			for _, v := range columns {
+				goG(&b, v)
+			}
+			fmt.Fprintf(&b, "\n// Round %d: Diagonal step\n", r)
+			for _, v := range diagonals {
+				goG(&b, v)
+			}
+		}
+		b.WriteString("\ns[0], s[1], s[2], s[3], s[4], s[5], s[6], s[7], s[8], s[9], s[10], s[11], s[12], s[13], s[14], s[15] = s0, s1, s2, s3, s4, s5, s6, s7, s8, s9, s10, s11, s12, s13, s14, s15\n")
+		b.WriteString("}\n")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return File{}, fmt.Errorf("permgen: failed to format %s: %v", name, err)
+	}
+
+	return File{Name: name, Data: src}, nil
+}
+
+func goG(b *bytes.Buffer, v [4]int) {
+	a, bb, c, d := v[0], v[1], v[2], v[3]
+
+	// The rotates are written out as shifts (which the compiler will
+	// turn into a rotate) as math/bits is not available on all of the
+	// Go versions that the reference code is built for.
+	step := func(x, y, z, r int) {
+		fmt.Fprintf(b, "s%d = (s%d ^ s%d) ^ ((s%d & s%d) << 1)\n", x, x, y, x, y)
+		fmt.Fprintf(b, "s%d ^= s%d\n", z, x)
+		fmt.Fprintf(b, "s%d = (s%d >> paramR%d) | (s%d << (64 - paramR%d))\n", z, z, r, z, r)
+	}
+
+	b.WriteString("\n")
+	step(a, bb, d, 0)
+	step(c, d, bb, 1)
+	step(a, bb, d, 2)
+	step(c, d, bb, 3)
+}
+
+func generateAsm(h *asmHeader, rounds []int) File {
+	var b bytes.Buffer
+	b.WriteString(generatedHeader)
+	fmt.Fprintf(&b, "// %s - Round specialized permutations (%s)\n", h.name, h.desc)
+	b.WriteString(licenseHeader)
+
+	for _, m := range h.macros {
+		params := strings.Join(m.params, ", ")
+
+		fmt.Fprintf(&b, "\n// %s_Ln applies the NORX permutation F^n to %s.\n", m.name, m.desc)
+		b.WriteString("//\n")
+		fmt.Fprintf(&b, "// The permutation is fully unrolled, with %s invoked once per\n", m.round)
+		b.WriteString("// round, and there is one macro per supported round count.\n")
+
+		for _, l := range rounds {
+			lines := make([]string, 0, l)
+			for j := 0; j < l; j++ {
+				lines = append(lines, "\t"+m.round)
+			}
+
+			width := 0
+			for _, s := range lines {
+				if w := len(strings.Replace(s, "\t", "        ", -1)); w > width {
+					width = w
+				}
+			}
+			fmt.Fprintf(&b, "#define %s_L%d(%s) \\\n", m.name, l, params)
+			for i, s := range lines {
+				if i == len(lines)-1 {
+					b.WriteString(s + "\n")
+					break
+				}
+				pad := width - len(strings.Replace(s, "\t", "        ", -1)) + 1
+				b.WriteString(s + strings.Repeat(" ", pad) + "\\\n")
+			}
+			if l != rounds[len(rounds)-1] {
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	return File{Name: h.name, Data: b.Bytes()}
+}
+
+// routineName returns the name of the routine specialized for l rounds.
+func (be *asmBackend) routineName(f *asmFunc, l int) string {
+	return fmt.Sprintf("%sL%d%s", f.name, l, be.name)
+}
+
+// entryMacro returns the name of the macro used in place of the TEXT
+// symbol of the routine in the body header, eg: ABSORB_BLOCKS_FN.
+func entryMacro(f *asmFunc) string {
+	var b strings.Builder
+	for _, r := range f.name {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	b.WriteString("_FN")
+	return b.String()
+}
+
+// paramNames returns the names of the Go parameters in params.
+func paramNames(params string) string {
+	var names []string
+	for _, p := range strings.Split(params, ", ") {
+		names = append(names, strings.Fields(p)[0])
+	}
+	return strings.Join(names, ", ")
+}
+
+func generateBackendGo(be *asmBackend, rounds []int) (File, error) {
+	var b bytes.Buffer
+	b.WriteString("package norx\n")
+
+	for i := range be.funcs {
+		f := &be.funcs[i]
+		for _, l := range rounds {
+			fmt.Fprintf(&b, "\n//go:noescape\nfunc %s(%s)\n", be.routineName(f, l), f.params)
+		}
+	}
+
+	for i := range be.funcs {
+		f := &be.funcs[i]
+		fmt.Fprintf(&b, "\n// %s%s calls the %s routine specialized for the permutation p.\n", f.name, be.name, be.desc)
+		fmt.Fprintf(&b, "func %s%s(p *permutation, %s) {\n", f.name, be.name, f.params)
+		b.WriteString("switch p {\n")
+		for _, l := range rounds {
+			fmt.Fprintf(&b, "case permutationL%d:\n%s(%s)\n", l, be.routineName(f, l), paramNames(f.params))
+		}
+		b.WriteString("default:\npanic(\"BUG: unsupported permutation\")\n}\n}\n")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return File{}, fmt.Errorf("permgen: failed to format %s: %v", be.file, err)
+	}
+
+	// The header is added after formatting, so that go/format does not
+	// rewrite the build constraint.
+	var hdr bytes.Buffer
+	hdr.WriteString(generatedHeader)
+	fmt.Fprintf(&hdr, "// %s - Round specialized %s routines\n", be.file, be.desc)
+	hdr.WriteString(licenseHeader)
+	fmt.Fprintf(&hdr, "\n// +build %s\n\n", be.build)
+
+	return File{Name: be.file, Data: append(hdr.Bytes(), src...)}, nil
+}
+
+func generateBackendAsm(be *asmBackend, inst *asmInst, rounds []int) File {
+	var b bytes.Buffer
+	b.WriteString(generatedHeader)
+	b.WriteString("// +build !noasm,go1.10\n")
+	fmt.Fprintf(&b, "// %s - Round specialized %s routines\n", inst.name, inst.desc)
+	b.WriteString(licenseHeader)
+	b.WriteString("\n#include \"textflag.h\"\n")
+	fmt.Fprintf(&b, "#include \"%s\"\n", inst.header.name)
+
+	for _, l := range rounds {
+		fmt.Fprintf(&b, "\n// F^%d\n", l)
+		for _, m := range inst.header.macros {
+			params := strings.Join(m.params, ", ")
+			fmt.Fprintf(&b, "#define %s(%s) %s_L%d(%s)\n", m.name, params, m.name, l, params)
+		}
+		for i := range be.funcs {
+			f := &be.funcs[i]
+			fmt.Fprintf(&b, "#define %s ·%s(SB)\n", entryMacro(f), be.routineName(f, l))
+		}
+		fmt.Fprintf(&b, "#include \"%s\"\n", inst.body)
+		for _, m := range inst.header.macros {
+			fmt.Fprintf(&b, "#undef %s\n", m.name)
+		}
+		for i := range be.funcs {
+			fmt.Fprintf(&b, "#undef %s\n", entryMacro(&be.funcs[i]))
+		}
+	}
+
+	return File{Name: inst.name, Data: b.Bytes()}
+}
@@ -0,0 +1,52 @@
+// kdf.go - Permutation based key derivation
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import "encoding/binary"
+
+// deriveKey derives a TagSize byte subkey from key, label and input, with
+// the NORX permutation.  The state is initialized as with Seal (with an all
+// zero nonce), and label || input is absorbed and the output squeezed with
+// the non-standard tagDerive domain separation tag, which is never used by
+// Seal/Open, so no output of the AEAD can coincide with a derived key.
+//
+// The label must be unique to the purpose, and the input must be fixed
+// length (or otherwise unambiguous) for a given label.
+func deriveKey(p *permutation, out, key []byte, label string, input []byte) {
+	var s state
+	var zeroNonce [NonceSize]byte
+
+	buf := make([]byte, 0, len(label)+len(input))
+	buf = append(buf, label...)
+	buf = append(buf, input...)
+
+	s.perm = p
+	s.init(key, zeroNonce[:])
+	s.absorbData(buf, tagDerive)
+	s.squeeze(out, key, tagDerive)
+
+	if len(buf) > 0 {
+		burnBytes(buf)
+	}
+}
+
+// squeeze outputs TagSize bytes from the state, as with finalize, but with
+// the provided domain separation tag.  The state is burned.
+func (s *state) squeeze(out, key []byte, tag uint64) {
+	s.s[15] ^= tag
+	s.permute()
+	xorKeyRef(s, key)
+	s.permute()
+	xorKeyRef(s, key)
+
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(out[i*bytesW:], s.s[i+12])
+	}
+
+	burnUint64s(s.s[:])
+}
@@ -0,0 +1,52 @@
+// kdf_test.go - Permutation based key derivation tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveKey(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	input := make([]byte, 200)
+	_, err = rand.Read(input)
+	require.NoError(err, "rand.Read(input)")
+
+	derive := func(label string, input []byte) []byte {
+		out := make([]byte, KeySize)
+		deriveKey(permutationL4, out, k[:], label, input)
+		return out
+	}
+
+	forceDisableHardwareAcceleration()
+	expected := derive("norx: test", input)
+	require.NotEqual(derive("norx: test", input[1:]), expected, "deriveKey(): Input")
+	require.NotEqual(derive("norx: other", input), expected, "deriveKey(): Label")
+
+	// Seal with the same key, nonce, and label/input as the header can not
+	// reach the derivation domain.
+	var zeroNonce [NonceSize]byte
+	hdr := append([]byte("norx: test"), input...)
+	ct := newTestAEAD(k[:], 4).Seal(nil, zeroNonce[:], nil, hdr, nil)
+	require.NotEqual(ct, expected, "deriveKey(): Seal")
+
+	if !canAccelerate {
+		t.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	forEachAcceleratedImpl(func() {
+		require.Equal(expected, derive("norx: test", input), "deriveKey(): %s", hardwareAccelImpl.name)
+	})
+}
@@ -0,0 +1,267 @@
+// key.go - Key type and encodings
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+)
+
+const (
+	// KeyPEMType is the PEM block type of an encoded key.
+	KeyPEMType = "NORX KEY"
+
+	// KeyTextPrefix is the prefix of the text encoding of a key.
+	KeyTextPrefix = "norxkey-"
+
+	// FingerprintSize is the size of a key fingerprint in bytes.
+	FingerprintSize = 8
+
+	keyBinarySize   = 1 + KeySize
+	keyChecksumSize = 4
+
+	keyFingerprintLabel = "norx: key fingerprint"
+	keyChecksumLabel    = "norx: key checksum"
+)
+
+var (
+	// ErrInvalidKey is the error returned when a serialized key is
+	// malformed.
+	ErrInvalidKey = errors.New("norx: invalid key")
+
+	// ErrKeyChecksum is the error returned when the checksum of a text
+	// encoded key does not match, typically due to a transcription error.
+	ErrKeyChecksum = errors.New("norx: key checksum mismatch")
+
+	keyTextEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+)
+
+// Key is a NORX key, bound to a variant.
+//
+// The binary encoding is the variant identifier followed by the raw key.
+// The text encoding is KeyTextPrefix followed by the unpadded lower case
+// base32 encoding of the binary encoding and a 4 byte checksum, and the PEM
+// encoding is a KeyPEMType block containing the binary encoding.
+type Key struct {
+	variant Variant
+	key     [KeySize]byte
+}
+
+// Variant returns the variant the key is bound to.
+func (k *Key) Variant() Variant {
+	return k.variant
+}
+
+// Bytes returns a copy of the raw key.
+func (k *Key) Bytes() []byte {
+	return append([]byte{}, k.key[:]...)
+}
+
+// New returns a new keyed AEAD instance of the key's variant.  New panics
+// with ErrInvalidVariant if the key was not created by NewKey, GenerateKey,
+// or one of the unmarshal methods.
+func (k *Key) New() *AEAD {
+	if !k.variant.Valid() {
+		panic(ErrInvalidVariant)
+	}
+	return newAEAD(k.key[:], k.variant.rounds())
+}
+
+// Fingerprint returns the non-secret fingerprint of the key, suitable for
+// logging and auditing.  The fingerprint covers the variant.
+func (k *Key) Fingerprint() [FingerprintSize]byte {
+	var fp [FingerprintSize]byte
+
+	h := sha256.New()
+	h.Write([]byte(keyFingerprintLabel))
+	h.Write([]byte{byte(k.variant)})
+	h.Write(k.key[:])
+	copy(fp[:], h.Sum(nil))
+
+	return fp
+}
+
+// String returns a string representation of the key, that omits the key
+// material.
+func (k *Key) String() string {
+	fp := k.Fingerprint()
+	return "norx.Key(" + k.variant.String() + ", " + hex.EncodeToString(fp[:]) + ")"
+}
+
+// GoString returns the same as String, so that %#v does not leak the key
+// material.
+func (k *Key) GoString() string {
+	return k.String()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (k *Key) MarshalBinary() ([]byte, error) {
+	if !k.variant.Valid() {
+		return nil, ErrInvalidVariant
+	}
+
+	b := make([]byte, 0, keyBinarySize)
+	b = append(b, byte(k.variant))
+	return append(b, k.key[:]...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (k *Key) UnmarshalBinary(data []byte) error {
+	if len(data) != keyBinarySize {
+		return ErrInvalidKey
+	}
+	v := Variant(data[0])
+	if !v.Valid() {
+		return ErrInvalidVariant
+	}
+
+	k.variant = v
+	copy(k.key[:], data[1:])
+
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, using the checksummed text
+// encoding.
+func (k *Key) MarshalText() ([]byte, error) {
+	bin, err := k.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, keyBinarySize+keyChecksumSize)
+	b = append(b, bin...)
+	burnBytes(bin)
+	defer burnBytes(b)
+
+	b = append(b, keyChecksum(b)...)
+	text := make([]byte, len(KeyTextPrefix)+keyTextEncoding.EncodedLen(len(b)))
+	copy(text, KeyTextPrefix)
+	keyTextEncoding.Encode(text[len(KeyTextPrefix):], b)
+
+	return text, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, using the checksummed
+// text encoding.  Upper case input, and surrounding whitespace are
+// tolerated.
+func (k *Key) UnmarshalText(text []byte) error {
+	text = bytes.TrimSpace(text)
+	if len(text) < len(KeyTextPrefix) {
+		return ErrInvalidKey
+	}
+
+	// Fold the case in a copy, to avoid altering the caller's buffer, and
+	// leaving copies of the key material in immutable strings.
+	s := make([]byte, len(text))
+	defer burnBytes(s)
+	for i, c := range text {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		s[i] = c
+	}
+	if string(s[:len(KeyTextPrefix)]) != KeyTextPrefix {
+		return ErrInvalidKey
+	}
+
+	var b [keyBinarySize + keyChecksumSize]byte
+	defer burnBytes(b[:])
+	enc := s[len(KeyTextPrefix):]
+	if keyTextEncoding.DecodedLen(len(enc)) != len(b) {
+		return ErrInvalidKey
+	}
+	if n, err := keyTextEncoding.Decode(b[:], enc); err != nil || n != len(b) {
+		return ErrInvalidKey
+	}
+
+	if !bytes.Equal(b[keyBinarySize:], keyChecksum(b[:keyBinarySize])) {
+		return ErrKeyChecksum
+	}
+
+	return k.UnmarshalBinary(b[:keyBinarySize])
+}
+
+// MarshalPEM returns the PEM encoding of the key.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	b, err := k.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer burnBytes(b)
+
+	blk := &pem.Block{
+		Type:    KeyPEMType,
+		Headers: map[string]string{"Variant": k.variant.String()},
+		Bytes:   b,
+	}
+	return pem.EncodeToMemory(blk), nil
+}
+
+// UnmarshalPEM parses the first PEM block in data, which must be of type
+// KeyPEMType.
+func (k *Key) UnmarshalPEM(data []byte) error {
+	blk, _ := pem.Decode(data)
+	if blk == nil || blk.Type != KeyPEMType {
+		return ErrInvalidKey
+	}
+	defer burnBytes(blk.Bytes)
+
+	return k.UnmarshalBinary(blk.Bytes)
+}
+
+// Reset securely purges the key material.
+func (k *Key) Reset() {
+	burnBytes(k.key[:])
+}
+
+func keyChecksum(b []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(keyChecksumLabel))
+	h.Write(b)
+	return h.Sum(nil)[:keyChecksumSize]
+}
+
+// NewKey returns a new Key of the provided variant, with a copy of the raw
+// key.
+func NewKey(v Variant, key []byte) (*Key, error) {
+	if !v.Valid() {
+		return nil, ErrInvalidVariant
+	}
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+
+	k := &Key{variant: v}
+	copy(k.key[:], key)
+
+	return k, nil
+}
+
+// GenerateKey generates a new random Key of the provided variant, reading
+// entropy from r, or crypto/rand.Reader if r is nil.
+func GenerateKey(v Variant, r io.Reader) (*Key, error) {
+	if !v.Valid() {
+		return nil, ErrInvalidVariant
+	}
+	if r == nil {
+		r = rand.Reader
+	}
+
+	k := &Key{variant: v}
+	if _, err := io.ReadFull(r, k.key[:]); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
@@ -0,0 +1,95 @@
+// key_test.go - Key type tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	require := require.New(t)
+
+	k, err := GenerateKey(VariantNORX6441, nil)
+	require.NoError(err, "GenerateKey()")
+	require.Equal(VariantNORX6441, k.Variant(), "Variant()")
+
+	_, err = GenerateKey(Variant(0), nil)
+	require.Equal(ErrInvalidVariant, err, "GenerateKey(): Invalid variant")
+	_, err = GenerateKey(VariantNORX6461, bytes.NewReader(make([]byte, KeySize-1)))
+	require.Error(err, "GenerateKey(): Short read")
+	_, err = NewKey(VariantNORX6461, make([]byte, KeySize-1))
+	require.Equal(ErrInvalidKeySize, err, "NewKey(): Short key")
+
+	// The key is bound to the variant.
+	var nonce [NonceSize]byte
+	ct := k.New().Seal(nil, nonce[:], []byte("msg"), nil, nil)
+	_, err = newTestAEAD(k.Bytes(), 4).Open(nil, nonce[:], ct, nil, nil)
+	require.NoError(err, "New(): NORX64-4-1")
+	require.PanicsWithValue(ErrInvalidVariant, func() { (&Key{}).New() }, "New(): Zero value")
+	require.PanicsWithValue(ErrInvalidVariant, func() { newAEAD(k.Bytes(), 0) }, "newAEAD(): Invalid rounds")
+
+	// Binary.
+	b, err := k.MarshalBinary()
+	require.NoError(err, "MarshalBinary()")
+	var k2 Key
+	require.NoError(k2.UnmarshalBinary(b), "UnmarshalBinary()")
+	require.Equal(k, &k2, "UnmarshalBinary(): Round trip")
+	require.Equal(ErrInvalidKey, k2.UnmarshalBinary(b[1:]), "UnmarshalBinary(): Truncated")
+
+	// Text.
+	text, err := k.MarshalText()
+	require.NoError(err, "MarshalText()")
+	require.True(strings.HasPrefix(string(text), KeyTextPrefix), "MarshalText(): Prefix")
+	k2 = Key{}
+	require.NoError(k2.UnmarshalText(text), "UnmarshalText()")
+	require.Equal(k, &k2, "UnmarshalText(): Round trip")
+	upper := []byte(" " + strings.ToUpper(string(text)) + "\n")
+	require.NoError(k2.UnmarshalText(upper), "UnmarshalText(): Upper case")
+	require.Equal(k, &k2, "UnmarshalText(): Upper case")
+	require.Equal(" "+strings.ToUpper(string(text))+"\n", string(upper), "UnmarshalText(): Upper case, unaltered")
+
+	typo := append([]byte{}, text...)
+	if typo[20] == 'a' {
+		typo[20] = 'b'
+	} else {
+		typo[20] = 'a'
+	}
+	require.Equal(ErrKeyChecksum, k2.UnmarshalText(typo), "UnmarshalText(): Typo")
+	require.Equal(ErrInvalidKey, k2.UnmarshalText(text[1:]), "UnmarshalText(): Prefix")
+	require.Equal(ErrInvalidKey, k2.UnmarshalText(text[:len(text)-1]), "UnmarshalText(): Truncated")
+	require.Equal(ErrInvalidKey, k2.UnmarshalText([]byte(" ")), "UnmarshalText(): Empty")
+
+	// PEM.
+	p, err := k.MarshalPEM()
+	require.NoError(err, "MarshalPEM()")
+	require.Contains(string(p), "Variant: NORX64-4-1", "MarshalPEM(): Header")
+	k2 = Key{}
+	require.NoError(k2.UnmarshalPEM(p), "UnmarshalPEM()")
+	require.Equal(k, &k2, "UnmarshalPEM(): Round trip")
+	require.Equal(ErrInvalidKey, k2.UnmarshalPEM([]byte("garbage")), "UnmarshalPEM(): Garbage")
+
+	// Fingerprints and formatting do not leak the key, and are variant
+	// specific.
+	fp := k.Fingerprint()
+	k6, err := NewKey(VariantNORX6461, k.Bytes())
+	require.NoError(err, "NewKey()")
+	require.NotEqual(fp, k6.Fingerprint(), "Fingerprint(): Variant")
+	for _, s := range []string{k.String(), fmt.Sprintf("%v", k), fmt.Sprintf("%#v", k)} {
+		require.Contains(s, hex.EncodeToString(fp[:]), "String(): Fingerprint")
+		require.False(strings.Contains(s, hex.EncodeToString(k.Bytes())), "String(): Leak")
+	}
+
+	k.Reset()
+	require.Equal(make([]byte, KeySize), k.Bytes(), "Reset()")
+}
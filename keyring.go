@@ -0,0 +1,192 @@
+// keyring.go - Key rotation keyring
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrKeyNotFound is the error returned when a key ID is not present in
+	// a Keyring.
+	ErrKeyNotFound = errors.New("norx: key not found")
+
+	// ErrKeyExists is the error returned when adding a key with an ID that
+	// is already present in a Keyring.
+	ErrKeyExists = errors.New("norx: key already exists")
+
+	// ErrKeyIsPrimary is the error returned when attempting to retire the
+	// primary key of a Keyring.
+	ErrKeyIsPrimary = errors.New("norx: key is the primary key")
+
+	// ErrNoPrimaryKey is the error returned when attempting to seal with a
+	// Keyring that has no primary key.
+	ErrNoPrimaryKey = errors.New("norx: no primary key")
+)
+
+// keyringStackHeaderSize is the size of the stack buffer used to hold the
+// key ID prefixed header, larger headers will require a heap allocation.
+const keyringStackHeaderSize = 128
+
+// Keyring is a set of AEAD instances identified by a key ID, one of which
+// is the primary key used for sealing, to support key rotation.
+//
+// Sealed messages are prefixed with the compact (uvarint) encoding of the
+// key ID, which is also prepended to the header, so that it is
+// authenticated.  It is safe to call all of the methods concurrently.  The
+// zero value is an empty keyring, ready to use.
+type Keyring struct {
+	lock sync.RWMutex
+
+	keys       map[uint32]*AEAD
+	primary    uint32
+	hasPrimary bool
+}
+
+// Add adds a key to the keyring with the provided ID.  The keyring takes
+// ownership of the AEAD instance.
+func (kr *Keyring) Add(id uint32, aead *AEAD) error {
+	if aead == nil {
+		return errors.New("norx: nil key")
+	}
+
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	if _, ok := kr.keys[id]; ok {
+		return ErrKeyExists
+	}
+	if kr.keys == nil {
+		kr.keys = make(map[uint32]*AEAD)
+	}
+	kr.keys[id] = aead
+
+	return nil
+}
+
+// Promote makes the key with the provided ID the primary key.
+func (kr *Keyring) Promote(id uint32) error {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	if _, ok := kr.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+	kr.primary, kr.hasPrimary = id, true
+
+	return nil
+}
+
+// Retire removes the key with the provided ID from the keyring, and purges
+// it with AEAD.Reset.  The primary key can not be retired.
+func (kr *Keyring) Retire(id uint32) error {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	aead, ok := kr.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if kr.hasPrimary && kr.primary == id {
+		return ErrKeyIsPrimary
+	}
+	delete(kr.keys, id)
+	aead.Reset()
+
+	return nil
+}
+
+// Primary returns the ID of the primary key, and true, or false if there is
+// no primary key.
+func (kr *Keyring) Primary() (uint32, bool) {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	return kr.primary, kr.hasPrimary
+}
+
+// IDs returns the IDs of all of the keys in the keyring, in no particular
+// order.
+func (kr *Keyring) IDs() []uint32 {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	ids := make([]uint32, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Reset retires all of the keys, including the primary key.
+func (kr *Keyring) Reset() {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	for id, aead := range kr.keys {
+		delete(kr.keys, id)
+		aead.Reset()
+	}
+	kr.primary, kr.hasPrimary = 0, false
+}
+
+// Seal encrypts and authenticates plaintext with the primary key as with
+// AEAD.Seal, and appends the key ID followed by the result to dst,
+// returning the updated slice.
+//
+// The plaintext and dst must not overlap.
+func (kr *Keyring) Seal(dst, nonce, plaintext, header, footer []byte) ([]byte, error) {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	if !kr.hasPrimary {
+		return dst, ErrNoPrimaryKey
+	}
+
+	var idBuf [binary.MaxVarintLen32]byte
+	idLen := binary.PutUvarint(idBuf[:], uint64(kr.primary))
+
+	var hdrBuf [keyringStackHeaderSize]byte
+	hdr := append(append(hdrBuf[:0], idBuf[:idLen]...), header...)
+
+	dst = append(dst, idBuf[:idLen]...)
+	return kr.keys[kr.primary].Seal(dst, nonce, plaintext, hdr, footer), nil
+}
+
+// Open decrypts and authenticates ciphertext as with AEAD.Open, using the
+// key identified by the key ID prefix of ciphertext, as by Seal.
+func (kr *Keyring) Open(dst, nonce, ciphertext, header, footer []byte) ([]byte, error) {
+	id, idLen := binary.Uvarint(ciphertext)
+	if idLen <= 0 || id > 0xffffffff {
+		return dst, ErrOpen
+	}
+
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	aead, ok := kr.keys[uint32(id)]
+	if !ok {
+		return dst, ErrKeyNotFound
+	}
+
+	// The prefix is authenticated as is, so non-canonical encodings of
+	// the key ID will fail to authenticate.
+	var hdrBuf [keyringStackHeaderSize]byte
+	hdr := append(append(hdrBuf[:0], ciphertext[:idLen]...), header...)
+
+	return aead.Open(dst, nonce, ciphertext[idLen:], hdr, footer)
+}
+
+// NewKeyring returns a new empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys: make(map[uint32]*AEAD),
+	}
+}
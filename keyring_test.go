@@ -0,0 +1,106 @@
+// keyring_test.go - Key rotation keyring tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring(t *testing.T) {
+	require := require.New(t)
+
+	newKey := func() *AEAD {
+		var k [KeySize]byte
+		_, err := rand.Read(k[:])
+		require.NoError(err, "rand.Read(k)")
+		return newTestAEAD(k[:], 4)
+	}
+
+	var nonce [NonceSize]byte
+	msg, header, footer := []byte("quarterly rotation"), []byte("header"), []byte("footer")
+
+	kr := NewKeyring()
+	_, err := kr.Seal(nil, nonce[:], msg, header, footer)
+	require.Equal(ErrNoPrimaryKey, err, "Seal(): No primary")
+
+	k1, k300 := newKey(), newKey()
+	require.NoError(kr.Add(1, k1), "Add(1)")
+	require.NoError(kr.Add(300, k300), "Add(300)")
+	require.Equal(ErrKeyExists, kr.Add(1, newKey()), "Add(1): Duplicate")
+	require.Error(kr.Add(2, nil), "Add(2): nil")
+	require.Equal(ErrKeyNotFound, kr.Promote(2), "Promote(2)")
+
+	var zero Keyring
+	require.NoError(zero.Add(1, newKey()), "Add(1): Zero value")
+	require.NoError(zero.Promote(1), "Promote(1): Zero value")
+
+	require.NoError(kr.Promote(1), "Promote(1)")
+	id, ok := kr.Primary()
+	require.True(ok, "Primary()")
+	require.Equal(uint32(1), id, "Primary()")
+
+	ct1, err := kr.Seal(nil, nonce[:], msg, header, footer)
+	require.NoError(err, "Seal(): Key 1")
+	require.Equal([]byte{1}, ct1[:1], "Seal(): Key ID 1")
+	require.Len(ct1, 1+len(msg)+TagSize, "Seal(): Key 1")
+
+	require.NoError(kr.Promote(300), "Promote(300)")
+	ct300, err := kr.Seal([]byte("dst"), nonce[:], msg, header, footer)
+	require.NoError(err, "Seal(): Key 300")
+	require.Equal([]byte("dst\xac\x02"), ct300[:5], "Seal(): Key ID 300")
+	ct300 = ct300[3:]
+
+	// Both messages must be decryptable, with the appropriate key.
+	for _, ct := range [][]byte{ct1, ct300} {
+		pt, err := kr.Open(nil, nonce[:], ct, header, footer)
+		require.NoError(err, "Open()")
+		require.Equal(msg, pt, "Open()")
+	}
+
+	// The key ID is authenticated.
+	_, err = k1.Open(nil, nonce[:], ct1[1:], header, footer)
+	require.Equal(ErrOpen, err, "AEAD.Open(): Without key ID")
+	_, err = kr.Open(nil, nonce[:], ct1, []byte("HEADER"), footer)
+	require.Equal(ErrOpen, err, "Open(): Bad header")
+	nonCanonical := append([]byte{0x81, 0x00}, ct1[1:]...)
+	_, err = kr.Open(nil, nonce[:], nonCanonical, header, footer)
+	require.Equal(ErrOpen, err, "Open(): Non-canonical key ID")
+	_, err = kr.Open(nil, nonce[:], []byte{0x80}, header, footer)
+	require.Equal(ErrOpen, err, "Open(): Truncated key ID")
+	_, err = kr.Open(nil, nonce[:], append([]byte{2}, ct1[1:]...), header, footer)
+	require.Equal(ErrKeyNotFound, err, "Open(): Unknown key ID")
+
+	// Large headers should also work.
+	bigHeader := make([]byte, keyringStackHeaderSize*2)
+	ct, err := kr.Seal(nil, nonce[:], msg, bigHeader, nil)
+	require.NoError(err, "Seal(): Large header")
+	_, err = kr.Open(nil, nonce[:], ct, bigHeader, nil)
+	require.NoError(err, "Open(): Large header")
+
+	ids := kr.IDs()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	require.Equal([]uint32{1, 300}, ids, "IDs()")
+
+	// Retiring a key purges it.
+	require.Equal(ErrKeyIsPrimary, kr.Retire(300), "Retire(300): Primary")
+	require.NoError(kr.Retire(1), "Retire(1)")
+	require.Equal(make([]byte, KeySize), k1.key, "Retire(1): Key not purged")
+	require.Equal(ErrKeyNotFound, kr.Retire(1), "Retire(1): Again")
+	_, err = kr.Open(nil, nonce[:], ct1, header, footer)
+	require.Equal(ErrKeyNotFound, err, "Open(): Retired key")
+
+	kr.Reset()
+	require.Equal(make([]byte, KeySize), k300.key, "Reset(): Key not purged")
+	require.Empty(kr.IDs(), "Reset(): IDs()")
+	_, ok = kr.Primary()
+	require.False(ok, "Reset(): Primary()")
+}
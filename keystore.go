@@ -0,0 +1,429 @@
+// keystore.go - Passphrase protected keystore
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+)
+
+const (
+	// KeystoreVersion is the keystore format version.
+	KeystoreVersion = 1
+
+	// DefaultKeystoreIterations is the default PBKDF2 iteration count.
+	DefaultKeystoreIterations = 600000
+
+	// MaxKeystoreIterations is the maximum PBKDF2 iteration count.  The
+	// count is read from the unauthenticated header, so it is bounded to
+	// limit the work an altered keystore can cause.
+	MaxKeystoreIterations = 1 << 24
+
+	keystoreMagic     = "NORXKS"
+	keystoreKDFPBKDF2 = 1 // PBKDF2-HMAC-SHA256
+	keystoreSaltSize  = 32
+	keystoreEntrySize = 4 + keyBinarySize
+
+	keystoreHeaderSize = len(keystoreMagic) + 1 + 1 + 4 + keystoreSaltSize + NonceSize
+)
+
+var (
+	// ErrInvalidKeystore is the error returned when a serialized keystore is
+	// malformed.
+	ErrInvalidKeystore = errors.New("norx: invalid keystore")
+
+	// ErrUnsupportedKeystoreVersion is the error returned when a serialized
+	// keystore has an unknown format version or KDF.
+	ErrUnsupportedKeystoreVersion = errors.New("norx: unsupported keystore version")
+
+	// ErrKeystoreLocked is the error returned when accessing the keys of a
+	// locked keystore.
+	ErrKeystoreLocked = errors.New("norx: keystore is locked")
+
+	// ErrKeystoreUnlocked is the error returned when an operation requires a
+	// locked keystore.
+	ErrKeystoreUnlocked = errors.New("norx: keystore is unlocked")
+
+	// ErrBadPassphrase is the error returned when a keystore fails to
+	// unlock, due to an incorrect passphrase or a corrupted keystore.
+	ErrBadPassphrase = errors.New("norx: incorrect passphrase")
+)
+
+// Keystore is a set of keys, identified by a key ID, that can be stored
+// encrypted under a passphrase.
+//
+// The wrapping key is derived from the passphrase with PBKDF2-HMAC-SHA256,
+// with a random salt and the iteration count recorded in the file, and the
+// keys are sealed with NORX64-6-1, authenticating the file header.  The
+// serialized form is:
+//
+//	magic      [6]byte // "NORXKS"
+//	version    uint8   // KeystoreVersion
+//	kdf        uint8   // 1 (PBKDF2-HMAC-SHA256)
+//	iterations uint32  // Big endian
+//	salt       [32]byte
+//	nonce      [NonceSize]byte
+//	ciphertext []byte  // Sealed entries, including the tag
+//
+// Each entry is a big endian uint32 key ID followed by the binary encoding
+// of the Key.  It is safe to call all of the methods concurrently.
+type Keystore struct {
+	lock sync.Mutex
+
+	keys       map[uint32]*Key
+	iterations uint32
+
+	// sealed is the serialized keystore, as of the last Lock or
+	// UnmarshalBinary call.
+	sealed []byte
+}
+
+// Locked returns true iff the keystore is locked.
+func (ks *Keystore) Locked() bool {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	return ks.keys == nil
+}
+
+// SetIterations sets the PBKDF2 iteration count used by subsequent calls to
+// Lock and ChangePassphrase, with 0 meaning DefaultKeystoreIterations, and
+// counts above MaxKeystoreIterations being clamped.
+func (ks *Keystore) SetIterations(iterations uint32) {
+	iterations = keystoreIterations(iterations)
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	ks.iterations = iterations
+}
+
+// Add adds a copy of the key to the unlocked keystore with the provided ID.
+func (ks *Keystore) Add(id uint32, key *Key) error {
+	if key == nil || !key.variant.Valid() {
+		return ErrInvalidKey
+	}
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys == nil {
+		return ErrKeystoreLocked
+	}
+	if _, ok := ks.keys[id]; ok {
+		return ErrKeyExists
+	}
+	k := *key
+	ks.keys[id] = &k
+
+	return nil
+}
+
+// Remove removes the key with the provided ID from the unlocked keystore,
+// and purges it.
+func (ks *Keystore) Remove(id uint32) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys == nil {
+		return ErrKeystoreLocked
+	}
+	k, ok := ks.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	delete(ks.keys, id)
+	k.Reset()
+
+	return nil
+}
+
+// Key returns a copy of the key with the provided ID from the unlocked
+// keystore.
+func (ks *Keystore) Key(id uint32) (*Key, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys == nil {
+		return nil, ErrKeystoreLocked
+	}
+	k, ok := ks.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	kCopy := *k
+
+	return &kCopy, nil
+}
+
+// IDs returns the IDs of all of the keys in the unlocked keystore, in
+// ascending order.
+func (ks *Keystore) IDs() ([]uint32, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys == nil {
+		return nil, ErrKeystoreLocked
+	}
+	return ks.sortedIDs(), nil
+}
+
+// Lock encrypts the keys under the passphrase, and purges them from
+// memory.  A fresh salt and nonce are used for each call.
+func (ks *Keystore) Lock(passphrase []byte) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys == nil {
+		return ErrKeystoreLocked
+	}
+	return ks.lockLocked(passphrase)
+}
+
+// Unlock decrypts the keys with the passphrase.
+func (ks *Keystore) Unlock(passphrase []byte) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys != nil {
+		return ErrKeystoreUnlocked
+	}
+	return ks.unlockLocked(passphrase)
+}
+
+// ChangePassphrase re-encrypts the locked keystore under a new passphrase,
+// using the current iteration count.  The keystore remains locked, and is
+// left unaltered on failure.
+func (ks *Keystore) ChangePassphrase(oldPassphrase, newPassphrase []byte) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys != nil {
+		return ErrKeystoreUnlocked
+	}
+	if err := ks.unlockLocked(oldPassphrase); err != nil {
+		return err
+	}
+	if err := ks.lockLocked(newPassphrase); err != nil {
+		ks.resetKeys()
+		return err
+	}
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.  The keystore must be
+// locked.
+func (ks *Keystore) MarshalBinary() ([]byte, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.keys != nil {
+		return nil, ErrKeystoreUnlocked
+	}
+	return append([]byte{}, ks.sealed...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  The keystore will
+// be locked, with any existing keys purged.  Keystores with an unknown
+// version or KDF are rejected.
+func (ks *Keystore) UnmarshalBinary(data []byte) error {
+	if len(data) < len(keystoreMagic)+2 || string(data[:len(keystoreMagic)]) != keystoreMagic {
+		return ErrInvalidKeystore
+	}
+	if data[len(keystoreMagic)] != KeystoreVersion || data[len(keystoreMagic)+1] != keystoreKDFPBKDF2 {
+		return ErrUnsupportedKeystoreVersion
+	}
+	if len(data) < keystoreHeaderSize+TagSize {
+		return ErrInvalidKeystore
+	}
+	iterations := binary.BigEndian.Uint32(data[len(keystoreMagic)+2:])
+	if iterations == 0 || iterations > MaxKeystoreIterations {
+		return ErrInvalidKeystore
+	}
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	ks.resetKeys()
+	ks.iterations = iterations
+	ks.sealed = append([]byte{}, data...)
+
+	return nil
+}
+
+// Reset purges the keys, and locks the keystore without persisting them.
+func (ks *Keystore) Reset() {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	ks.resetKeys()
+	ks.sealed = nil
+}
+
+func (ks *Keystore) resetKeys() {
+	for id, k := range ks.keys {
+		delete(ks.keys, id)
+		k.Reset()
+	}
+	ks.keys = nil
+}
+
+func (ks *Keystore) sortedIDs() []uint32 {
+	ids := make([]uint32, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (ks *Keystore) lockLocked(passphrase []byte) error {
+	hdr := make([]byte, keystoreHeaderSize, keystoreHeaderSize+len(ks.keys)*keystoreEntrySize+TagSize)
+	copy(hdr, keystoreMagic)
+	hdr[len(keystoreMagic)] = KeystoreVersion
+	hdr[len(keystoreMagic)+1] = keystoreKDFPBKDF2
+	binary.BigEndian.PutUint32(hdr[len(keystoreMagic)+2:], ks.iterations)
+	saltAndNonce := hdr[len(keystoreMagic)+6:]
+	if _, err := rand.Read(saltAndNonce); err != nil {
+		return err
+	}
+	salt, nonce := saltAndNonce[:keystoreSaltSize], saltAndNonce[keystoreSaltSize:]
+
+	pt := make([]byte, 0, len(ks.keys)*keystoreEntrySize)
+	for _, id := range ks.sortedIDs() {
+		k := ks.keys[id]
+		pt = append(pt, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+		pt = append(pt, byte(k.variant))
+		pt = append(pt, k.key[:]...)
+	}
+	defer burnBytes(pt)
+
+	aead := newKeystoreAEAD(passphrase, salt, ks.iterations)
+	defer aead.Reset()
+
+	ks.sealed = aead.Seal(hdr, nonce, pt, hdr, nil)
+	ks.resetKeys()
+
+	return nil
+}
+
+func (ks *Keystore) unlockLocked(passphrase []byte) error {
+	if ks.sealed == nil {
+		return ErrInvalidKeystore
+	}
+	hdr, ct := ks.sealed[:keystoreHeaderSize], ks.sealed[keystoreHeaderSize:]
+	iterations := binary.BigEndian.Uint32(hdr[len(keystoreMagic)+2:])
+	if iterations == 0 || iterations > MaxKeystoreIterations {
+		return ErrInvalidKeystore
+	}
+	salt := hdr[len(keystoreMagic)+6 : len(keystoreMagic)+6+keystoreSaltSize]
+	nonce := hdr[len(keystoreMagic)+6+keystoreSaltSize:]
+
+	aead := newKeystoreAEAD(passphrase, salt, iterations)
+	defer aead.Reset()
+
+	pt, err := aead.Open(nil, nonce, ct, hdr, nil)
+	if err != nil {
+		return ErrBadPassphrase
+	}
+	defer burnBytes(pt)
+	if len(pt)%keystoreEntrySize != 0 {
+		return ErrInvalidKeystore
+	}
+
+	keys := make(map[uint32]*Key)
+	for b := pt; len(b) > 0; b = b[keystoreEntrySize:] {
+		id := binary.BigEndian.Uint32(b)
+		k := new(Key)
+		if err = k.UnmarshalBinary(b[4:keystoreEntrySize]); err != nil {
+			break
+		}
+		if _, ok := keys[id]; ok {
+			err = ErrInvalidKeystore
+			break
+		}
+		keys[id] = k
+	}
+	if err != nil {
+		for _, k := range keys {
+			k.Reset()
+		}
+		return ErrInvalidKeystore
+	}
+	ks.keys = keys
+
+	return nil
+}
+
+func newKeystoreAEAD(passphrase, salt []byte, iterations uint32) *AEAD {
+	key := pbkdf2SHA256(passphrase, salt, int(iterations), KeySize)
+	defer burnBytes(key)
+
+	// Nonces are never reused, as each Lock uses a fresh salt (and thus
+	// key), so the guard is unneeded.
+	aead := New6461(key)
+	aead.DisableNonceGuard()
+	return aead
+}
+
+// pbkdf2SHA256 is PBKDF2 (RFC 8018) with HMAC-SHA256 as the PRF.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hLen := prf.Size()
+	nBlocks := (keyLen + hLen - 1) / hLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, nBlocks*hLen)
+	u := make([]byte, hLen)
+	for block := 1; block <= nBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hLen:]
+		copy(u, t)
+
+		for i := 2; i <= iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	burnBytes(u)
+
+	return dk[:keyLen]
+}
+
+// NewKeystore returns a new empty unlocked Keystore, that will use the
+// provided PBKDF2 iteration count, with 0 meaning DefaultKeystoreIterations,
+// and counts above MaxKeystoreIterations being clamped.
+func NewKeystore(iterations uint32) *Keystore {
+	return &Keystore{
+		keys:       make(map[uint32]*Key),
+		iterations: keystoreIterations(iterations),
+	}
+}
+
+func keystoreIterations(iterations uint32) uint32 {
+	switch {
+	case iterations == 0:
+		return DefaultKeystoreIterations
+	case iterations > MaxKeystoreIterations:
+		return MaxKeystoreIterations
+	}
+	return iterations
+}
@@ -0,0 +1,117 @@
+// keystore_test.go - Passphrase protected keystore tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystore(t *testing.T) {
+	t.Run("PBKDF2", testKeystorePBKDF2)
+	t.Run("Integration", testKeystoreIntegration)
+}
+
+func testKeystorePBKDF2(t *testing.T) {
+	require := require.New(t)
+
+	vectors := []struct {
+		password, salt string
+		iterations     int
+		dk             string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for i, v := range vectors {
+		dk := pbkdf2SHA256([]byte(v.password), []byte(v.salt), v.iterations, 32)
+		require.Equal(v.dk, hex.EncodeToString(dk), "pbkdf2SHA256(): Vector %d", i)
+	}
+
+	dk := pbkdf2SHA256([]byte("password"), []byte("salt"), 1, 20)
+	require.Equal(vectors[0].dk[:40], hex.EncodeToString(dk), "pbkdf2SHA256(): Truncated")
+}
+
+func testKeystoreIntegration(t *testing.T) {
+	require := require.New(t)
+
+	const iterations = 1000
+	pass, newPass := []byte("correct horse"), []byte("battery staple")
+
+	ks := NewKeystore(iterations)
+	require.False(ks.Locked(), "Locked(): New")
+	k1, err := GenerateKey(VariantNORX6441, nil)
+	require.NoError(err, "GenerateKey(1)")
+	k2, err := GenerateKey(VariantNORX6461, nil)
+	require.NoError(err, "GenerateKey(2)")
+	require.NoError(ks.Add(1, k1), "Add(1)")
+	require.NoError(ks.Add(2, k2), "Add(2)")
+	require.Equal(ErrKeyExists, ks.Add(1, k2), "Add(): Duplicate")
+
+	_, err = ks.MarshalBinary()
+	require.Equal(ErrKeystoreUnlocked, err, "MarshalBinary(): Unlocked")
+	require.NoError(ks.Lock(pass), "Lock()")
+	require.True(ks.Locked(), "Locked()")
+	_, err = ks.Key(1)
+	require.Equal(ErrKeystoreLocked, err, "Key(): Locked")
+
+	b, err := ks.MarshalBinary()
+	require.NoError(err, "MarshalBinary()")
+
+	ks2 := new(Keystore)
+	require.NoError(ks2.UnmarshalBinary(b), "UnmarshalBinary()")
+	require.Equal(ErrBadPassphrase, ks2.Unlock(newPass), "Unlock(): Wrong passphrase")
+	require.NoError(ks2.Unlock(pass), "Unlock()")
+	ids, err := ks2.IDs()
+	require.NoError(err, "IDs()")
+	require.Equal([]uint32{1, 2}, ids, "IDs()")
+	k, err := ks2.Key(2)
+	require.NoError(err, "Key(2)")
+	require.Equal(k2, k, "Key(2)")
+
+	// Passphrase change.
+	require.NoError(ks2.Lock(pass), "Lock(): Relock")
+	require.Equal(ErrBadPassphrase, ks2.ChangePassphrase(newPass, pass), "ChangePassphrase(): Wrong passphrase")
+	require.NoError(ks2.ChangePassphrase(pass, newPass), "ChangePassphrase()")
+	require.True(ks2.Locked(), "ChangePassphrase(): Locked")
+	require.Equal(ErrBadPassphrase, ks2.Unlock(pass), "Unlock(): Old passphrase")
+	require.NoError(ks2.Unlock(newPass), "Unlock(): New passphrase")
+	k, err = ks2.Key(1)
+	require.NoError(err, "Key(1)")
+	require.Equal(k1, k, "Key(1)")
+
+	// The header is authenticated.
+	bad := append([]byte{}, b...)
+	bad[len(keystoreMagic)+2+4] ^= 1 // Salt
+	require.NoError(ks2.UnmarshalBinary(bad), "UnmarshalBinary(): Altered salt")
+	require.Equal(ErrBadPassphrase, ks2.Unlock(pass), "Unlock(): Altered salt")
+
+	bad = append([]byte{}, b...)
+	bad[len(keystoreMagic)+2+3] ^= 1 // Iterations
+	require.NoError(ks2.UnmarshalBinary(bad), "UnmarshalBinary(): Altered iterations")
+	require.Equal(ErrBadPassphrase, ks2.Unlock(pass), "Unlock(): Altered iterations")
+	binary.BigEndian.PutUint32(bad[len(keystoreMagic)+2:], MaxKeystoreIterations+1)
+	require.Equal(ErrInvalidKeystore, ks2.UnmarshalBinary(bad), "UnmarshalBinary(): Excessive iterations")
+	require.True(ks2.Locked(), "UnmarshalBinary(): Excessive iterations, locked")
+
+	// Strict parsing.
+	bad = append([]byte{}, b...)
+	bad[len(keystoreMagic)] = KeystoreVersion + 1
+	require.Equal(ErrUnsupportedKeystoreVersion, ks2.UnmarshalBinary(bad), "UnmarshalBinary(): Version")
+	bad = append([]byte{}, b...)
+	bad[len(keystoreMagic)+1] = 0
+	require.Equal(ErrUnsupportedKeystoreVersion, ks2.UnmarshalBinary(bad), "UnmarshalBinary(): KDF")
+	require.Equal(ErrInvalidKeystore, ks2.UnmarshalBinary(b[:keystoreHeaderSize]), "UnmarshalBinary(): Truncated")
+	require.Equal(ErrInvalidKeystore, ks2.UnmarshalBinary([]byte("garbage")), "UnmarshalBinary(): Garbage")
+
+	require.Equal(uint32(MaxKeystoreIterations), NewKeystore(MaxKeystoreIterations+1).iterations, "NewKeystore(): Excessive iterations")
+}
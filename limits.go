@@ -0,0 +1,227 @@
+// limits.go - Per-key usage limits
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrUsageLimit is the error returned when a LimitedAEAD's usage limits
+	// have been reached, and rekeying is disabled.
+	ErrUsageLimit = errors.New("norx: key usage limit reached")
+
+	// ErrMessageTooLarge is the error returned when a single message
+	// exceeds a LimitedAEAD's byte limit.
+	ErrMessageTooLarge = errors.New("norx: message exceeds usage limit")
+)
+
+// rekeyLabel is the label used to derive the next key from the current one.
+const rekeyLabel = "norx: next key"
+
+// UsageLimits are the per-key limits enforced by a LimitedAEAD.
+type UsageLimits struct {
+	// MaxMessages is the maximum number of messages processed per key,
+	// with 0 meaning unlimited.
+	MaxMessages uint64
+
+	// MaxBytes is the maximum number of plaintext bytes processed per key,
+	// with 0 meaning unlimited.
+	MaxBytes uint64
+
+	// Rekey enables automatically deriving the next key once a limit is
+	// reached, instead of failing with ErrUsageLimit.
+	Rekey bool
+}
+
+// LimitedAEAD is an AEAD instance that enforces per-key usage limits,
+// either by refusing to process more data, or by rekeying.
+//
+// The next key is derived from the current key with a one-way function,
+// and the current key is burned, so that a later compromise does not
+// expose data processed under earlier keys.  The sender and the receiver
+// of a stream of messages MUST process the messages in the same order, and
+// be configured with the same limits, so that both sides rekey at the same
+// point.  It is safe to call all of the methods concurrently, though doing
+// so will make the point at which the rekeying happens nondeterministic.
+type LimitedAEAD struct {
+	lock sync.Mutex
+
+	aead     *AEAD
+	limits   UsageLimits
+	messages uint64
+	bytes    uint64
+	epoch    uint64
+}
+
+// Epoch returns the number of times the key has been rekeyed.
+func (l *LimitedAEAD) Epoch() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.epoch
+}
+
+// Usage returns the number of messages and plaintext bytes processed under
+// the current key.
+func (l *LimitedAEAD) Usage() (messages, bytes uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.messages, l.bytes
+}
+
+// Overhead returns the maximum difference between the lengths of a plaintext
+// and its ciphertext.
+func (l *LimitedAEAD) Overhead() int {
+	return l.aead.Overhead()
+}
+
+// Seal encrypts and authenticates plaintext as with AEAD.Seal, after
+// accounting for the message, and rekeying if required.
+func (l *LimitedAEAD) Seal(dst, nonce, plaintext, header, footer []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.aead.isReset() {
+		return dst, ErrReset
+	}
+	mLen := uint64(len(plaintext))
+	needRekey, err := l.checkLimits(mLen)
+	if err != nil {
+		return dst, err
+	}
+	if needRekey {
+		var nextKey [KeySize]byte
+		l.aead.deriveNextKey(&nextKey)
+		l.commitRekey(&nextKey)
+	}
+	l.messages++
+	l.bytes += mLen
+
+	return l.aead.Seal(dst, nonce, plaintext, header, footer), nil
+}
+
+// Open decrypts and authenticates ciphertext as with AEAD.Open, after
+// accounting for the message, and rekeying if required.  Messages that fail
+// to authenticate are not counted, and will not cause a rekey.
+func (l *LimitedAEAD) Open(dst, nonce, ciphertext, header, footer []byte) ([]byte, error) {
+	if len(ciphertext) < TagSize {
+		return dst, ErrOpen
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.aead.isReset() {
+		return dst, ErrReset
+	}
+	mLen := uint64(len(ciphertext) - TagSize)
+	needRekey, err := l.checkLimits(mLen)
+	if err != nil {
+		return dst, err
+	}
+
+	var ret []byte
+	if !needRekey {
+		if ret, err = l.aead.Open(dst, nonce, ciphertext, header, footer); err != nil {
+			return ret, err
+		}
+	} else {
+		// Only commit to the next key if the message authenticates, so
+		// that forged messages can not desynchronize the receiver from
+		// the sender.
+		var nextKey [KeySize]byte
+		l.aead.deriveNextKey(&nextKey)
+		next := &AEAD{key: nextKey[:], perm: l.aead.perm}
+		if ret, err = next.Open(dst, nonce, ciphertext, header, footer); err != nil {
+			burnBytes(nextKey[:])
+			return ret, err
+		}
+		l.commitRekey(&nextKey)
+	}
+	l.messages++
+	l.bytes += mLen
+
+	return ret, nil
+}
+
+// Reset securely purges stored sensitive data from the instance.
+func (l *LimitedAEAD) Reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.aead.Reset()
+}
+
+// checkLimits returns true iff processing a message of mLen bytes requires
+// rekeying, or an error if the message may not be processed.
+func (l *LimitedAEAD) checkLimits(mLen uint64) (bool, error) {
+	if l.limits.MaxBytes != 0 && mLen > l.limits.MaxBytes {
+		return false, ErrMessageTooLarge
+	}
+
+	overLimit := (l.limits.MaxMessages != 0 && l.messages >= l.limits.MaxMessages) ||
+		(l.limits.MaxBytes != 0 && l.bytes+mLen > l.limits.MaxBytes)
+	if overLimit && !l.limits.Rekey {
+		return false, ErrUsageLimit
+	}
+
+	return overLimit, nil
+}
+
+// commitRekey replaces the current key with nextKey, and burns nextKey.
+func (l *LimitedAEAD) commitRekey(nextKey *[KeySize]byte) {
+	l.aead.setKey(nextKey[:])
+	burnBytes(nextKey[:])
+
+	l.messages, l.bytes = 0, 0
+	l.epoch++
+}
+
+// deriveNextKey derives the next key from the current key via a one way,
+// NORX permutation based update (see deriveKey), in a domain that Seal and
+// Open can not reach.
+func (ae *AEAD) deriveNextKey(nextKey *[KeySize]byte) {
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	deriveKey(ae.perm, nextKey[:], ae.key, rekeyLabel, nil)
+}
+
+// setKey replaces the key, overwriting (and thus burning) the current key.
+// It is a no-op if the instance has been Reset, so that a rekey racing
+// Reset can not resurrect a key.
+func (ae *AEAD) setKey(key []byte) {
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	if ae.reset {
+		return
+	}
+	copy(ae.key, key)
+
+	// Nonces may be reused with the new key.
+	if ae.nonceGuard != nil {
+		ae.nonceGuard.reset()
+	}
+}
+
+// NewLimitedAEAD returns a new LimitedAEAD enforcing the provided limits,
+// that takes ownership of aead.
+func NewLimitedAEAD(aead *AEAD, limits UsageLimits) *LimitedAEAD {
+	return &LimitedAEAD{
+		aead:   aead,
+		limits: limits,
+	}
+}
@@ -0,0 +1,112 @@
+// limits_test.go - Per-key usage limit tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedAEAD(t *testing.T) {
+	t.Run("Refuse", testLimitedAEADRefuse)
+	t.Run("Rekey", testLimitedAEADRekey)
+}
+
+func newTestLimitedAEADPair(t *testing.T, limits UsageLimits) (*LimitedAEAD, *LimitedAEAD, []byte) {
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.New(t).NoError(err, "rand.Read(k)")
+
+	return NewLimitedAEAD(newTestAEAD(k[:], 6), limits), NewLimitedAEAD(newTestAEAD(k[:], 6), limits), k[:]
+}
+
+func testLimitedAEADRefuse(t *testing.T) {
+	require := require.New(t)
+
+	var nonce [NonceSize]byte
+	sender, _, _ := newTestLimitedAEADPair(t, UsageLimits{MaxMessages: 2, MaxBytes: 100})
+
+	_, err := sender.Seal(nil, nonce[:], make([]byte, 101), nil, nil)
+	require.Equal(ErrMessageTooLarge, err, "Seal(): Too large")
+	require.PanicsWithValue(ErrInvalidNonceSize, func() {
+		_, _ = sender.Seal(nil, nonce[:NonceSize-1], nil, nil, nil)
+	}, "Seal(): Invalid nonce")
+	messages, _ := sender.Usage()
+	require.Zero(messages, "Usage(): Invalid nonce")
+
+	_, err = sender.Seal(nil, nonce[:], make([]byte, 60), nil, nil)
+	require.NoError(err, "Seal(0)")
+	_, err = sender.Seal(nil, nonce[:], make([]byte, 41), nil, nil)
+	require.Equal(ErrUsageLimit, err, "Seal(): Byte limit")
+	_, err = sender.Seal(nil, nonce[:], make([]byte, 40), nil, nil)
+	require.NoError(err, "Seal(1)")
+	_, err = sender.Seal(nil, nonce[:], nil, nil, nil)
+	require.Equal(ErrUsageLimit, err, "Seal(): Message limit")
+
+	messages, bytes := sender.Usage()
+	require.Equal(uint64(2), messages, "Usage(): Messages")
+	require.Equal(uint64(100), bytes, "Usage(): Bytes")
+	require.Zero(sender.Epoch(), "Epoch()")
+}
+
+func testLimitedAEADRekey(t *testing.T) {
+	require := require.New(t)
+
+	var nonce [NonceSize]byte
+	sender, receiver, k := newTestLimitedAEADPair(t, UsageLimits{MaxMessages: 3, MaxBytes: 256, Rekey: true})
+	orig := newTestAEAD(k, 6)
+
+	var cts [][]byte
+	for i := 0; i < 10; i++ {
+		msg := make([]byte, i*20+1)
+		ct, err := sender.Seal(nil, nonce[:], msg, nil, nil)
+		require.NoError(err, "Seal(%d)", i)
+		cts = append(cts, ct)
+
+		// Forged messages must not cause the receiver to rekey.
+		forged := append([]byte{}, ct...)
+		forged[0] ^= 0xa5
+		_, err = receiver.Open(nil, nonce[:], forged, nil, nil)
+		require.Equal(ErrOpen, err, "Open(%d): Forged", i)
+
+		pt, err := receiver.Open(nil, nonce[:], ct, nil, nil)
+		require.NoError(err, "Open(%d)", i)
+		require.Equal(msg, pt, "Open(%d)", i)
+	}
+	require.Equal(sender.Epoch(), receiver.Epoch(), "Epoch(): Sender/receiver")
+	require.Equal(uint64(5), sender.Epoch(), "Epoch()")
+	require.NotEqual(k, sender.aead.key, "Rekey: Key unchanged")
+
+	// Only the messages prior to the first rekey are decryptable with the
+	// original key.
+	for i, ct := range cts {
+		_, err := orig.Open(nil, nonce[:], ct, nil, nil)
+		if i < 3 {
+			require.NoError(err, "Open(%d): Original key", i)
+		} else {
+			require.Equal(ErrOpen, err, "Open(%d): Original key", i)
+		}
+	}
+
+	// The derivation is deterministic.
+	var k1, k1Again [KeySize]byte
+	orig.deriveNextKey(&k1)
+	orig.deriveNextKey(&k1Again)
+	require.Equal(k1, k1Again, "deriveNextKey(): Deterministic")
+	require.NotEqual(k, k1[:], "deriveNextKey(): Identity")
+
+	// Nonce guards are reset on rekey, as nonces may be reused.
+	g, _, _ := newTestLimitedAEADPair(t, UsageLimits{MaxMessages: 1, Rekey: true})
+	g.aead.EnableNonceGuard(nil)
+	for i := 0; i < 3; i++ {
+		_, err := g.Seal(nil, nonce[:], nil, nil, nil)
+		require.NoError(err, "Seal(%d): Nonce guard", i)
+	}
+}
@@ -0,0 +1,335 @@
+// log.go - Append-only encrypted log
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// LogVersion is the log format version.
+	LogVersion = 1
+
+	// LogHeaderSize is the size of the log header.
+	LogHeaderSize = len(logMagic) + 1 + 1 + NonceSize
+
+	// MaxLogRecordSize is the maximum size of a log record's payload.
+	MaxLogRecordSize = 16 * 1024 * 1024
+
+	logMagic    = "NORXLOG\x00"
+	logKeyLabel = "norx: log key"
+
+	logRecordData  = 1
+	logRecordClose = 2
+
+	logRecordHeaderSize = 4 + 1
+	logRecordADSize     = LogHeaderSize + 8 + 1 + TagSize + 4
+)
+
+var (
+	// ErrInvalidLog is the error returned when a log is malformed, or is of
+	// a different variant.
+	ErrInvalidLog = errors.New("norx: invalid log")
+
+	// ErrUnsupportedLogVersion is the error returned when a log has an
+	// unknown format version.
+	ErrUnsupportedLogVersion = errors.New("norx: unsupported log version")
+
+	// ErrLogTruncated is the error returned when a log ends without a close
+	// record.
+	ErrLogTruncated = errors.New("norx: log truncated")
+
+	// ErrLogClosed is the error returned when appending to a closed log.
+	ErrLogClosed = errors.New("norx: log closed")
+
+	// ErrLogRecordTooLarge is the error returned when appending a record
+	// that is larger than MaxLogRecordSize.
+	ErrLogRecordTooLarge = errors.New("norx: log record too large")
+)
+
+// LogWriter is an append-only, tamper-evident encrypted log.
+//
+// Each record is sealed with a nonce derived from the log nonce and the
+// record's sequence number, with the previous record's tag chained into the
+// additional data, so that removing, reordering, or modifying records
+// breaks the chain.  Closing the log appends an authenticated close record,
+// so that truncation of the tail is also detected.  The format is:
+//
+//	magic   [8]byte // "NORXLOG\x00"
+//	version uint8   // LogVersion
+//	variant uint8   // Variant
+//	nonce   [NonceSize]byte
+//	records []struct {
+//		length     uint32 // Big endian, of the ciphertext and tag.
+//		kind       uint8  // 1 = data, 2 = close (empty payload)
+//		ciphertext [length]byte
+//	}
+//
+// Record n is sealed with a per-log subkey derived from the key and the
+// nonce, with the big endian n (left padded with zeros) as the nonce, and
+// the log header, big endian n, kind, the tag of record n-1
+// (all zeros for the first record), and length as the header.
+type LogWriter struct {
+	aead *AEAD
+	w    io.Writer
+	hdr  [LogHeaderSize]byte
+	key  [KeySize]byte
+	seq  uint64
+	prev [TagSize]byte
+	err  error
+}
+
+// Append seals p as the next record, and writes it to the underlying
+// writer.  Errors are sticky.
+func (l *LogWriter) Append(p []byte) error {
+	if l.err != nil {
+		return l.err
+	}
+	if len(p) > MaxLogRecordSize {
+		return ErrLogRecordTooLarge
+	}
+
+	if l.err = l.writeRecord(logRecordData, p); l.err != nil {
+		burnBytes(l.key[:])
+	}
+	return l.err
+}
+
+// Sequence returns the sequence number of the next record.
+func (l *LogWriter) Sequence() uint64 {
+	return l.seq
+}
+
+// Close appends the close record, and writes it to the underlying writer,
+// which is not closed, and burns the per-log subkey.
+func (l *LogWriter) Close() error {
+	defer burnBytes(l.key[:])
+
+	if l.err != nil {
+		if l.err == ErrLogClosed {
+			return nil
+		}
+		return l.err
+	}
+
+	if l.err = l.writeRecord(logRecordClose, nil); l.err != nil {
+		return l.err
+	}
+	l.err = ErrLogClosed
+	return nil
+}
+
+func (l *LogWriter) writeRecord(kind byte, p []byte) error {
+	var nonce [NonceSize]byte
+	var ad [logRecordADSize]byte
+	logRecordAD(&ad, nonce[:], l.hdr[:], l.seq, kind, l.prev[:], len(p)+TagSize)
+
+	rec := make([]byte, logRecordHeaderSize, logRecordHeaderSize+len(p)+TagSize)
+	binary.BigEndian.PutUint32(rec, uint32(len(p)+TagSize))
+	rec[4] = kind
+
+	l.aead.lock.RLock()
+	if l.aead.reset {
+		l.aead.lock.RUnlock()
+		return ErrReset
+	}
+	rec = aeadEncrypt(l.aead.perm, rec, ad[:], p, nil, nonce[:], l.key[:])
+	l.aead.lock.RUnlock()
+
+	if _, err := l.w.Write(rec); err != nil {
+		return err
+	}
+	copy(l.prev[:], rec[len(rec)-TagSize:])
+	l.seq++
+
+	return nil
+}
+
+// LogReader reads and verifies a log written by a LogWriter.
+type LogReader struct {
+	aead *AEAD
+	r    io.Reader
+	hdr  [LogHeaderSize]byte
+	key  [KeySize]byte
+	seq  uint64
+	prev [TagSize]byte
+	err  error
+}
+
+// Next returns the payload of the next record, after verifying it and its
+// position in the chain.  After the close record, Next returns io.EOF, and
+// if the log ends without one, Next returns ErrLogTruncated.  Any failure to
+// authenticate a record results in ErrOpen.  Errors are sticky, and the
+// per-log subkey is burned once Next returns one (including io.EOF).
+func (l *LogReader) Next() ([]byte, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	var p []byte
+	if p, l.err = l.readRecord(); l.err != nil {
+		burnBytes(l.key[:])
+	}
+	return p, l.err
+}
+
+// Sequence returns the sequence number of the next record.
+func (l *LogReader) Sequence() uint64 {
+	return l.seq
+}
+
+func (l *LogReader) readRecord() ([]byte, error) {
+	var recHdr [logRecordHeaderSize]byte
+	if _, err := io.ReadFull(l.r, recHdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrLogTruncated
+		}
+		return nil, err
+	}
+	length, kind := int(binary.BigEndian.Uint32(recHdr[:])), recHdr[4]
+	if length < TagSize || length > MaxLogRecordSize+TagSize {
+		return nil, ErrInvalidLog
+	}
+	switch kind {
+	case logRecordData:
+	case logRecordClose:
+		if length != TagSize {
+			return nil, ErrInvalidLog
+		}
+	default:
+		return nil, ErrInvalidLog
+	}
+
+	ct := make([]byte, length)
+	if _, err := io.ReadFull(l.r, ct); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrLogTruncated
+		}
+		return nil, err
+	}
+
+	var nonce [NonceSize]byte
+	var ad [logRecordADSize]byte
+	logRecordAD(&ad, nonce[:], l.hdr[:], l.seq, kind, l.prev[:], length)
+
+	l.aead.lock.RLock()
+	if l.aead.reset {
+		l.aead.lock.RUnlock()
+		return nil, ErrReset
+	}
+	p, ok := aeadDecrypt(l.aead.perm, nil, ad[:], ct, nil, nonce[:], l.key[:])
+	l.aead.lock.RUnlock()
+	if !ok {
+		return nil, ErrOpen
+	}
+	copy(l.prev[:], ct[length-TagSize:])
+	l.seq++
+
+	if kind == logRecordClose {
+		// Nothing may follow the close record.
+		var b [1]byte
+		if n, _ := io.ReadFull(l.r, b[:]); n != 0 {
+			return nil, ErrInvalidLog
+		}
+		return nil, io.EOF
+	}
+	if p == nil {
+		p = []byte{}
+	}
+	return p, nil
+}
+
+// NewLogWriter returns a new LogWriter that writes to w, starting with the
+// log header, with the provided nonce, which MUST be unique for all time,
+// for a given key.
+func (ae *AEAD) NewLogWriter(w io.Writer, nonce []byte) (*LogWriter, error) {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	l := &LogWriter{
+		aead: ae,
+		w:    w,
+	}
+	off := copy(l.hdr[:], logMagic)
+	l.hdr[off], l.hdr[off+1] = LogVersion, byte(ae.Variant())
+	copy(l.hdr[off+2:], nonce)
+
+	ae.lock.RLock()
+	if ae.reset {
+		ae.lock.RUnlock()
+		return nil, ErrReset
+	}
+	if ae.nonceGuard != nil {
+		ae.nonceGuard.check(nonce)
+	}
+	ae.logKey(&l.key, l.hdr[:])
+	ae.lock.RUnlock()
+
+	if _, err := w.Write(l.hdr[:]); err != nil {
+		burnBytes(l.key[:])
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// NewLogReader returns a new LogReader that reads from r, starting with the
+// log header.
+func (ae *AEAD) NewLogReader(r io.Reader) (*LogReader, error) {
+	l := &LogReader{
+		aead: ae,
+		r:    r,
+	}
+	hdr := l.hdr[:]
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrInvalidLog
+		}
+		return nil, err
+	}
+	off := len(logMagic)
+	if string(hdr[:off]) != logMagic {
+		return nil, ErrInvalidLog
+	}
+	if hdr[off] != LogVersion {
+		return nil, ErrUnsupportedLogVersion
+	}
+	if hdr[off+1] != byte(ae.Variant()) {
+		return nil, ErrInvalidLog
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return nil, ErrReset
+	}
+	ae.logKey(&l.key, hdr)
+
+	return l, nil
+}
+
+// logKey derives the per-log subkey from the key and the log nonce in the
+// header.  The caller must hold the read lock.
+func (ae *AEAD) logKey(key *[KeySize]byte, hdr []byte) {
+	deriveKey(ae.perm, key[:], ae.key, logKeyLabel, hdr[LogHeaderSize-NonceSize:])
+}
+
+// logRecordAD sets the nonce for a record under the per-log subkey, and
+// the additional data.
+func logRecordAD(ad *[logRecordADSize]byte, nonce, hdr []byte, seq uint64, kind byte, prev []byte, length int) {
+	off := copy(ad[:], hdr)
+	binary.BigEndian.PutUint64(ad[off:], seq)
+	copy(nonce[NonceSize-8:], ad[off:off+8])
+	ad[off+8] = kind
+	copy(ad[off+9:], prev)
+	binary.BigEndian.PutUint32(ad[off+9+TagSize:], uint32(length))
+}
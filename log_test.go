@@ -0,0 +1,127 @@
+// log_test.go - Append-only encrypted log tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	_, err = rand.Read(nonce[:])
+	require.NoError(err, "rand.Read(nonce)")
+	aead := newTestAEAD(k[:], 4)
+
+	records := [][]byte{
+		[]byte("user alice logged in"),
+		{},
+		[]byte("user alice deleted everything"),
+		[]byte("user alice logged out"),
+	}
+
+	var buf bytes.Buffer
+	w, err := aead.NewLogWriter(&buf, nonce[:])
+	require.NoError(err, "NewLogWriter()")
+	offsets := []int{buf.Len()}
+	for i, rec := range records {
+		require.NoError(w.Append(rec), "Append(%d)", i)
+		offsets = append(offsets, buf.Len())
+	}
+	require.Equal(uint64(len(records)), w.Sequence(), "Sequence()")
+	require.NoError(w.Close(), "Close()")
+	require.Equal(make([]byte, KeySize), w.key[:], "Close(): Subkey")
+	require.NoError(w.Close(), "Close(): Twice")
+	require.Equal(ErrLogClosed, w.Append([]byte("late")), "Append(): Closed")
+	require.Equal(ErrLogRecordTooLarge, (&LogWriter{}).Append(make([]byte, MaxLogRecordSize+1)), "Append(): Too large")
+
+	log := buf.Bytes()
+	readAll := func(b []byte) ([][]byte, error) {
+		r, err := aead.NewLogReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		var recs [][]byte
+		for {
+			rec, err := r.Next()
+			if err != nil {
+				require.Equal(make([]byte, KeySize), r.key[:], "Next(): Subkey")
+			}
+			if err == io.EOF {
+				return recs, nil
+			} else if err != nil {
+				return recs, err
+			}
+			recs = append(recs, rec)
+		}
+	}
+
+	recs, err := readAll(log)
+	require.NoError(err, "Next()")
+	require.Equal(records, recs, "Next()")
+
+	// Truncation at a record boundary (including removing the close
+	// record), or mid-record is detected.
+	for i, off := range offsets {
+		recs, err = readAll(log[:off])
+		require.Equal(ErrLogTruncated, err, "Next(): Truncated at record %d", i)
+		require.Len(recs, i, "Next(): Truncated at record %d", i)
+		if i > 0 {
+			require.Equal(records[:i], recs, "Next(): Truncated at record %d", i)
+		}
+	}
+	_, err = readAll(log[:len(log)-1])
+	require.Equal(ErrLogTruncated, err, "Next(): Truncated mid-record")
+
+	// Removing, reordering, or modifying records breaks the chain.
+	removed := append(append([]byte{}, log[:offsets[1]]...), log[offsets[2]:]...)
+	recs, err = readAll(removed)
+	require.Equal(ErrOpen, err, "Next(): Removed record")
+	require.Equal(records[:1], recs, "Next(): Removed record")
+
+	swapped := append([]byte{}, log[:offsets[2]]...)
+	swapped = append(swapped, log[offsets[3]:offsets[4]]...)
+	swapped = append(swapped, log[offsets[2]:offsets[3]]...)
+	swapped = append(swapped, log[offsets[4]:]...)
+	_, err = readAll(swapped)
+	require.Equal(ErrOpen, err, "Next(): Swapped records")
+
+	bad := append([]byte{}, log...)
+	bad[offsets[2]+logRecordHeaderSize] ^= 0x01
+	_, err = readAll(bad)
+	require.Equal(ErrOpen, err, "Next(): Modified record")
+
+	bad = append([]byte{}, log...)
+	bad[offsets[1]+4] = logRecordClose
+	_, err = readAll(bad)
+	require.Equal(ErrOpen, err, "Next(): Forged close")
+	bad[offsets[0]+4] = logRecordClose
+	_, err = readAll(bad)
+	require.Equal(ErrInvalidLog, err, "Next(): Forged close, non-empty")
+
+	_, err = readAll(append(append([]byte{}, log...), 0))
+	require.Equal(ErrInvalidLog, err, "Next(): Trailing garbage")
+
+	bad = append([]byte{}, log...)
+	bad[len(logMagic)] = LogVersion + 1
+	_, err = readAll(bad)
+	require.Equal(ErrUnsupportedLogVersion, err, "NewLogReader(): Version")
+	_, err = newTestAEAD(k[:], 6).NewLogReader(bytes.NewReader(log))
+	require.Equal(ErrInvalidLog, err, "NewLogReader(): Variant")
+	_, err = aead.NewLogReader(bytes.NewReader(log[:LogHeaderSize-1]))
+	require.Equal(ErrInvalidLog, err, "NewLogReader(): Truncated")
+}
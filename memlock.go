@@ -0,0 +1,79 @@
+// memlock.go - Locked key storage
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrLockedMemoryUnsupported is the error returned when locked memory is not
+// supported on the platform.
+var ErrLockedMemoryUnsupported = errors.New("norx: locked memory not supported")
+
+// LockMemory moves the AEAD instance's key into a dedicated memory mapping
+// that is locked into RAM, excluded from core dumps, and surrounded by
+// inaccessible guard pages, and purges the original copy.  The mapping is
+// wiped and released by Reset, or by a finalizer if the instance is garbage
+// collected without being Reset.
+//
+// This is currently only supported on Linux, and may fail if the process'
+// RLIMIT_MEMLOCK is exhausted.  Calling LockMemory on an instance that
+// already uses locked memory is a no-op.
+func (ae *AEAD) LockMemory() error {
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	if ae.reset {
+		return ErrReset
+	}
+	if ae.lockedKey != nil {
+		return nil
+	}
+
+	b, err := newLockedBuffer(KeySize)
+	if err != nil {
+		return err
+	}
+	runtime.SetFinalizer(b, (*lockedBuffer).destroy)
+
+	copy(b.data, ae.key)
+	burnBytes(ae.key)
+	ae.key, ae.lockedKey = b.data, b
+
+	return nil
+}
+
+// unlockMemory wipes and releases the locked memory backing the key if any,
+// leaving the instance with an all zero heap allocated key.
+func (ae *AEAD) unlockMemory() {
+	if ae.lockedKey == nil {
+		return
+	}
+
+	ae.key = make([]byte, KeySize)
+	ae.lockedKey.destroy()
+	ae.lockedKey = nil
+}
+
+// lockedBuffer is a buffer backed by locked memory.
+type lockedBuffer struct {
+	mapping []byte
+	data    []byte
+}
+
+func (b *lockedBuffer) destroy() {
+	if b.mapping == nil {
+		return
+	}
+	runtime.SetFinalizer(b, nil)
+
+	burnBytes(b.data)
+	b.release()
+	b.mapping, b.data = nil, nil
+}
@@ -0,0 +1,62 @@
+// memlock_linux.go - Locked key storage (Linux)
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build linux
+
+package norx
+
+import (
+	"os"
+	"syscall"
+)
+
+// madvDontDump is MADV_DONTDUMP, which the syscall package does not define.
+const madvDontDump = 0x10
+
+// newLockedBuffer returns a new locked buffer of size bytes.  The buffer is
+// placed at the end of the locked region, immediately followed by a guard
+// page, so that overflows fault, and the region is preceded by another
+// guard page.
+func newLockedBuffer(size int) (*lockedBuffer, error) {
+	pageSize := os.Getpagesize()
+	inner := (size + pageSize - 1) / pageSize * pageSize
+
+	mapping, err := syscall.Mmap(-1, 0, inner+2*pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	region := mapping[pageSize : pageSize+inner]
+
+	if err = setupLockedRegion(mapping, region, pageSize); err != nil {
+		syscall.Munmap(mapping)
+		return nil, err
+	}
+
+	return &lockedBuffer{
+		mapping: mapping,
+		data:    region[inner-size:],
+	}, nil
+}
+
+func setupLockedRegion(mapping, region []byte, pageSize int) error {
+	if err := syscall.Mprotect(mapping[:pageSize], syscall.PROT_NONE); err != nil {
+		return err
+	}
+	if err := syscall.Mprotect(mapping[len(mapping)-pageSize:], syscall.PROT_NONE); err != nil {
+		return err
+	}
+	if err := syscall.Madvise(region, madvDontDump); err != nil {
+		return err
+	}
+	return syscall.Mlock(region)
+}
+
+func (b *lockedBuffer) release() {
+	pageSize := os.Getpagesize()
+	syscall.Munlock(b.mapping[pageSize : len(b.mapping)-pageSize])
+	syscall.Munmap(b.mapping)
+}
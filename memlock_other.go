@@ -0,0 +1,16 @@
+// memlock_other.go - Locked key storage (unsupported)
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build !linux
+
+package norx
+
+func newLockedBuffer(size int) (*lockedBuffer, error) {
+	return nil, ErrLockedMemoryUnsupported
+}
+
+func (b *lockedBuffer) release() {}
@@ -0,0 +1,51 @@
+// memlock_test.go - Locked key storage tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockMemory(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+
+	aead := newTestAEAD(k[:], 6)
+	heapKey := aead.key
+	expected := aead.Seal(nil, nonce[:], []byte("locked"), nil, nil)
+
+	err = aead.LockMemory()
+	if err == ErrLockedMemoryUnsupported {
+		t.Skip("locked memory not supported")
+	}
+	require.NoError(err, "LockMemory()")
+	require.Equal(make([]byte, KeySize), heapKey, "LockMemory(): Heap copy burned")
+	require.Equal(k[:], aead.key, "LockMemory(): Key")
+	require.Equal(expected, aead.Seal(nil, nonce[:], []byte("locked"), nil, nil), "Seal(): Locked")
+	require.NoError(aead.LockMemory(), "LockMemory(): Idempotent")
+
+	// Rekeying updates the key in place.
+	locked := aead.lockedKey
+	var next [KeySize]byte
+	aead.deriveNextKey(&next)
+	aead.setKey(next[:])
+	require.Equal(next[:], locked.data, "setKey(): In place")
+
+	aead.Reset()
+	require.Nil(aead.lockedKey, "Reset(): Released")
+	require.Nil(locked.mapping, "Reset(): Unmapped")
+	require.Equal(make([]byte, KeySize), aead.key, "Reset(): Key")
+	require.NotPanics(func() { aead.Reset() }, "Reset(): Twice")
+}
@@ -0,0 +1,312 @@
+// nonce.go - Nonce sources
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+const (
+	// NonceCounterSize is the size of the counter used by the counter based
+	// nonce sources, which occupies the last bytes of the nonce.
+	NonceCounterSize = 8
+
+	// NoncePrefixSize is the maximum size of the prefix used by the counter
+	// based nonce sources.
+	NoncePrefixSize = NonceSize - NonceCounterSize
+)
+
+var (
+	// ErrNonceExhausted is the error returned when a nonce source can not
+	// provide any more unique nonces.
+	ErrNonceExhausted = errors.New("norx: nonce source exhausted")
+
+	// ErrInvalidNoncePrefixSize is the error returned when a nonce prefix
+	// is an invalid size.
+	ErrInvalidNoncePrefixSize = errors.New("norx: invalid nonce prefix size")
+
+	// ErrInvalidNonceFile is the error returned when a persisted nonce
+	// counter file is malformed.
+	ErrInvalidNonceFile = errors.New("norx: invalid nonce counter file")
+
+	// ErrInvalidNonceBufferSize is the error returned when the buffer
+	// passed to NextNonce is not NonceSize bytes long.
+	ErrInvalidNonceBufferSize = errors.New("norx: invalid nonce buffer size")
+)
+
+// NonceSource is a source of nonces, that will not repeat for the lifetime
+// of the source.  All of the provided implementations are safe for
+// concurrent use.
+type NonceSource interface {
+	// NextNonce writes the next nonce to nonce, which must be NonceSize
+	// bytes long, otherwise ErrInvalidNonceBufferSize is returned.
+	NextNonce(nonce []byte) error
+}
+
+// RandomNonceSource is a NonceSource that returns random nonces.  With a
+// 256 bit nonce, the probability of a collision is negligible.
+type RandomNonceSource struct {
+	rand io.Reader
+}
+
+// NextNonce writes the next nonce to nonce.
+func (src *RandomNonceSource) NextNonce(nonce []byte) error {
+	if len(nonce) != NonceSize {
+		return ErrInvalidNonceBufferSize
+	}
+	_, err := io.ReadFull(src.rand, nonce)
+	return err
+}
+
+// NewRandomNonceSource returns a new RandomNonceSource, reading entropy from
+// r, or crypto/rand.Reader if r is nil.
+func NewRandomNonceSource(r io.Reader) *RandomNonceSource {
+	if r == nil {
+		r = rand.Reader
+	}
+	return &RandomNonceSource{rand: r}
+}
+
+// CounterNonceSource is a NonceSource that returns nonces consisting of a
+// fixed prefix, followed by a monotonically increasing big endian counter.
+//
+// Nonces are only unique for as long as the prefix is unique per instance,
+// so the prefix MUST NOT be reused across instances (or process restarts)
+// unless the starting counter value is known to be past all prior values.
+type CounterNonceSource struct {
+	lock sync.Mutex
+
+	nonce     [NonceSize]byte
+	next      uint64
+	exhausted bool
+}
+
+// NextNonce writes the next nonce to nonce.
+func (src *CounterNonceSource) NextNonce(nonce []byte) error {
+	if len(nonce) != NonceSize {
+		return ErrInvalidNonceBufferSize
+	}
+
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	if src.exhausted {
+		return ErrNonceExhausted
+	}
+	putNonceCounter(&src.nonce, src.next)
+	copy(nonce, src.nonce[:])
+
+	if src.next == math.MaxUint64 {
+		src.exhausted = true
+	}
+	src.next++
+
+	return nil
+}
+
+// NewCounterNonceSource returns a new CounterNonceSource, with the provided
+// prefix (at most NoncePrefixSize bytes, zero padded), and initial counter
+// value.
+func NewCounterNonceSource(prefix []byte, start uint64) (*CounterNonceSource, error) {
+	src := &CounterNonceSource{next: start}
+	if err := initNoncePrefix(&src.nonce, prefix); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// NewHybridNonceSource returns a new CounterNonceSource, with a random
+// NoncePrefixSize byte prefix read from r (or crypto/rand.Reader if r is
+// nil), and the counter starting at 0.  The random prefix makes it safe to
+// create a new instance on every process start without persisting any
+// state, while the counter guarantees uniqueness within an instance.
+func NewHybridNonceSource(r io.Reader) (*CounterNonceSource, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+
+	var prefix [NoncePrefixSize]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	return NewCounterNonceSource(prefix[:], 0)
+}
+
+// FileNonceSource is a NonceSource that returns nonces consisting of a
+// fixed prefix, followed by a monotonically increasing big endian counter,
+// that is persisted to a file so that restarts never reuse a value.
+//
+// Counter values are reserved in blocks, with the end of the reserved block
+// being written (and synced) to the file before any of the values in the
+// block are used, so that a crash will at worst skip the remainder of the
+// block.  The file MUST NOT be used by more than one instance at a time.
+type FileNonceSource struct {
+	lock sync.Mutex
+
+	f         *os.File
+	nonce     [NonceSize]byte
+	next      uint64
+	limit     uint64
+	blockSize uint64
+}
+
+// NextNonce writes the next nonce to nonce.
+func (src *FileNonceSource) NextNonce(nonce []byte) error {
+	if len(nonce) != NonceSize {
+		return ErrInvalidNonceBufferSize
+	}
+
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	if src.f == nil {
+		return os.ErrClosed
+	}
+	if src.next == src.limit {
+		if src.limit == math.MaxUint64 {
+			return ErrNonceExhausted
+		}
+
+		limit := src.limit + src.blockSize
+		if limit < src.limit {
+			limit = math.MaxUint64
+		}
+		if err := src.persist(limit); err != nil {
+			return err
+		}
+		src.limit = limit
+	}
+
+	putNonceCounter(&src.nonce, src.next)
+	copy(nonce, src.nonce[:])
+	src.next++
+
+	return nil
+}
+
+// Close releases the unused portion of the current reservation, and closes
+// the underlying file.
+func (src *FileNonceSource) Close() error {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	if src.f == nil {
+		return nil
+	}
+
+	err := src.persist(src.next)
+	if cErr := src.f.Close(); err == nil {
+		err = cErr
+	}
+	src.f = nil
+
+	return err
+}
+
+func (src *FileNonceSource) persist(v uint64) error {
+	var b [NonceCounterSize]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	if _, err := src.f.WriteAt(b[:], 0); err != nil {
+		return err
+	}
+	return src.f.Sync()
+}
+
+// OpenFileNonceSource returns a new FileNonceSource, with the provided
+// prefix (at most NoncePrefixSize bytes, zero padded), that persists the
+// counter to the file at path, creating it if needed.  The counter values
+// are reserved blockSize at a time.
+func OpenFileNonceSource(path string, prefix []byte, blockSize uint64) (*FileNonceSource, error) {
+	if blockSize == 0 {
+		return nil, errors.New("norx: invalid nonce reservation block size")
+	}
+
+	src := &FileNonceSource{blockSize: blockSize}
+	if err := initNoncePrefix(&src.nonce, prefix); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if src.next, err = readNonceFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	src.f, src.limit = f, src.next
+
+	return src, nil
+}
+
+func readNonceFile(f *os.File) (uint64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	switch fi.Size() {
+	case 0:
+		// Newly created, the counter starts at 0.
+		return 0, nil
+	case NonceCounterSize:
+		var b [NonceCounterSize]byte
+		if _, err = f.ReadAt(b[:], 0); err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b[:]), nil
+	default:
+		return 0, ErrInvalidNonceFile
+	}
+}
+
+func initNoncePrefix(nonce *[NonceSize]byte, prefix []byte) error {
+	if len(prefix) > NoncePrefixSize {
+		return ErrInvalidNoncePrefixSize
+	}
+	copy(nonce[:], prefix)
+	return nil
+}
+
+func putNonceCounter(nonce *[NonceSize]byte, v uint64) {
+	binary.BigEndian.PutUint64(nonce[NoncePrefixSize:], v)
+}
+
+// SealWithNonceSource encrypts and authenticates plaintext as with Seal,
+// using a nonce obtained from src, and appends the nonce followed by the
+// result to dst, returning the updated slice.  The output is NonceSize()
+// bytes longer than that of Seal, and can be decrypted with OpenPrefixed.
+//
+// The plaintext and dst must not overlap.
+func (ae *AEAD) SealWithNonceSource(dst []byte, src NonceSource, plaintext, header, footer []byte) ([]byte, error) {
+	if ae.isReset() {
+		return dst, ErrReset
+	}
+
+	ret, nonce := sliceForAppend(dst, NonceSize)
+	if err := src.NextNonce(nonce); err != nil {
+		return dst, err
+	}
+	return ae.Seal(ret, nonce, plaintext, header, footer), nil
+}
+
+// OpenPrefixed decrypts and authenticates ciphertext as with Open, where
+// the nonce is prepended to the ciphertext, as by SealWithNonceSource.
+func (ae *AEAD) OpenPrefixed(dst, ciphertext, header, footer []byte) ([]byte, error) {
+	if len(ciphertext) < NonceSize {
+		return dst, ErrOpen
+	}
+	return ae.Open(dst, ciphertext[:NonceSize], ciphertext[NonceSize:], header, footer)
+}
@@ -0,0 +1,180 @@
+// nonce_test.go - Nonce source tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceSource(t *testing.T) {
+	t.Run("Random", testNonceSourceRandom)
+	t.Run("Counter", testNonceSourceCounter)
+	t.Run("Hybrid", testNonceSourceHybrid)
+	t.Run("File", testNonceSourceFile)
+	t.Run("SealWithNonceSource", testSealWithNonceSource)
+}
+
+func testNonceSourceRandom(t *testing.T) {
+	require := require.New(t)
+
+	src := NewRandomNonceSource(nil)
+	var n0, n1 [NonceSize]byte
+	require.NoError(src.NextNonce(n0[:]), "NextNonce(0)")
+	require.NoError(src.NextNonce(n1[:]), "NextNonce(1)")
+	require.NotEqual(n0, n1, "NextNonce(): Repeated")
+
+	require.Equal(ErrInvalidNonceBufferSize, src.NextNonce(n0[:NonceSize-1]), "NextNonce(short)")
+
+	src = NewRandomNonceSource(bytes.NewReader(make([]byte, NonceSize+1)))
+	require.NoError(src.NextNonce(n0[:]), "NextNonce(): Limited reader")
+	require.Error(src.NextNonce(n0[:]), "NextNonce(): Exhausted reader")
+}
+
+func testNonceSourceCounter(t *testing.T) {
+	require := require.New(t)
+
+	prefix := []byte("prefix")
+	src, err := NewCounterNonceSource(prefix, 0xfffffffffffffffe)
+	require.NoError(err, "NewCounterNonceSource()")
+
+	var nonce [NonceSize]byte
+	for _, v := range []uint64{0xfffffffffffffffe, math.MaxUint64} {
+		require.NoError(src.NextNonce(nonce[:]), "NextNonce()")
+		require.Equal(prefix, nonce[:len(prefix)], "NextNonce(): Prefix")
+		require.Equal(make([]byte, NoncePrefixSize-len(prefix)), nonce[len(prefix):NoncePrefixSize], "NextNonce(): Padding")
+		require.Equal(v, binary.BigEndian.Uint64(nonce[NoncePrefixSize:]), "NextNonce(): Counter")
+	}
+	require.Equal(ErrNonceExhausted, src.NextNonce(nonce[:]), "NextNonce(): Wrapped")
+	require.Equal(ErrInvalidNonceBufferSize, src.NextNonce(nonce[:NonceSize-1]), "NextNonce(short)")
+
+	_, err = NewCounterNonceSource(make([]byte, NoncePrefixSize+1), 0)
+	require.Equal(ErrInvalidNoncePrefixSize, err, "NewCounterNonceSource(): Long prefix")
+}
+
+func testNonceSourceHybrid(t *testing.T) {
+	require := require.New(t)
+
+	src0, err := NewHybridNonceSource(nil)
+	require.NoError(err, "NewHybridNonceSource(0)")
+	src1, err := NewHybridNonceSource(nil)
+	require.NoError(err, "NewHybridNonceSource(1)")
+
+	var n0, n1 [NonceSize]byte
+	require.NoError(src0.NextNonce(n0[:]), "NextNonce(0)")
+	require.NoError(src1.NextNonce(n1[:]), "NextNonce(1)")
+	require.NotEqual(n0[:NoncePrefixSize], n1[:NoncePrefixSize], "NextNonce(): Prefix")
+	require.Equal(n0[NoncePrefixSize:], n1[NoncePrefixSize:], "NextNonce(): Counter")
+}
+
+func testNonceSourceFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "norx")
+	require.NoError(err, "ioutil.TempDir()")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nonce")
+
+	const blockSize = 16
+	prefix := []byte("file prefix")
+	seen := make(map[[NonceSize]byte]bool)
+	nextNonces := func(src *FileNonceSource, n int) uint64 {
+		var nonce [NonceSize]byte
+		for i := 0; i < n; i++ {
+			require.NoError(src.NextNonce(nonce[:]), "NextNonce()")
+			require.Equal(prefix, nonce[:len(prefix)], "NextNonce(): Prefix")
+			require.False(seen[nonce], "NextNonce(): Repeated")
+			seen[nonce] = true
+		}
+		return binary.BigEndian.Uint64(nonce[NoncePrefixSize:])
+	}
+
+	// Use part of a few blocks, and close cleanly.
+	src, err := OpenFileNonceSource(path, prefix, blockSize)
+	require.NoError(err, "OpenFileNonceSource()")
+	require.Equal(uint64(blockSize*2+4), nextNonces(src, blockSize*2+5), "NextNonce(): Counter")
+	require.NoError(src.Close(), "Close()")
+	require.Equal(os.ErrClosed, src.NextNonce(make([]byte, NonceSize)), "NextNonce(): Closed")
+
+	// The unused portion of the reservation should be released.
+	src, err = OpenFileNonceSource(path, prefix, blockSize)
+	require.NoError(err, "OpenFileNonceSource(): Reopen")
+	require.Equal(uint64(blockSize*2+5), nextNonces(src, 1), "NextNonce(): Counter")
+
+	// Simulate a crash, by never closing the source.  The reservation
+	// should be on disk, and the remainder of the block skipped.
+	src.f.Close()
+	src, err = OpenFileNonceSource(path, prefix, blockSize)
+	require.NoError(err, "OpenFileNonceSource(): Crashed")
+	require.Equal(uint64(blockSize*3+5), nextNonces(src, 1), "NextNonce(): Counter")
+	require.NoError(src.Close(), "Close()")
+
+	// Malformed counter files should be rejected.
+	require.NoError(ioutil.WriteFile(path, []byte("bad"), 0600), "ioutil.WriteFile()")
+	_, err = OpenFileNonceSource(path, prefix, blockSize)
+	require.Equal(ErrInvalidNonceFile, err, "OpenFileNonceSource(): Malformed")
+
+	_, err = OpenFileNonceSource(path, prefix, 0)
+	require.Error(err, "OpenFileNonceSource(): Zero block size")
+}
+
+func testSealWithNonceSource(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	aead := newTestAEAD(k[:], 4)
+
+	src, err := NewCounterNonceSource(nil, 0)
+	require.NoError(err, "NewCounterNonceSource()")
+
+	msg, header, footer := []byte("message"), []byte("header"), []byte("footer")
+	dst := []byte("dst")
+	ct, err := aead.SealWithNonceSource(dst, src, msg, header, footer)
+	require.NoError(err, "SealWithNonceSource()")
+	require.Len(ct, len(dst)+NonceSize+len(msg)+TagSize, "SealWithNonceSource(): Length")
+	require.Equal(dst, ct[:len(dst)], "SealWithNonceSource(): dst")
+
+	ct = ct[len(dst):]
+	var nonce [NonceSize]byte
+	putNonceCounter(&nonce, 0)
+	require.Equal(nonce[:], ct[:NonceSize], "SealWithNonceSource(): Nonce")
+	require.Equal(aead.Seal(nil, nonce[:], msg, header, footer), ct[NonceSize:], "SealWithNonceSource(): Ciphertext")
+
+	pt, err := aead.OpenPrefixed(nil, ct, header, footer)
+	require.NoError(err, "OpenPrefixed()")
+	require.Equal(msg, pt, "OpenPrefixed()")
+
+	ct2, err := aead.SealWithNonceSource(nil, src, msg, header, footer)
+	require.NoError(err, "SealWithNonceSource(): Second")
+	require.NotEqual(ct, ct2, "SealWithNonceSource(): Nonce reuse")
+
+	ct[NonceSize-1] ^= 0x01
+	_, err = aead.OpenPrefixed(nil, ct, header, footer)
+	require.Equal(ErrOpen, err, "OpenPrefixed(): Corrupted nonce")
+
+	_, err = aead.OpenPrefixed(nil, ct[:NonceSize-1], header, footer)
+	require.Equal(ErrOpen, err, "OpenPrefixed(): Truncated")
+
+	exhausted, err := NewCounterNonceSource(nil, math.MaxUint64)
+	require.NoError(err, "NewCounterNonceSource()")
+	_, err = aead.SealWithNonceSource(nil, exhausted, msg, nil, nil)
+	require.NoError(err, "SealWithNonceSource(): Last nonce")
+	ret, err := aead.SealWithNonceSource(dst, exhausted, msg, nil, nil)
+	require.Equal(ErrNonceExhausted, err, "SealWithNonceSource(): Exhausted")
+	require.Equal(dst, ret, "SealWithNonceSource(): Exhausted dst")
+}
@@ -0,0 +1,231 @@
+// nonceguard.go - Nonce reuse detection
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultNonceGuardCapacity is the default number of nonces tracked by
+	// a nonce guard.
+	DefaultNonceGuardCapacity = 1 << 16
+
+	// DefaultNonceGuardFalsePositiveRate is the default target false
+	// positive rate of a Bloom filter based nonce guard.
+	DefaultNonceGuardFalsePositiveRate = 1e-6
+
+	nonceFingerprintSize = 16
+)
+
+// ErrNonceReuse is the error thrown via a panic when a nonce guard detects
+// nonce reuse, and no handler is configured.
+var ErrNonceReuse = errors.New("norx: nonce reuse detected")
+
+// nonceGuardDefault is set when built with the `norx_nonceguard` tag, and
+// enables a nonce guard with the default configuration on all new AEAD
+// instances.
+var nonceGuardDefault = false
+
+// NonceGuardConfig is the configuration for a nonce guard.
+type NonceGuardConfig struct {
+	// Capacity is the number of nonces tracked, with 0 meaning
+	// DefaultNonceGuardCapacity.  An exact guard forgets the oldest nonces
+	// once full, while the false positive rate of a Bloom filter based
+	// guard increases past the capacity.
+	Capacity int
+
+	// UseBloomFilter selects a Bloom filter, which has a fixed memory
+	// footprint, but may report false positives, instead of an exact set.
+	UseBloomFilter bool
+
+	// FalsePositiveRate is the target false positive rate of a Bloom filter
+	// based guard, with 0 meaning DefaultNonceGuardFalsePositiveRate.
+	FalsePositiveRate float64
+
+	// OnReuse, if set, is called with the nonce when reuse is detected.  If
+	// nil, Seal will panic with ErrNonceReuse.  The encryption will be done
+	// regardless, if OnReuse returns.
+	//
+	// OnReuse is called synchronously from the goroutine sealing with the
+	// reused nonce, after the nonce is recorded, and without the guard's
+	// lock held, so it may be called concurrently.  The AEAD instance's read lock is held, so it must not call
+	// EnableNonceGuard, DisableNonceGuard, or Reset on the same instance.
+	OnReuse func(nonce []byte)
+}
+
+// EnableNonceGuard enables nonce reuse detection for the AEAD instance,
+// replacing any existing guard, with the provided configuration, or the
+// default one if cfg is nil.  All nonces passed to Seal and SealBatch will
+// be recorded and checked against the nonces used previously.
+//
+// This is intended to catch bugs during development and testing, and
+// should not be relied on for security, as detection is limited to the
+// capacity of the guard, and to the instance.  Nonce guards can be enabled
+// on all instances by building with the `norx_nonceguard` tag.
+func (ae *AEAD) EnableNonceGuard(cfg *NonceGuardConfig) {
+	if cfg == nil {
+		cfg = &NonceGuardConfig{}
+	}
+	g := newNonceGuard(cfg)
+
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	ae.nonceGuard = g
+}
+
+// DisableNonceGuard disables nonce reuse detection for the AEAD instance.
+func (ae *AEAD) DisableNonceGuard() {
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	ae.nonceGuard = nil
+}
+
+type nonceSet interface {
+	testAndAdd(fp *[nonceFingerprintSize]byte) bool
+	reset()
+}
+
+type nonceGuard struct {
+	lock    sync.Mutex
+	set     nonceSet
+	onReuse func([]byte)
+}
+
+func (g *nonceGuard) check(nonce []byte) {
+	var fp [nonceFingerprintSize]byte
+	h := sha256.Sum256(nonce)
+	copy(fp[:], h[:])
+
+	g.lock.Lock()
+	reused := g.set.testAndAdd(&fp)
+	g.lock.Unlock()
+
+	if !reused {
+		return
+	}
+	if g.onReuse == nil {
+		panic(ErrNonceReuse)
+	}
+	g.onReuse(nonce)
+}
+
+func (g *nonceGuard) reset() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.set.reset()
+}
+
+func newNonceGuard(cfg *NonceGuardConfig) *nonceGuard {
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = DefaultNonceGuardCapacity
+	}
+
+	g := &nonceGuard{onReuse: cfg.OnReuse}
+	if cfg.UseBloomFilter {
+		p := cfg.FalsePositiveRate
+		if p <= 0 || p >= 1 {
+			p = DefaultNonceGuardFalsePositiveRate
+		}
+		g.set = newBloomNonceSet(capacity, p)
+	} else {
+		g.set = &exactNonceSet{
+			set:      make(map[[nonceFingerprintSize]byte]bool),
+			capacity: capacity,
+		}
+	}
+
+	return g
+}
+
+// exactNonceSet is a bounded set of fingerprints, that forgets the oldest
+// entry when full.
+type exactNonceSet struct {
+	set      map[[nonceFingerprintSize]byte]bool
+	ring     [][nonceFingerprintSize]byte
+	next     int
+	capacity int
+}
+
+func (s *exactNonceSet) testAndAdd(fp *[nonceFingerprintSize]byte) bool {
+	if s.set[*fp] {
+		return true
+	}
+
+	if len(s.ring) < s.capacity {
+		s.ring = append(s.ring, *fp)
+	} else {
+		delete(s.set, s.ring[s.next])
+		s.ring[s.next] = *fp
+		s.next = (s.next + 1) % s.capacity
+	}
+	s.set[*fp] = true
+
+	return false
+}
+
+func (s *exactNonceSet) reset() {
+	for fp := range s.set {
+		delete(s.set, fp)
+	}
+	s.ring, s.next = s.ring[:0], 0
+}
+
+// bloomNonceSet is a Bloom filter of fingerprints, using double hashing
+// to derive the bit indexes.
+type bloomNonceSet struct {
+	bits []uint64
+	m    uint64
+	k    int
+}
+
+func (s *bloomNonceSet) testAndAdd(fp *[nonceFingerprintSize]byte) bool {
+	h0 := binary.LittleEndian.Uint64(fp[0:])
+	h1 := binary.LittleEndian.Uint64(fp[8:]) | 1
+
+	present := true
+	for i := 0; i < s.k; i++ {
+		idx := (h0 + uint64(i)*h1) % s.m
+		word, bit := idx/64, uint64(1)<<(idx%64)
+		if s.bits[word]&bit == 0 {
+			present = false
+			s.bits[word] |= bit
+		}
+	}
+
+	return present
+}
+
+func (s *bloomNonceSet) reset() {
+	for i := range s.bits {
+		s.bits[i] = 0
+	}
+}
+
+func newBloomNonceSet(n int, p float64) *bloomNonceSet {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	nWords := (uint64(m) + 63) / 64
+	return &bloomNonceSet{
+		bits: make([]uint64, nWords),
+		m:    nWords * 64,
+		k:    k,
+	}
+}
@@ -0,0 +1,14 @@
+// nonceguard_enabled.go - Nonce reuse detection (enabled by default)
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build norx_nonceguard
+
+package norx
+
+func init() {
+	nonceGuardDefault = true
+}
@@ -0,0 +1,155 @@
+// nonceguard_test.go - Nonce reuse detection tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceGuard(t *testing.T) {
+	t.Run("Exact", func(t *testing.T) { doTestNonceGuard(t, false) })
+	t.Run("BloomFilter", func(t *testing.T) { doTestNonceGuard(t, true) })
+	t.Run("Default", testNonceGuardDefault)
+	t.Run("Concurrent", testNonceGuardConcurrent)
+}
+
+func doTestNonceGuard(t *testing.T, useBloomFilter bool) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	aead := newTestAEAD(k[:], 4)
+
+	var reused [][]byte
+	var guardLocked bool
+	const capacity = 1024
+	aead.EnableNonceGuard(&NonceGuardConfig{
+		Capacity:       capacity,
+		UseBloomFilter: useBloomFilter,
+		OnReuse: func(nonce []byte) {
+			reused = append(reused, append([]byte{}, nonce...))
+			if aead.nonceGuard.lock.TryLock() {
+				aead.nonceGuard.lock.Unlock()
+			} else {
+				guardLocked = true
+			}
+		},
+	})
+
+	nonce := func(i int) []byte {
+		var n [NonceSize]byte
+		binary.BigEndian.PutUint64(n[NonceSize-8:], uint64(i))
+		return n[:]
+	}
+
+	for i := 0; i < capacity; i++ {
+		aead.Seal(nil, nonce(i), nil, nil, nil)
+	}
+	require.Empty(reused, "Seal(): False positive")
+
+	// Opening must not record nonces, as it is legitimate to decrypt the
+	// same message multiple times.
+	ct := aead.Seal(nil, nonce(capacity), []byte("message"), nil, nil)
+	for i := 0; i < 2; i++ {
+		_, err = aead.Open(nil, nonce(capacity), ct, nil, nil)
+		require.NoError(err, "Open()")
+	}
+	require.Empty(reused, "Open(): Reported reuse")
+	if !useBloomFilter {
+		// The exact set is full, so the first nonce has been forgotten.
+		aead.Seal(nil, nonce(0), nil, nil, nil)
+		require.Empty(reused, "Seal(): Evicted nonce")
+	}
+
+	aead.Seal(nil, nonce(capacity/2), nil, nil, nil)
+	require.Equal([][]byte{nonce(capacity / 2)}, reused, "Seal(): Reuse")
+
+	ops := []BatchOp{
+		{Nonce: nonce(capacity + 1)},
+		{Nonce: nonce(capacity + 1)},
+	}
+	aead.SealBatch(ops)
+	require.Len(reused, 2, "SealBatch(): Reuse")
+	require.Equal(nonce(capacity+1), reused[1], "SealBatch(): Reuse")
+	require.False(guardLocked, "OnReuse(): Guard locked")
+
+	// Without a handler, reuse panics.
+	aead.EnableNonceGuard(&NonceGuardConfig{UseBloomFilter: useBloomFilter})
+	aead.Seal(nil, nonce(0), nil, nil, nil)
+	require.PanicsWithValue(ErrNonceReuse, func() { aead.Seal(nil, nonce(0), nil, nil, nil) }, "Seal(): Reuse")
+	require.PanicsWithValue(ErrNonceReuse, func() { aead.ToRuntime().Seal(nil, nonce(0), nil, nil) }, "ToRuntime().Seal(): Reuse")
+
+	aead.DisableNonceGuard()
+	require.NotPanics(func() { aead.Seal(nil, nonce(0), nil, nil, nil) }, "Seal(): Disabled")
+}
+
+func testNonceGuardDefault(t *testing.T) {
+	require := require.New(t)
+
+	oldDefault := nonceGuardDefault
+	defer func() { nonceGuardDefault = oldDefault }()
+
+	var k [KeySize]byte
+	nonceGuardDefault = false
+	require.Nil(New6441(k[:]).nonceGuard, "New6441(): Default disabled")
+	nonceGuardDefault = true
+	require.NotNil(New6441(k[:]).nonceGuard, "New6441(): Default enabled")
+}
+
+func testNonceGuardConcurrent(t *testing.T) {
+	var k [KeySize]byte
+	aead := newTestAEAD(k[:], 4)
+
+	// Toggling the guard while sealing must not race (go test -race).
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			aead.EnableNonceGuard(nil)
+			aead.DisableNonceGuard()
+		}
+	}()
+	var nonce [NonceSize]byte
+	for i := 0; i < 100; i++ {
+		binary.BigEndian.PutUint64(nonce[:], uint64(i))
+		aead.Seal(nil, nonce[:], nil, nil, nil)
+	}
+	<-done
+}
+
+func TestBloomNonceSet(t *testing.T) {
+	require := require.New(t)
+
+	const n, p = 10000, 0.01
+	s := newBloomNonceSet(n, p)
+
+	var fp [nonceFingerprintSize]byte
+	for i := 0; i < n; i++ {
+		_, err := rand.Read(fp[:])
+		require.NoError(err, "rand.Read(fp)")
+		s.testAndAdd(&fp)
+	}
+
+	// Probing also adds to the filter, so only use a fraction of n probes
+	// to keep the load close to the capacity.
+	const probes = n / 10
+	falsePositives := 0
+	for i := 0; i < probes; i++ {
+		_, err := rand.Read(fp[:])
+		require.NoError(err, "rand.Read(fp)")
+		if s.testAndAdd(&fp) {
+			falsePositives++
+		}
+	}
+	require.True(falsePositives < probes*p*3, "False positive rate: %d/%d", falsePositives, probes)
+}
@@ -23,30 +23,30 @@ const (
 	Version = "3.0"
 )
 
-func aeadEncrypt(l int, c, a, m, z, nonce, key []byte) []byte {
-	var k [bytesK]byte
-	s := &state{rounds: l}
+func aeadEncrypt(p *permutation, c, a, m, z, nonce, key []byte) []byte {
+	var s state
 	mLen := len(m)
 
 	ret, out := sliceForAppend(c, mLen+bytesT)
+	if sealSmall(p, out, a, m, z, nonce, key) {
+		return ret
+	}
 
-	copy(k[:], key)
-	hardwareAccelImpl.initFn(s, k[:], nonce)
-	hardwareAccelImpl.absorbDataFn(s, a, tagHeader)
-	hardwareAccelImpl.encryptDataFn(s, out, m)
-	hardwareAccelImpl.absorbDataFn(s, z, tagTrailer)
-	hardwareAccelImpl.finalizeFn(s, out[mLen:], k[:])
+	s.perm = p
+	s.init(key, nonce)
+	s.absorbData(a, tagHeader)
+	s.encryptData(out, m)
+	s.absorbData(z, tagTrailer)
+	s.finalize(out[mLen:], key)
 
 	burnUint64s(s.s[:])
-	burnBytes(k[:])
 
 	return ret
 }
 
-func aeadDecrypt(l int, m, a, c, z, nonce, key []byte) ([]byte, bool) {
-	var k [bytesK]byte
+func aeadDecrypt(p *permutation, m, a, c, z, nonce, key []byte) ([]byte, bool) {
+	var s state
 	var tag [bytesT]byte
-	s := &state{rounds: l}
 	cLen := len(c)
 
 	if cLen < bytesT {
@@ -56,12 +56,14 @@ func aeadDecrypt(l int, m, a, c, z, nonce, key []byte) ([]byte, bool) {
 	mLen := cLen - bytesT
 	ret, out := sliceForAppend(m, mLen)
 
-	copy(k[:], key)
-	hardwareAccelImpl.initFn(s, k[:], nonce)
-	hardwareAccelImpl.absorbDataFn(s, a, tagHeader)
-	hardwareAccelImpl.decryptDataFn(s, out, c[:mLen])
-	hardwareAccelImpl.absorbDataFn(s, z, tagTrailer)
-	hardwareAccelImpl.finalizeFn(s, tag[:], k[:])
+	if !openSmall(p, out, a, c[:mLen], z, nonce, key, tag[:]) {
+		s.perm = p
+		s.init(key, nonce)
+		s.absorbData(a, tagHeader)
+		s.decryptData(out, c[:mLen])
+		s.absorbData(z, tagTrailer)
+		s.finalize(tag[:], key)
+	}
 
 	srcTag := c[mLen:]
 	ok := subtle.ConstantTimeCompare(srcTag, tag[:]) == 1
@@ -71,7 +73,6 @@ func aeadDecrypt(l int, m, a, c, z, nonce, key []byte) ([]byte, bool) {
 	}
 
 	burnUint64s(s.s[:])
-	burnBytes(k[:])
 
 	return ret, ok
 }
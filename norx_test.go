@@ -35,6 +35,17 @@ func mustInitHardwareAcceleration() {
 	}
 }
 
+// forEachAcceleratedImpl calls fn once for every hardware accelerated
+// implementation supported by the host, and restores the default
+// implementation on return.
+func forEachAcceleratedImpl(fn func()) {
+	defer mustInitHardwareAcceleration()
+	for _, impl := range supportedHardwareAccelImpls() {
+		setHardwareAccelImpl(impl)
+		fn()
+	}
+}
+
 func TestKAT(t *testing.T) {
 	forceDisableHardwareAcceleration()
 	doTestKAT(t)
@@ -43,8 +54,7 @@ func TestKAT(t *testing.T) {
 		t.Log("Hardware acceleration not supported on this host.")
 		return
 	}
-	mustInitHardwareAcceleration()
-	doTestKAT(t)
+	forEachAcceleratedImpl(func() { doTestKAT(t) })
 }
 
 func doTestKAT(t *testing.T) {
@@ -137,15 +147,148 @@ func doTestKATFull(t *testing.T, vn string, l int) {
 	require.Equal(kat, katAcc, "Final concatenated cipher texts.")
 }
 
+func TestImplsAgree(t *testing.T) {
+	if !canAccelerate {
+		t.Skip("Hardware acceleration not supported on this host.")
+	}
+
+	// Exercise every combination of header, payload, and trailer length
+	// around the block boundaries, to ensure that the accelerated
+	// implementation (including any fused paths) matches the reference.
+	testSizes := []int{0, 1, 95, 96, 97, 191, 192, 200}
+	testRounds := []int{4, 6}
+
+	forEachAcceleratedImpl(func() {
+		impl := hardwareAccelImpl
+		for _, l := range testRounds {
+			n := fmt.Sprintf("NORX64-%d-1_%s", l, impl.name)
+			t.Run(n, func(t *testing.T) { doTestImplsAgree(t, impl, l, testSizes) })
+		}
+	})
+}
+
+func doTestImplsAgree(t *testing.T, impl *hwaccelImpl, l int, testSizes []int) {
+	require := require.New(t)
+	defer setHardwareAccelImpl(impl)
+
+	var k, n [32]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	_, err = rand.Read(n[:])
+	require.NoError(err, "rand.Read(n)")
+
+	aead := newTestAEAD(k[:], l)
+	for _, aLen := range testSizes {
+		for _, mLen := range testSizes {
+			for _, zLen := range testSizes {
+				a, m, z := make([]byte, aLen), make([]byte, mLen), make([]byte, zLen)
+				rand.Read(a)
+				rand.Read(m)
+				rand.Read(z)
+
+				forceDisableHardwareAcceleration()
+				ctRef := aead.Seal(nil, n[:], m, a, z)
+
+				setHardwareAccelImpl(impl)
+				ct := aead.Seal(nil, n[:], m, a, z)
+				require.Equal(ctRef, ct, "Seal(): %d/%d/%d", aLen, mLen, zLen)
+
+				pt, err := aead.Open(nil, n[:], ct, a, z)
+				require.NoError(err, "Open(): %d/%d/%d", aLen, mLen, zLen)
+				require.Len(pt, mLen, "Open(): %d/%d/%d", aLen, mLen, zLen)
+				if mLen != 0 {
+					require.Equal(m, pt, "Open(): %d/%d/%d", aLen, mLen, zLen)
+				}
+
+				ct[0] ^= 0x01
+				pt, err = aead.Open(nil, n[:], ct, a, z)
+				require.Equal(ErrOpen, err, "Open(corrupted): %d/%d/%d", aLen, mLen, zLen)
+				require.Nil(pt, "Open(corrupted): %d/%d/%d", aLen, mLen, zLen)
+			}
+		}
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	forceDisableHardwareAcceleration()
+	doTestAllocs(t)
+
+	if !canAccelerate {
+		t.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	forEachAcceleratedImpl(func() { doTestAllocs(t) })
+}
+
+func doTestAllocs(t *testing.T) {
+	testRounds := []int{4, 6}
+	testSizes := []int{0, 8, 64, 96, 576, 1536}
+	impl := "_" + hardwareAccelImpl.name
+
+	for _, l := range testRounds {
+		n := fmt.Sprintf("NORX64-%d-1", l)
+		for _, sz := range testSizes {
+			sn := fmt.Sprintf("_%d", sz)
+			t.Run(n+impl+sn, func(t *testing.T) { doTestAllocsAEAD(t, l, sz) })
+		}
+	}
+}
+
+func doTestAllocsAEAD(t *testing.T, l, sz int) {
+	require := require.New(t)
+
+	var k, n [32]byte
+	var a, z [64]byte
+	m := make([]byte, sz)
+	c := make([]byte, 0, sz+TagSize)
+	d := make([]byte, 0, sz)
+
+	aead := newTestAEAD(k[:], l)
+	goAead := aead.ToRuntime()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		c = aead.Seal(c[:0], n[:], m, a[:], z[:])
+	})
+	require.Zero(allocs, "Seal(): allocs")
+
+	allocs = testing.AllocsPerRun(100, func() {
+		var err error
+		if d, err = aead.Open(d[:0], n[:], c, a[:], z[:]); err != nil {
+			panic(err)
+		}
+	})
+	require.Zero(allocs, "Open(): allocs")
+
+	allocs = testing.AllocsPerRun(100, func() {
+		c = goAead.Seal(c[:0], n[:], m, a[:])
+	})
+	require.Zero(allocs, "ToRuntime().Seal(): allocs")
+
+	allocs = testing.AllocsPerRun(100, func() {
+		var err error
+		if d, err = goAead.Open(d[:0], n[:], c, a[:]); err != nil {
+			panic(err)
+		}
+	})
+	require.Zero(allocs, "ToRuntime().Open(): allocs")
+}
+
 func newTestAEAD(k []byte, l int) *AEAD {
+	var aead *AEAD
 	switch l {
 	case 4:
-		return New6441(k[:])
+		aead = New6441(k[:])
 	case 6:
-		return New6461(k[:])
+		aead = New6461(k[:])
 	default:
 		panic("unsupported round parameter")
 	}
+
+	// The tests reuse nonces, which would trip the guard if it is enabled
+	// by default via the build tag.
+	aead.DisableNonceGuard()
+
+	return aead
 }
 
 func BenchmarkNORX(b *testing.B) {
@@ -156,8 +299,7 @@ func BenchmarkNORX(b *testing.B) {
 		b.Log("Hardware acceleration not supported on this host.")
 		return
 	}
-	mustInitHardwareAcceleration()
-	doBenchmarkNORX(b)
+	forEachAcceleratedImpl(func() { doBenchmarkNORX(b) })
 }
 
 func doBenchmarkNORX(b *testing.B) {
@@ -190,7 +332,7 @@ func doBenchmarkAEADEncrypt(b *testing.B, l, sz int) {
 	for i := 0; i < b.N; i++ {
 		c = c[:0]
 
-		c = aeadEncrypt(l, c, nil, m, nil, nonce, key)
+		c = aeadEncrypt(permutationFor(l), c, nil, m, nil, nonce, key)
 		if len(c) != sz+TagSize {
 			b.Fatalf("aeadEncrypt failed")
 		}
@@ -207,13 +349,13 @@ func doBenchmarkAEADDecrypt(b *testing.B, l, sz int) {
 	rand.Read(key)
 	rand.Read(m)
 
-	c = aeadEncrypt(l, c, nil, m, nil, nonce, key)
+	c = aeadEncrypt(permutationFor(l), c, nil, m, nil, nonce, key)
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		d = d[:0]
 
 		var ok bool
-		d, ok = aeadDecrypt(l, d, nil, c, nil, nonce, key)
+		d, ok = aeadDecrypt(permutationFor(l), d, nil, c, nil, nonce, key)
 		if !ok {
 			b.Fatalf("aeadDecrypt failed")
 		}
@@ -0,0 +1,162 @@
+// padding.go - Length hiding padding
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// PaddingTrailerSize is the size of the pad length trailer appended to each
+// padded plaintext.
+const PaddingTrailerSize = 4
+
+// ErrInvalidPadding is the error returned when an authenticated plaintext has
+// malformed padding, or thrown via a panic when a padding policy is invalid.
+var ErrInvalidPadding = errors.New("norx: invalid padding")
+
+// PaddingPolicy is a length hiding padding policy.
+type PaddingPolicy interface {
+	// PaddedSize returns the padded size for an unpadded size of n bytes
+	// (including the trailer), which must be at least n.
+	PaddedSize(n int) int
+}
+
+// BucketPadding pads to the smallest of a fixed set of sizes, that is
+// at least as large as the message.  Messages larger than the largest size
+// are padded to a multiple of it.
+type BucketPadding []int
+
+// PaddedSize implements PaddingPolicy.
+func (p BucketPadding) PaddedSize(n int) int {
+	if len(p) == 0 {
+		return n
+	}
+
+	sizes := p
+	if !sort.IntsAreSorted(sizes) {
+		sizes = append([]int{}, p...)
+		sort.Ints(sizes)
+	}
+	for _, sz := range sizes {
+		if sz >= n {
+			return sz
+		}
+	}
+
+	largest := sizes[len(sizes)-1]
+	if largest <= 0 {
+		return n
+	}
+	return (n + largest - 1) / largest * largest
+}
+
+// PowerOfTwoPadding pads to the next power of two.  This reveals at most
+// log2(log2(n)) bits of the length, at the cost of up to 100% overhead.
+type PowerOfTwoPadding struct{}
+
+// PaddedSize implements PaddingPolicy.
+func (PowerOfTwoPadding) PaddedSize(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << uint(bits.Len(uint(n-1)))
+}
+
+// PADMEPadding is the Padmé padding scheme from "Reducing Metadata Leakage
+// from Encrypted Files and Communication with PURBs" (Nikitin et al.), which
+// reveals O(log log n) bits of the length, with at most 12% overhead.
+type PADMEPadding struct{}
+
+// PaddedSize implements PaddingPolicy.
+func (PADMEPadding) PaddedSize(n int) int {
+	if n < 2 {
+		return n
+	}
+
+	e := bits.Len(uint(n)) - 1 // floor(log2(n))
+	s := bits.Len(uint(e))     // floor(log2(e)) + 1
+	mask := (1 << uint(e-s)) - 1
+	return (n + mask) &^ mask
+}
+
+// SealPadded encrypts and authenticates plaintext as with Seal, after padding
+// it according to the policy.  The padding, including the pad length, is
+// encrypted and authenticated, so the ciphertext length only reveals the
+// padded size.
+//
+// The plaintext and dst must overlap exactly or not at all.
+func (ae *AEAD) SealPadded(dst, nonce, plaintext, header, footer []byte, policy PaddingPolicy) []byte {
+	n := len(plaintext) + PaddingTrailerSize
+	paddedLen := policy.PaddedSize(n)
+	if paddedLen < n || paddedLen-n > 0x7fffffff {
+		panic(ErrInvalidPadding)
+	}
+
+	ret, out := sliceForAppend(dst, paddedLen)
+	copy(out, plaintext)
+	pad := out[len(plaintext) : paddedLen-PaddingTrailerSize]
+	for i := range pad {
+		pad[i] = 0
+	}
+	binary.BigEndian.PutUint32(out[paddedLen-PaddingTrailerSize:], uint32(len(pad)))
+
+	return ae.Seal(ret[:len(dst)], nonce, out, header, footer)
+}
+
+// OpenPadded decrypts and authenticates ciphertext as with Open, and removes
+// the padding added by SealPadded, appending the unpadded plaintext to dst.
+// The padding is validated in constant time.
+func (ae *AEAD) OpenPadded(dst, nonce, ciphertext, header, footer []byte) ([]byte, error) {
+	ret, err := ae.Open(dst, nonce, ciphertext, header, footer)
+	if err != nil {
+		return ret, err
+	}
+
+	n, ok := unpad(ret[len(dst):])
+	if !ok {
+		if len(ret) > len(dst) {
+			burnBytes(ret[len(dst):])
+		}
+		return dst, ErrInvalidPadding
+	}
+	return ret[:len(dst)+n], nil
+}
+
+// unpad returns the unpadded length of the padded plaintext b, and true iff
+// the padding is well formed, in time that only depends on len(b).
+func unpad(b []byte) (int, bool) {
+	if len(b) < PaddingTrailerSize {
+		return 0, false
+	}
+	bodyLen := len(b) - PaddingTrailerSize
+
+	// The pad length is limited to 31 bits, so that it is representable
+	// as an int on 32 bit systems.  The message length is only meaningful
+	// if lenOk is set, but is used regardless to keep the timing uniform.
+	padLen := binary.BigEndian.Uint32(b[bodyLen:])
+	lenOk := subtle.ConstantTimeEq(int32(padLen>>31), 0) &
+		subtle.ConstantTimeLessOrEq(int(padLen&0x7fffffff), bodyLen)
+	msgLen := bodyLen - int(padLen&0x7fffffff)
+
+	// Accumulate all the bytes in the padding region, which must be zero.
+	var acc byte
+	for i := 0; i < bodyLen; i++ {
+		inPad := byte(subtle.ConstantTimeLessOrEq(msgLen, i))
+		acc |= b[i] & -inPad
+	}
+	ok := lenOk & subtle.ConstantTimeByteEq(acc, 0)
+	if ok != 1 {
+		return 0, false
+	}
+
+	return msgLen, true
+}
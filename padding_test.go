@@ -0,0 +1,109 @@
+// padding_test.go - Length hiding padding tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPadding(t *testing.T) {
+	t.Run("Policies", testPaddingPolicies)
+	t.Run("Unpad", testPaddingUnpad)
+	t.Run("Integration", testPaddingIntegration)
+}
+
+func testPaddingPolicies(t *testing.T) {
+	require := require.New(t)
+
+	buckets := BucketPadding{256, 64, 1024}
+	for _, v := range [][2]int{{1, 64}, {64, 64}, {65, 256}, {1024, 1024}, {1025, 2048}, {3000, 3072}} {
+		require.Equal(v[1], buckets.PaddedSize(v[0]), "BucketPadding(%d)", v[0])
+	}
+	require.Equal(10, BucketPadding(nil).PaddedSize(10), "BucketPadding(): Empty")
+
+	for _, v := range [][2]int{{1, 1}, {2, 2}, {3, 4}, {5, 8}, {1024, 1024}, {1025, 2048}} {
+		require.Equal(v[1], PowerOfTwoPadding{}.PaddedSize(v[0]), "PowerOfTwoPadding(%d)", v[0])
+	}
+
+	// Values from the reference implementation.
+	for _, v := range [][2]int{{1, 1}, {9, 10}, {100, 104}, {1000, 1024}, {1025, 1088}, {10000, 10240}} {
+		require.Equal(v[1], PADMEPadding{}.PaddedSize(v[0]), "PADMEPadding(%d)", v[0])
+	}
+	for n := 2; n < 1<<16; n++ {
+		p := PADMEPadding{}.PaddedSize(n)
+		require.True(p >= n && p-n <= n*12/100+1, "PADMEPadding(%d): Overhead", n)
+	}
+}
+
+func testPaddingUnpad(t *testing.T) {
+	require := require.New(t)
+
+	b := []byte{'a', 'b', 0, 0, 0, 0, 0, 2}
+	n, ok := unpad(b)
+	require.True(ok, "unpad()")
+	require.Equal(2, n, "unpad()")
+
+	b[2] = 1
+	_, ok = unpad(b)
+	require.False(ok, "unpad(): Non-zero padding")
+
+	b[2] = 0
+	binary.BigEndian.PutUint32(b[4:], 5)
+	_, ok = unpad(b)
+	require.False(ok, "unpad(): Pad length too large")
+	binary.BigEndian.PutUint32(b[4:], 0x80000002)
+	_, ok = unpad(b)
+	require.False(ok, "unpad(): Pad length top bit")
+	_, ok = unpad(b[:3])
+	require.False(ok, "unpad(): Truncated")
+}
+
+func testPaddingIntegration(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+
+	aead := newTestAEAD(k[:], 6)
+	hdr := []byte("header")
+	policies := []PaddingPolicy{BucketPadding{128, 512}, PowerOfTwoPadding{}, PADMEPadding{}}
+	for _, policy := range policies {
+		for _, sz := range []int{0, 1, 100, 124, 125, 1000} {
+			msg := make([]byte, sz)
+			_, err = rand.Read(msg)
+			require.NoError(err, "rand.Read(msg)")
+
+			ct := aead.SealPadded(nil, nonce[:], msg, hdr, nil, policy)
+			require.Len(ct, policy.PaddedSize(sz+PaddingTrailerSize)+TagSize, "SealPadded(%T, %d): Length", policy, sz)
+
+			pt, err := aead.OpenPadded([]byte("prefix"), nonce[:], ct, hdr, nil)
+			require.NoError(err, "OpenPadded(%T, %d)", policy, sz)
+			require.Equal(append([]byte("prefix"), msg...), pt, "OpenPadded(%T, %d)", policy, sz)
+
+			_, err = aead.OpenPadded(nil, nonce[:], ct, nil, nil)
+			require.Equal(ErrOpen, err, "OpenPadded(%T, %d): Header", policy, sz)
+		}
+	}
+
+	// Equal length messages (within a bucket) produce equal length
+	// ciphertexts.
+	p := BucketPadding{128}
+	require.Len(aead.SealPadded(nil, nonce[:], make([]byte, 1), nil, nil, p), 128+TagSize, "SealPadded(): Bucket")
+	require.Len(aead.SealPadded(nil, nonce[:], make([]byte, 120), nil, nil, p), 128+TagSize, "SealPadded(): Bucket")
+
+	// Authenticated, but malformed padding is rejected.
+	ct := aead.Seal(nil, nonce[:], []byte{1, 2, 3, 0, 0, 0, 9}, nil, nil)
+	_, err = aead.OpenPadded(nil, nonce[:], ct, nil, nil)
+	require.Equal(ErrInvalidPadding, err, "OpenPadded(): Malformed")
+}
@@ -31,6 +31,10 @@ const (
 	// tagBranch  = 0x10
 	// tagMerge   = 0x20
 
+	// Non-standard tags
+	tagCheckpoint = 0x40 // Intermediate tags (stream.go)
+	tagDerive     = 0x80 // Key derivation (kdf.go)
+
 	bytesW = paramW / 8
 	bytesT = paramT / 8
 	bytesK = paramK / 8
@@ -39,11 +43,19 @@ const (
 	wordsR = paramR / paramW
 )
 
-type state struct {
-	s      [16]uint64
+// permutation is a NORX permutation with a fixed round count.  One is
+// selected when an AEAD is constructed, and the backends dispatch on it to
+// code generated for the round count (see internal/permgen), so that the
+// permutation itself never branches on the round count.
+type permutation struct {
 	rounds int // Round number (NORX_L)
 }
 
+type state struct {
+	s    [16]uint64
+	perm *permutation
+}
+
 // Taken from "Table 3.4: Initialisation constants".
 var initializationConstants = [16]uint64{
 	0xE4D324772B91DF79,
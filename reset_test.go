@@ -0,0 +1,107 @@
+// reset_test.go - Use-after-Reset tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReset(t *testing.T) {
+	t.Run("UseAfterReset", testResetUseAfterReset)
+	t.Run("Concurrent", testResetConcurrent)
+}
+
+func testResetUseAfterReset(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+
+	aead := newTestAEAD(k[:], 6)
+	ct := aead.Seal(nil, nonce[:], []byte("msg"), nil, nil)
+	aead.Reset()
+	require.Equal(make([]byte, KeySize), aead.key, "Reset(): Key")
+	require.NotPanics(func() { aead.Reset() }, "Reset(): Twice")
+
+	require.PanicsWithValue(ErrReset, func() { aead.Seal(nil, nonce[:], nil, nil, nil) }, "Seal()")
+	_, err = aead.Open(nil, nonce[:], ct, nil, nil)
+	require.Equal(ErrReset, err, "Open()")
+
+	ops := []BatchOp{{Nonce: nonce[:], Input: ct}}
+	require.PanicsWithValue(ErrReset, func() { aead.SealBatch(ops) }, "SealBatch()")
+	aead.OpenBatch(ops)
+	require.Equal(ErrReset, ops[0].Err, "OpenBatch()")
+
+	_, err = aead.SealWithNonceSource(nil, NewRandomNonceSource(nil), nil, nil, nil)
+	require.Equal(ErrReset, err, "SealWithNonceSource()")
+	require.Equal(ErrReset, aead.LockMemory(), "LockMemory()")
+
+	// A rekey racing Reset must not resurrect a key.
+	aead.setKey(k[:])
+	require.Equal(make([]byte, KeySize), aead.key, "setKey(): Reset")
+
+	l := NewLimitedAEAD(newTestAEAD(k[:], 6), UsageLimits{})
+	l.Reset()
+	_, err = l.Seal(nil, nonce[:], nil, nil, nil)
+	require.Equal(ErrReset, err, "LimitedAEAD.Seal()")
+	_, err = l.Open(nil, nonce[:], ct, nil, nil)
+	require.Equal(ErrReset, err, "LimitedAEAD.Open()")
+}
+
+func testResetConcurrent(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+
+	aead := newTestAEAD(k[:], 6)
+	msg := make([]byte, 4096)
+	ct := aead.Seal(nil, nonce[:], msg, nil, nil)
+
+	// Concurrent readers must either succeed with the real key, or fail
+	// with ErrReset, and never observe a partially burned key.
+	var wg sync.WaitGroup
+	errCh := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				pt, err := aead.Open(nil, nonce[:], ct, nil, nil)
+				if err == ErrReset {
+					return
+				}
+				if err == nil && !bytes.Equal(msg, pt) {
+					err = errors.New("plaintext mismatch")
+				}
+				if err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+	aead.Reset()
+	aead.Reset()
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(err, "Open(): Concurrent with Reset")
+	}
+}
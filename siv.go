@@ -0,0 +1,170 @@
+// siv.go - Deterministic, nonce misuse resistant mode (NORX-SIV)
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import "crypto/subtle"
+
+// SIVOverhead is the difference between the lengths of a plaintext and its
+// NORX-SIV ciphertext.
+const SIVOverhead = TagSize
+
+const (
+	// sivMACLabel and sivEncLabel are the deriveKey labels used to derive
+	// the NORX-SIV subkeys from the key.
+	sivMACLabel = "norx: SIV MAC key"
+	sivEncLabel = "norx: SIV encryption key"
+)
+
+// SealSIV encrypts and authenticates plaintext deterministically with
+// NORX-SIV, authenticates the optional nonce, header and footer, and
+// appends the result to dst, returning the updated slice.
+//
+// The synthetic IV is computed by a NORX keyed MAC over the nonce, header,
+// plaintext and footer, and is then used as the nonce to encrypt the
+// plaintext, and prepended to the ciphertext.  Unlike Seal, repeating a
+// nonce only reveals if the same message (including the additional data)
+// was sealed more than once.  The nonce may be nil (for fully deterministic
+// encryption, equivalent to an all zero nonce) or NonceSize() bytes long.
+// Subkeys are derived from the key in a domain that Seal can not reach, so
+// it is safe to use the same key with both Seal and SealSIV.
+//
+// The plaintext and dst must not overlap.
+func (ae *AEAD) SealSIV(dst, nonce, plaintext, header, footer []byte) []byte {
+	if len(nonce) != 0 && len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		panic(ErrReset)
+	}
+
+	var macKey, encKey [KeySize]byte
+	ae.deriveSIVKeys(&macKey, &encKey)
+
+	ret, out := sliceForAppend(dst, SIVOverhead+len(plaintext))
+	siv, ct := out[:TagSize], out[TagSize:]
+	sivMAC(ae.perm, siv, macKey[:], nonce, header, plaintext, footer)
+	sivCrypt(ae.perm, ct, plaintext, encKey[:], siv, false)
+
+	burnBytes(macKey[:])
+	burnBytes(encKey[:])
+
+	return ret
+}
+
+// OpenSIV decrypts and authenticates ciphertext produced by SealSIV,
+// authenticates the optional nonce, header and footer, and if successful,
+// appends the resulting plaintext to dst, returning the updated slice.
+//
+// The ciphertext and dst must not overlap.  OpenSIV returns ErrReset if the
+// instance has been Reset.
+func (ae *AEAD) OpenSIV(dst, nonce, ciphertext, header, footer []byte) ([]byte, error) {
+	if len(nonce) != 0 && len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return dst, ErrReset
+	}
+	if len(ciphertext) < SIVOverhead {
+		return dst, ErrOpen
+	}
+
+	var macKey, encKey [KeySize]byte
+	ae.deriveSIVKeys(&macKey, &encKey)
+	defer burnBytes(macKey[:])
+	defer burnBytes(encKey[:])
+
+	siv, ct := ciphertext[:TagSize], ciphertext[TagSize:]
+	ret, out := sliceForAppend(dst, len(ct))
+	sivCrypt(ae.perm, out, ct, encKey[:], siv, true)
+
+	var tag [TagSize]byte
+	sivMAC(ae.perm, tag[:], macKey[:], nonce, header, out, footer)
+	if subtle.ConstantTimeCompare(siv, tag[:]) != 1 {
+		if len(out) > 0 { // burn decrypted plaintext on auth failure
+			burnBytes(out)
+		}
+		return dst, ErrOpen
+	}
+
+	return ret, nil
+}
+
+// WrapKey wraps a KeySize byte key with NORX-SIV, authenticating the
+// optional header.
+func (ae *AEAD) WrapKey(key, header []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKeySize
+	}
+	if ae.isReset() {
+		return nil, ErrReset
+	}
+
+	return ae.SealSIV(nil, nil, key, header, nil), nil
+}
+
+// UnwrapKey unwraps a key wrapped by WrapKey, authenticating the optional
+// header.
+func (ae *AEAD) UnwrapKey(wrapped, header []byte) ([]byte, error) {
+	if len(wrapped) != KeySize+SIVOverhead {
+		return nil, ErrOpen
+	}
+
+	return ae.OpenSIV(nil, nil, wrapped, header, nil)
+}
+
+// deriveSIVKeys derives the NORX-SIV MAC and encryption subkeys from the
+// key.  The caller must hold the read lock.
+func (ae *AEAD) deriveSIVKeys(macKey, encKey *[KeySize]byte) {
+	deriveKey(ae.perm, macKey[:], ae.key, sivMACLabel, nil)
+	deriveKey(ae.perm, encKey[:], ae.key, sivEncLabel, nil)
+}
+
+// sivMAC computes the synthetic IV, by absorbing the header, plaintext and
+// footer, with the appropriate domain separation tags, into a NORX state
+// initialized with the MAC key and nonce, and finalizing.
+func sivMAC(p *permutation, out, key, nonce, a, m, z []byte) {
+	var s state
+	var zeroNonce [NonceSize]byte
+
+	if len(nonce) == 0 {
+		nonce = zeroNonce[:]
+	}
+
+	s.perm = p
+	s.init(key, nonce)
+	s.absorbData(a, tagHeader)
+	s.absorbData(m, tagPayload)
+	s.absorbData(z, tagTrailer)
+	s.finalize(out, key)
+
+	burnUint64s(s.s[:])
+}
+
+// sivCrypt encrypts or decrypts in to out, using a NORX state initialized
+// with the encryption key and the synthetic IV as the nonce.
+func sivCrypt(p *permutation, out, in, key, siv []byte, decrypt bool) {
+	var s state
+
+	s.perm = p
+	s.init(key, siv)
+	if decrypt {
+		s.decryptData(out, in)
+	} else {
+		s.encryptData(out, in)
+	}
+
+	burnUint64s(s.s[:])
+}
@@ -0,0 +1,111 @@
+// siv_test.go - NORX-SIV tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSIV(t *testing.T) {
+	var k [KeySize]byte
+	_, err := rand.Read(k[:])
+	require.New(t).NoError(err, "rand.Read(k)")
+
+	forceDisableHardwareAcceleration()
+	expected := doTestSIV(t, k[:], nil)
+
+	if !canAccelerate {
+		t.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	forEachAcceleratedImpl(func() { doTestSIV(t, k[:], expected) })
+}
+
+func doTestSIV(t *testing.T, k []byte, expected [][]byte) [][]byte {
+	var cts [][]byte
+	impl := "_" + hardwareAccelImpl.name
+
+	for _, l := range []int{4, 6} {
+		n := fmt.Sprintf("NORX64-%d-1", l)
+		t.Run(n+impl, func(t *testing.T) {
+			cts = append(cts, doTestSIVAEAD(t, newTestAEAD(k, l), len(cts), expected)...)
+		})
+	}
+
+	return cts
+}
+
+func doTestSIVAEAD(t *testing.T, aead *AEAD, off int, expected [][]byte) [][]byte {
+	require := require.New(t)
+
+	var nonce [NonceSize]byte
+	_, err := rand.Read(nonce[:])
+	require.NoError(err, "rand.Read(nonce)")
+	hdr, ftr := []byte("header"), []byte("footer")
+
+	var cts [][]byte
+	for i, sz := range []int{0, 1, 95, 96, 97, 1024} {
+		msg := make([]byte, sz)
+		for j := range msg {
+			msg[j] = byte(j)
+		}
+
+		ct := aead.SealSIV(nil, nil, msg, hdr, ftr)
+		require.Len(ct, sz+SIVOverhead, "SealSIV(%d): Length", sz)
+		require.Equal(ct, aead.SealSIV(nil, nil, msg, hdr, ftr), "SealSIV(%d): Deterministic", sz)
+		if expected != nil {
+			require.Equal(expected[off+i], ct, "SealSIV(%d): Impls agree", sz)
+		}
+		cts = append(cts, ct)
+
+		pt, err := aead.OpenSIV(nil, nil, ct, hdr, ftr)
+		require.NoError(err, "OpenSIV(%d)", sz)
+		require.Equal(msg, append([]byte{}, pt...), "OpenSIV(%d)", sz)
+
+		// The nonce, and all of the other inputs are authenticated.
+		ctN := aead.SealSIV(nil, nonce[:], msg, hdr, ftr)
+		require.NotEqual(ct, ctN, "SealSIV(%d): Nonce", sz)
+		_, err = aead.OpenSIV(nil, nil, ctN, hdr, ftr)
+		require.Equal(ErrOpen, err, "OpenSIV(%d): Missing nonce", sz)
+		_, err = aead.OpenSIV(nil, nonce[:], ctN, hdr, ftr)
+		require.NoError(err, "OpenSIV(%d): Nonce", sz)
+
+		_, err = aead.OpenSIV(nil, nil, ct, ftr, hdr)
+		require.Equal(ErrOpen, err, "OpenSIV(%d): Swapped header/footer", sz)
+		for _, pos := range []int{0, len(ct) - 1} {
+			bad := append([]byte{}, ct...)
+			bad[pos] ^= 0x01
+			_, err = aead.OpenSIV(nil, nil, bad, hdr, ftr)
+			require.Equal(ErrOpen, err, "OpenSIV(%d): Corrupted byte %d", sz, pos)
+		}
+	}
+
+	_, err = aead.OpenSIV(nil, nil, make([]byte, SIVOverhead-1), nil, nil)
+	require.Equal(ErrOpen, err, "OpenSIV(): Truncated")
+
+	// Key wrapping.
+	var wrappedKey [KeySize]byte
+	_, err = rand.Read(wrappedKey[:])
+	require.NoError(err, "rand.Read(wrappedKey)")
+	wrapped, err := aead.WrapKey(wrappedKey[:], hdr)
+	require.NoError(err, "WrapKey()")
+	require.Len(wrapped, KeySize+SIVOverhead, "WrapKey(): Length")
+	unwrapped, err := aead.UnwrapKey(wrapped, hdr)
+	require.NoError(err, "UnwrapKey()")
+	require.Equal(wrappedKey[:], unwrapped, "UnwrapKey()")
+	_, err = aead.UnwrapKey(wrapped, nil)
+	require.Equal(ErrOpen, err, "UnwrapKey(): Header")
+	_, err = aead.WrapKey(wrappedKey[1:], nil)
+	require.Equal(ErrInvalidKeySize, err, "WrapKey(): Short key")
+
+	return cts
+}
@@ -0,0 +1,182 @@
+// snapshot.go - Stream snapshot and resume
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	snapshotVersion = 1
+
+	snapshotKindEncryptor = 1
+	snapshotKindDecryptor = 2
+
+	snapshotLabel = "norx: stream snapshot"
+
+	// version, kind, rounds, interval, total, state, buffer length.
+	snapshotHeaderSize = 1 + 1 + 1 + 4 + 8 + 16*8 + 4
+)
+
+// ErrInvalidSnapshot is the error returned when a snapshot fails to
+// authenticate, is malformed, or does not match the configuration.
+var ErrInvalidSnapshot = errors.New("norx: invalid snapshot")
+
+// Snapshot returns an encrypted and authenticated snapshot of the
+// encryptor's state, including any buffered plaintext, that can be resumed
+// with ResumeStreamEncryptor, by any AEAD instance with the same key.  The
+// encryptor may continue to be used.
+//
+// The resumed encryptor will produce output identical to that of an
+// uninterrupted run, to be appended to the first Offset() bytes of the
+// original output.  It is the caller's responsibility to ensure that the
+// same plaintext is written after resuming, as the keystream is a function
+// of the snapshot, and older snapshots can be replayed.
+func (e *StreamEncryptor) Snapshot() ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.aead.sealSnapshot(snapshotKindEncryptor, cap(e.buf), e.total, &e.s, e.buf)
+}
+
+// Offset returns the number of bytes written to the underlying writer.
+func (e *StreamEncryptor) Offset() int64 {
+	return streamOffset(e.total, cap(e.buf))
+}
+
+// Snapshot returns an encrypted and authenticated snapshot of the
+// decryptor's state, including any authenticated plaintext that has not
+// been read yet, that can be resumed with ResumeStreamDecryptor, by any AEAD
+// instance with the same key.  The decryptor may continue to be used.
+func (d *StreamDecryptor) Snapshot() ([]byte, error) {
+	if d.err != nil && d.err != io.EOF {
+		return nil, d.err
+	}
+	if d.err == io.EOF {
+		// The state is burned on finalization, and there is nothing
+		// further to read from the underlying reader.
+		return nil, ErrStreamClosed
+	}
+	return d.aead.sealSnapshot(snapshotKindDecryptor, d.interval, d.total, &d.s, d.avail)
+}
+
+// Offset returns the number of bytes read from the underlying reader.
+func (d *StreamDecryptor) Offset() int64 {
+	return streamOffset(d.total, d.interval)
+}
+
+// ResumeStreamEncryptor returns a StreamEncryptor that resumes from a
+// snapshot, writing to w, which should append to the first Offset() bytes
+// of the original output.  The configuration must match the one used to
+// create the original encryptor.
+func (ae *AEAD) ResumeStreamEncryptor(w io.Writer, snapshot []byte, cfg *StreamConfig) (*StreamEncryptor, error) {
+	interval, err := cfg.interval()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &StreamEncryptor{
+		aead: ae,
+		w:    w,
+		buf:  make([]byte, 0, interval),
+	}
+	if e.buf, err = ae.openSnapshot(snapshotKindEncryptor, interval, snapshot, &e.total, &e.s, e.buf); err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		e.footer = cfg.Footer
+	}
+
+	return e, nil
+}
+
+// ResumeStreamDecryptor returns a StreamDecryptor that resumes from a
+// snapshot, reading from r, which must be positioned at Offset() bytes into
+// the stream.  The configuration must match the one used to create the
+// original decryptor.
+func (ae *AEAD) ResumeStreamDecryptor(r io.Reader, snapshot []byte, cfg *StreamConfig) (*StreamDecryptor, error) {
+	interval, err := cfg.interval()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &StreamDecryptor{
+		aead:     ae,
+		r:        r,
+		buf:      make([]byte, interval+TagSize),
+		interval: interval,
+	}
+	if d.avail, err = ae.openSnapshot(snapshotKindDecryptor, interval, snapshot, &d.total, &d.s, d.buf[:0]); err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		d.footer = cfg.Footer
+	}
+
+	return d, nil
+}
+
+func (ae *AEAD) sealSnapshot(kind byte, interval int, total uint64, s *state, buf []byte) ([]byte, error) {
+	pt := make([]byte, snapshotHeaderSize, snapshotHeaderSize+len(buf))
+	pt[0], pt[1], pt[2] = snapshotVersion, kind, byte(s.perm.rounds)
+	binary.BigEndian.PutUint32(pt[3:], uint32(interval))
+	binary.BigEndian.PutUint64(pt[7:], total)
+	for i, v := range s.s {
+		binary.LittleEndian.PutUint64(pt[15+i*8:], v)
+	}
+	binary.BigEndian.PutUint32(pt[snapshotHeaderSize-4:], uint32(len(buf)))
+	pt = append(pt, buf...)
+	defer burnBytes(pt)
+
+	if ae.isReset() {
+		return nil, ErrReset
+	}
+	return ae.SealSIV(nil, nil, pt, []byte(snapshotLabel), []byte{kind}), nil
+}
+
+func (ae *AEAD) openSnapshot(kind byte, interval int, snapshot []byte, total *uint64, s *state, buf []byte) ([]byte, error) {
+	if ae.isReset() {
+		return nil, ErrReset
+	}
+	pt, err := ae.OpenSIV(nil, nil, snapshot, []byte(snapshotLabel), []byte{kind})
+	if err != nil {
+		if err == ErrOpen {
+			err = ErrInvalidSnapshot
+		}
+		return nil, err
+	}
+	if len(pt) < snapshotHeaderSize {
+		return nil, ErrInvalidSnapshot
+	}
+	defer burnBytes(pt)
+
+	if pt[0] != snapshotVersion || pt[1] != kind || int(pt[2]) != ae.perm.rounds {
+		return nil, ErrInvalidSnapshot
+	}
+	if binary.BigEndian.Uint32(pt[3:]) != uint32(interval) {
+		return nil, ErrInvalidSnapshot
+	}
+	bufLen := binary.BigEndian.Uint32(pt[snapshotHeaderSize-4:])
+	if uint64(bufLen) != uint64(len(pt)-snapshotHeaderSize) || int(bufLen) > cap(buf) {
+		return nil, ErrInvalidSnapshot
+	}
+
+	*total = binary.BigEndian.Uint64(pt[7:])
+	s.perm = ae.perm
+	for i := range s.s {
+		s.s[i] = binary.LittleEndian.Uint64(pt[15+i*8:])
+	}
+
+	return append(buf, pt[snapshotHeaderSize:]...), nil
+}
+
+func streamOffset(total uint64, interval int) int64 {
+	return int64(total / uint64(interval) * uint64(interval+TagSize))
+}
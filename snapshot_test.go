@@ -0,0 +1,125 @@
+// snapshot_test.go - Stream snapshot and resume tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamSnapshot(t *testing.T) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	_, err = rand.Read(nonce[:])
+	require.NoError(err, "rand.Read(nonce)")
+
+	aead := newTestAEAD(k[:], 4)
+	cfg := &StreamConfig{
+		Header:             []byte("snapshot header"),
+		Footer:             []byte("snapshot footer"),
+		CheckpointInterval: 2 * StreamBlockSize,
+	}
+
+	msg := make([]byte, 1000)
+	_, err = rand.Read(msg)
+	require.NoError(err, "rand.Read(msg)")
+
+	var expected bytes.Buffer
+	enc, err := aead.NewStreamEncryptor(&expected, nonce[:], cfg)
+	require.NoError(err, "NewStreamEncryptor()")
+	_, err = enc.Write(msg)
+	require.NoError(err, "Write()")
+	require.NoError(enc.Close(), "Close()")
+	_, err = enc.Snapshot()
+	require.Equal(ErrStreamClosed, err, "Snapshot(): Closed")
+
+	for _, split := range []int{0, 1, 96, 192, 193, 500, 1000} {
+		// Interrupt the encryption, and resume it with a different
+		// instance.
+		var ct bytes.Buffer
+		enc, err = aead.NewStreamEncryptor(&ct, nonce[:], cfg)
+		require.NoError(err, "NewStreamEncryptor(%d)", split)
+		_, err = enc.Write(msg[:split])
+		require.NoError(err, "Write(%d)", split)
+		snap, err := enc.Snapshot()
+		require.NoError(err, "Snapshot(%d)", split)
+		off := enc.Offset()
+		require.Equal(int64(ct.Len()), off, "Offset(%d)", split)
+
+		resumeAEAD := newTestAEAD(k[:], 4)
+		enc, err = resumeAEAD.ResumeStreamEncryptor(&ct, snap, cfg)
+		require.NoError(err, "ResumeStreamEncryptor(%d)", split)
+		_, err = enc.Write(msg[split:])
+		require.NoError(err, "Write(%d): Resumed", split)
+		require.NoError(enc.Close(), "Close(%d): Resumed", split)
+		require.Equal(expected.Bytes(), ct.Bytes(), "Resumed(%d): Identical", split)
+
+		// Likewise for decryption, which can not be snapshotted once the
+		// final tag has been verified.
+		if split == len(msg) {
+			continue
+		}
+		dec, err := aead.NewStreamDecryptor(bytes.NewReader(expected.Bytes()), nonce[:], cfg)
+		require.NoError(err, "NewStreamDecryptor(%d)", split)
+		pt := make([]byte, split)
+		_, err = dec.Read(pt[:0])
+		require.NoError(err, "Read(%d)", split)
+		for n := 0; n < split; {
+			m, err := dec.Read(pt[n:])
+			require.NoError(err, "Read(%d)", split)
+			n += m
+		}
+		snap, err = dec.Snapshot()
+		require.NoError(err, "Snapshot(%d): Decryptor", split)
+
+		dec, err = resumeAEAD.ResumeStreamDecryptor(bytes.NewReader(expected.Bytes()[dec.Offset():]), snap, cfg)
+		require.NoError(err, "ResumeStreamDecryptor(%d)", split)
+		rest, err := ioutil.ReadAll(dec)
+		require.NoError(err, "ReadAll(%d): Resumed", split)
+		require.Equal(msg, append(pt, rest...), "ReadAll(%d): Resumed", split)
+	}
+
+	enc, err = aead.NewStreamEncryptor(ioutil.Discard, nonce[:], cfg)
+	require.NoError(err, "NewStreamEncryptor()")
+	_, err = enc.Write(msg[:100])
+	require.NoError(err, "Write()")
+	snap, err := enc.Snapshot()
+	require.NoError(err, "Snapshot()")
+
+	// Tampering with the snapshot is detected.
+	for _, pos := range []int{0, len(snap) / 2, len(snap) - 1} {
+		bad := append([]byte{}, snap...)
+		bad[pos] ^= 0x01
+		_, err = aead.ResumeStreamEncryptor(ioutil.Discard, bad, cfg)
+		require.Equal(ErrInvalidSnapshot, err, "ResumeStreamEncryptor(): Tampered %d", pos)
+	}
+	_, err = aead.ResumeStreamEncryptor(ioutil.Discard, snap[:len(snap)-1], cfg)
+	require.Equal(ErrInvalidSnapshot, err, "ResumeStreamEncryptor(): Truncated")
+
+	// Snapshots are bound to the key, variant, kind, and interval.
+	var k2 [KeySize]byte
+	_, err = newTestAEAD(k2[:], 4).ResumeStreamEncryptor(ioutil.Discard, snap, cfg)
+	require.Equal(ErrInvalidSnapshot, err, "ResumeStreamEncryptor(): Wrong key")
+	_, err = newTestAEAD(k[:], 6).ResumeStreamEncryptor(ioutil.Discard, snap, cfg)
+	require.Equal(ErrInvalidSnapshot, err, "ResumeStreamEncryptor(): Wrong variant")
+	_, err = aead.ResumeStreamDecryptor(bytes.NewReader(nil), snap, cfg)
+	require.Equal(ErrInvalidSnapshot, err, "ResumeStreamDecryptor(): Wrong kind")
+	_, err = aead.ResumeStreamEncryptor(ioutil.Discard, snap, &StreamConfig{CheckpointInterval: StreamBlockSize})
+	require.Equal(ErrInvalidSnapshot, err, "ResumeStreamEncryptor(): Wrong interval")
+
+	// The snapshot does not leak the buffered plaintext.
+	require.False(bytes.Contains(snap, msg[:100]), "Snapshot(): Plaintext")
+}
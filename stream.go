@@ -0,0 +1,340 @@
+// stream.go - Streaming interface with intermediate tags
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+const (
+	// StreamBlockSize is the granularity of the checkpoint interval.
+	StreamBlockSize = bytesR
+
+	// DefaultCheckpointInterval is the default number of payload bytes
+	// between checkpoints.
+	DefaultCheckpointInterval = 1024 * StreamBlockSize
+)
+
+var (
+	// ErrInvalidCheckpointInterval is the error returned when a checkpoint
+	// interval is not a positive multiple of StreamBlockSize.
+	ErrInvalidCheckpointInterval = errors.New("norx: invalid checkpoint interval")
+
+	// ErrStreamClosed is the error returned when writing to a closed
+	// StreamEncryptor.
+	ErrStreamClosed = errors.New("norx: stream closed")
+)
+
+// StreamConfig is the configuration for a stream.
+type StreamConfig struct {
+	// Header and Footer are the optional additional data.  The footer is
+	// only authenticated by the final tag.
+	Header []byte
+	Footer []byte
+
+	// CheckpointInterval is the number of payload bytes between
+	// checkpoints, which must be a multiple of StreamBlockSize, with 0
+	// meaning DefaultCheckpointInterval.
+	CheckpointInterval int
+}
+
+func (cfg *StreamConfig) interval() (int, error) {
+	if cfg == nil || cfg.CheckpointInterval == 0 {
+		return DefaultCheckpointInterval, nil
+	}
+	if cfg.CheckpointInterval < 0 || cfg.CheckpointInterval%StreamBlockSize != 0 {
+		return 0, ErrInvalidCheckpointInterval
+	}
+	return cfg.CheckpointInterval, nil
+}
+
+// StreamEncryptor is an io.WriteCloser that encrypts and authenticates a
+// stream as a single NORX message, emitting a checkpoint tag after every
+// CheckpointInterval bytes of ciphertext.
+//
+// The checkpoint tags are derived from a copy of the running state, with a
+// dedicated domain separation tag, and do not alter it, so removing the
+// checkpoints from the output results in exactly what Seal would produce,
+// and the final tag covers the entire stream.  The output is:
+//
+//	for each full interval of payload {
+//		ciphertext [CheckpointInterval]byte
+//		checkpoint [TagSize]byte
+//	}
+//	ciphertext [< CheckpointInterval]byte
+//	tag        [TagSize]byte
+type StreamEncryptor struct {
+	aead   *AEAD
+	w      io.Writer
+	s      state
+	buf    []byte
+	footer []byte
+	total  uint64
+	err    error
+}
+
+// Write encrypts p, and writes the ciphertext (and checkpoints) to the
+// underlying writer.  Output is buffered up to the checkpoint interval.
+func (e *StreamEncryptor) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	e.aead.lock.RLock()
+	defer e.aead.lock.RUnlock()
+
+	if e.aead.reset {
+		e.err = ErrReset
+		return 0, e.err
+	}
+
+	var written int
+	for len(p) > 0 {
+		n := len(p)
+		if space := cap(e.buf) - len(e.buf); n > space {
+			n = space
+		}
+		e.buf = append(e.buf, p[:n]...)
+		p, written = p[n:], written+n
+
+		if len(e.buf) == cap(e.buf) {
+			if e.err = e.flushSegment(); e.err != nil {
+				return written, e.err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Close finishes encrypting the stream, and writes the remaining
+// ciphertext and the final tag to the underlying writer, which is not
+// closed.
+func (e *StreamEncryptor) Close() error {
+	if e.err != nil {
+		if e.err == ErrStreamClosed {
+			return nil
+		}
+		return e.err
+	}
+
+	e.aead.lock.RLock()
+	defer e.aead.lock.RUnlock()
+
+	if e.aead.reset {
+		e.err = ErrReset
+		return e.err
+	}
+
+	var tag [TagSize]byte
+	e.s.finishPayload(e.buf, e.buf, e.total, false)
+	e.s.absorbData(e.footer, tagTrailer)
+	e.s.finalize(tag[:], e.aead.key)
+
+	e.err = ErrStreamClosed
+	if _, err := e.w.Write(append(e.buf, tag[:]...)); err != nil {
+		e.err = err
+		return err
+	}
+	return nil
+}
+
+func (e *StreamEncryptor) flushSegment() error {
+	var tag [TagSize]byte
+
+	e.s.encryptBlocks(e.buf, e.buf)
+	e.s.checkpoint(tag[:], e.aead.key)
+	e.total += uint64(len(e.buf))
+
+	if _, err := e.w.Write(e.buf); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(tag[:]); err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+
+	return nil
+}
+
+// StreamDecryptor is an io.Reader that decrypts and authenticates a stream
+// produced by a StreamEncryptor.  Plaintext is only returned once the
+// checkpoint (or final) tag covering it has been verified, so tampering is
+// detected at the next checkpoint, and no unauthenticated plaintext is ever
+// returned.  A truncated stream results in ErrOpen.
+type StreamDecryptor struct {
+	aead     *AEAD
+	r        io.Reader
+	s        state
+	buf      []byte
+	avail    []byte
+	footer   []byte
+	interval int
+	total    uint64
+	err      error
+}
+
+// Read reads authenticated plaintext from the stream.
+func (d *StreamDecryptor) Read(p []byte) (int, error) {
+	for len(d.avail) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.readSegment()
+	}
+
+	n := copy(p, d.avail)
+	d.avail = d.avail[n:]
+	return n, nil
+}
+
+func (d *StreamDecryptor) readSegment() error {
+	d.aead.lock.RLock()
+	defer d.aead.lock.RUnlock()
+
+	if d.aead.reset {
+		return ErrReset
+	}
+
+	var tag [TagSize]byte
+	buf := d.buf[:d.interval+TagSize]
+	n, err := io.ReadFull(d.r, buf)
+	switch err {
+	case nil:
+		// Full segment, verify the checkpoint.
+		ct, srcTag := buf[:d.interval], buf[d.interval:]
+		d.s.decryptBlocks(ct, ct)
+		d.s.checkpoint(tag[:], d.aead.key)
+		if subtle.ConstantTimeCompare(srcTag, tag[:]) != 1 {
+			burnBytes(ct)
+			return ErrOpen
+		}
+		d.total += uint64(len(ct))
+		d.avail = ct
+		return nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		// Final segment, verify the tag.
+		if n < TagSize {
+			return ErrOpen
+		}
+		ct, srcTag := buf[:n-TagSize], buf[n-TagSize:n]
+		d.s.finishPayload(ct, ct, d.total, true)
+		d.s.absorbData(d.footer, tagTrailer)
+		d.s.finalize(tag[:], d.aead.key)
+		if subtle.ConstantTimeCompare(srcTag, tag[:]) != 1 {
+			if len(ct) > 0 {
+				burnBytes(ct)
+			}
+			return ErrOpen
+		}
+		d.avail = ct
+		return io.EOF
+	default:
+		return err
+	}
+}
+
+// NewStreamEncryptor returns a new StreamEncryptor that writes to w, with
+// the provided nonce and configuration (which may be nil).
+func (ae *AEAD) NewStreamEncryptor(w io.Writer, nonce []byte, cfg *StreamConfig) (*StreamEncryptor, error) {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+	interval, err := cfg.interval()
+	if err != nil {
+		return nil, err
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return nil, ErrReset
+	}
+	if ae.nonceGuard != nil {
+		ae.nonceGuard.check(nonce)
+	}
+
+	e := &StreamEncryptor{
+		aead: ae,
+		w:    w,
+		buf:  make([]byte, 0, interval),
+	}
+	e.s.perm = ae.perm
+	e.s.init(ae.key, nonce)
+	if cfg != nil {
+		e.s.absorbData(cfg.Header, tagHeader)
+		e.footer = cfg.Footer
+	}
+
+	return e, nil
+}
+
+// NewStreamDecryptor returns a new StreamDecryptor that reads from r, with
+// the provided nonce and configuration (which may be nil), which must match
+// those used to create the StreamEncryptor.
+func (ae *AEAD) NewStreamDecryptor(r io.Reader, nonce []byte, cfg *StreamConfig) (*StreamDecryptor, error) {
+	if len(nonce) != NonceSize {
+		panic(ErrInvalidNonceSize)
+	}
+	interval, err := cfg.interval()
+	if err != nil {
+		return nil, err
+	}
+
+	ae.lock.RLock()
+	defer ae.lock.RUnlock()
+
+	if ae.reset {
+		return nil, ErrReset
+	}
+
+	d := &StreamDecryptor{
+		aead:     ae,
+		r:        r,
+		buf:      make([]byte, interval+TagSize),
+		interval: interval,
+	}
+	d.s.perm = ae.perm
+	d.s.init(ae.key, nonce)
+	if cfg != nil {
+		d.s.absorbData(cfg.Header, tagHeader)
+		d.footer = cfg.Footer
+	}
+
+	return d, nil
+}
+
+// finishPayload processes the remainder of the payload, after total bytes
+// have been processed in full blocks, including the final padded block, so
+// that the state matches that of encryptData/decryptData on the entire
+// payload.
+func (s *state) finishPayload(out, in []byte, total uint64, decrypt bool) {
+	switch {
+	case len(in) > 0 && decrypt:
+		s.decryptData(out, in)
+	case len(in) > 0:
+		s.encryptData(out, in)
+	case total > 0 && decrypt:
+		// The payload was a multiple of the block size, so only the
+		// (empty) padded block remains.
+		decryptLastBlockRef(s, nil, nil)
+	case total > 0:
+		encryptLastBlockRef(s, nil, nil)
+	}
+}
+
+// checkpoint derives an intermediate tag from a copy of the state, as with
+// finalize, but with a distinct domain separation tag.  The state is not
+// modified.
+func (s *state) checkpoint(tag, key []byte) {
+	c := *s
+	c.squeeze(tag, key, tagCheckpoint)
+}
@@ -0,0 +1,165 @@
+// stream_test.go - Streaming interface tests
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	forceDisableHardwareAcceleration()
+	doTestStream(t)
+
+	if !canAccelerate {
+		t.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	forEachAcceleratedImpl(func() { doTestStream(t) })
+}
+
+func doTestStream(t *testing.T) {
+	impl := "_" + hardwareAccelImpl.name
+
+	for _, l := range []int{4, 6} {
+		n := fmt.Sprintf("NORX64-%d-1", l)
+		t.Run(n+impl, func(t *testing.T) { doTestStreamAEAD(t, l) })
+	}
+}
+
+// stripCheckpoints removes the checkpoints from a stream.
+func stripCheckpoints(b []byte, interval int) []byte {
+	var out []byte
+	for len(b) >= interval+TagSize {
+		out = append(out, b[:interval]...)
+		b = b[interval+TagSize:]
+	}
+	return append(out, b...)
+}
+
+func doTestStreamAEAD(t *testing.T, l int) {
+	require := require.New(t)
+
+	var k [KeySize]byte
+	var nonce [NonceSize]byte
+	_, err := rand.Read(k[:])
+	require.NoError(err, "rand.Read(k)")
+	_, err = rand.Read(nonce[:])
+	require.NoError(err, "rand.Read(nonce)")
+
+	aead := newTestAEAD(k[:], l)
+	const interval = 2 * StreamBlockSize
+	cfg := &StreamConfig{
+		Header:             []byte("stream header"),
+		Footer:             []byte("stream footer"),
+		CheckpointInterval: interval,
+	}
+
+	for _, sz := range []int{0, 1, 95, 96, 191, 192, 193, 384, 1000} {
+		msg := make([]byte, sz)
+		_, err = rand.Read(msg)
+		require.NoError(err, "rand.Read(msg)")
+
+		// Write in odd sized chunks.
+		var ctBuf bytes.Buffer
+		enc, err := aead.NewStreamEncryptor(&ctBuf, nonce[:], cfg)
+		require.NoError(err, "NewStreamEncryptor(%d)", sz)
+		for off := 0; off < sz; off += 37 {
+			end := off + 37
+			if end > sz {
+				end = sz
+			}
+			n, err := enc.Write(msg[off:end])
+			require.NoError(err, "Write(%d)", sz)
+			require.Equal(end-off, n, "Write(%d)", sz)
+		}
+		require.NoError(enc.Close(), "Close(%d)", sz)
+		require.NoError(enc.Close(), "Close(%d): Twice", sz)
+		_, err = enc.Write([]byte{0})
+		require.Equal(ErrStreamClosed, err, "Write(%d): Closed", sz)
+
+		ct := ctBuf.Bytes()
+		nCheckpoints := sz / interval
+		require.Len(ct, sz+TagSize*(nCheckpoints+1), "Stream(%d): Length", sz)
+		expected := aead.Seal(nil, nonce[:], msg, cfg.Header, cfg.Footer)
+		require.Equal(expected, stripCheckpoints(ct, interval), "Stream(%d): Seal compatible", sz)
+
+		dec, err := aead.NewStreamDecryptor(iotest.HalfReader(bytes.NewReader(ct)), nonce[:], cfg)
+		require.NoError(err, "NewStreamDecryptor(%d)", sz)
+		pt, err := ioutil.ReadAll(dec)
+		require.NoError(err, "ReadAll(%d)", sz)
+		require.Equal(msg, append([]byte{}, pt...), "ReadAll(%d)", sz)
+
+		// Truncation is detected.
+		if len(ct) > TagSize {
+			for _, cut := range []int{1, TagSize, interval + TagSize} {
+				if cut > len(ct) {
+					continue
+				}
+				dec, err = aead.NewStreamDecryptor(bytes.NewReader(ct[:len(ct)-cut]), nonce[:], cfg)
+				require.NoError(err, "NewStreamDecryptor(%d): Truncated", sz)
+				_, err = ioutil.ReadAll(dec)
+				require.Equal(ErrOpen, err, "ReadAll(%d): Truncated %d", sz, cut)
+			}
+		}
+	}
+
+	// Tampering is detected at the next checkpoint, before any of the
+	// plaintext following it is released.
+	msg := make([]byte, 5*interval)
+	var ctBuf bytes.Buffer
+	enc, err := aead.NewStreamEncryptor(&ctBuf, nonce[:], cfg)
+	require.NoError(err, "NewStreamEncryptor()")
+	_, err = enc.Write(msg)
+	require.NoError(err, "Write()")
+	require.NoError(enc.Close(), "Close()")
+
+	for _, pos := range []int{interval + TagSize + 1, 2*interval + TagSize + 3} {
+		bad := append([]byte{}, ctBuf.Bytes()...)
+		bad[pos] ^= 0x01
+		dec, err := aead.NewStreamDecryptor(bytes.NewReader(bad), nonce[:], cfg)
+		require.NoError(err, "NewStreamDecryptor(): Tampered")
+		pt, err := ioutil.ReadAll(dec)
+		require.Equal(ErrOpen, err, "ReadAll(): Tampered %d", pos)
+		require.Len(pt, (pos/(interval+TagSize))*interval, "ReadAll(): Tampered %d", pos)
+	}
+
+	// The footer is only covered by the final tag.
+	badCfg := *cfg
+	badCfg.Footer = nil
+	dec, err := aead.NewStreamDecryptor(bytes.NewReader(ctBuf.Bytes()), nonce[:], &badCfg)
+	require.NoError(err, "NewStreamDecryptor(): Footer")
+	pt, err := ioutil.ReadAll(dec)
+	require.Equal(ErrOpen, err, "ReadAll(): Footer")
+	require.Len(pt, len(msg), "ReadAll(): Footer")
+
+	_, err = aead.NewStreamEncryptor(ioutil.Discard, nonce[:], &StreamConfig{CheckpointInterval: 100})
+	require.Equal(ErrInvalidCheckpointInterval, err, "NewStreamEncryptor(): Interval")
+	_, err = aead.NewStreamDecryptor(bytes.NewReader(nil), nonce[:], &StreamConfig{CheckpointInterval: -96})
+	require.Equal(ErrInvalidCheckpointInterval, err, "NewStreamDecryptor(): Interval")
+
+	// Errors from the underlying writer are sticky.
+	enc, err = aead.NewStreamEncryptor(errWriter{}, nonce[:], cfg)
+	require.NoError(err, "NewStreamEncryptor(): Writer error")
+	_, err = enc.Write(msg)
+	require.Equal(io.ErrShortWrite, err, "Write(): Writer error")
+	require.Equal(io.ErrShortWrite, enc.Close(), "Close(): Writer error")
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
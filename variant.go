@@ -0,0 +1,67 @@
+// variant.go - NORX variants
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package norx
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidVariant is the error returned when a variant is unknown.
+var ErrInvalidVariant = errors.New("norx: invalid variant")
+
+// Variant is a NORX variant identifier, as used in serialized formats.
+type Variant uint8
+
+const (
+	// VariantNORX6441 is NORX64-4-1.
+	VariantNORX6441 Variant = 1
+
+	// VariantNORX6461 is NORX64-6-1.
+	VariantNORX6461 Variant = 2
+)
+
+// String returns the name of the variant.
+func (v Variant) String() string {
+	switch v {
+	case VariantNORX6441:
+		return "NORX64-4-1"
+	case VariantNORX6461:
+		return "NORX64-6-1"
+	default:
+		return "Variant(" + strconv.Itoa(int(v)) + ")"
+	}
+}
+
+// Valid returns true iff the variant is known.
+func (v Variant) Valid() bool {
+	return v.rounds() != 0
+}
+
+func (v Variant) rounds() int {
+	switch v {
+	case VariantNORX6441:
+		return 4
+	case VariantNORX6461:
+		return 6
+	default:
+		return 0
+	}
+}
+
+// Variant returns the variant of the AEAD instance.
+func (ae *AEAD) Variant() Variant {
+	switch ae.perm.rounds {
+	case 4:
+		return VariantNORX6441
+	case 6:
+		return VariantNORX6461
+	default:
+		panic("BUG: unsupported round count")
+	}
+}